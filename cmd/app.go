@@ -4,64 +4,146 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/brickster241/GitEngine/plumbing"
 	"github.com/brickster241/GitEngine/porcelain"
 )
 
 // Entry point of the application - Check for all commands.
 func main() {
 
-	// When you create a build, the first argument is always the name of the executable.
-	if len(os.Args) == 1 {
+	// When you create a build, the first argument is always the name of the executable, so skip it.
+	args := os.Args[1:]
+
+	// Global options before the command : -C <path> runs as if gegit was started in <path>. Can be repeated, each one relative to the previous.
+	for len(args) >= 2 && args[0] == "-C" {
+		if err := os.Chdir(args[1]); err != nil {
+			fmt.Printf("fatal: cannot change to '%s': %s\n", args[1], err)
+			os.Exit(128)
+		}
+		args = args[2:]
+	}
+
+	if len(args) == 0 {
 
 		// No arguments provided
 		fmt.Printf("gegit: command cannot be empty. See 'gegit help' for available commands.\n")
 		fmt.Println("usage: gegit <command> [<args>]")
 		os.Exit(0)
 	}
-	switch os.Args[1] {
 
-	case "init":
+	// init is the only command which runs without an existing repository
+	if args[0] == "init" {
 		// Initialize a new repository
-		porcelain.InitRepo(os.Args[1:])
+		porcelain.InitRepo(args)
+		return
+	}
+
+	// Every other command operates on the repository containing the current directory (or the one named by GIT_DIR / GIT_WORK_TREE)
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println("fatal: unable to get current working directory:", err)
+		os.Exit(128)
+	}
+	repo, err := plumbing.OpenFromEnv(cwd)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+
+	// Warned about once here, the index is written in version 2 meanwhile
+	if _, err := repo.IndexVersion(); err != nil {
+		fmt.Printf("warning: %s.\nUsing version 2\n", err)
+	}
+
+	switch args[0] {
+
 	case "add":
 		// Add files to the staging area / index
-		porcelain.AddFiles(os.Args[1:])
+		porcelain.AddFiles(repo, args)
 	case "status":
 		// Show the working tree status
-		porcelain.ShowStatus(os.Args[1:])
+		porcelain.ShowStatus(repo, args)
 	case "commit":
 		// Commit changes to the repository
-		porcelain.CommitChanges(os.Args[1:])
+		porcelain.CommitChanges(repo, args)
+	case "log":
+		// Show commit logs
+		porcelain.ShowLog(repo, args)
+	case "diff":
+		// Show changes between the working tree, the index and commits
+		porcelain.ShowDiff(repo, args)
 	case "config":
 		// Get or Set keys in .git/config
-		porcelain.GetOrSetConfig(os.Args[1:])
+		porcelain.GetOrSetConfig(repo, args)
 	case "cat-file":
 		// Show type, size and content for repository objects
-		porcelain.CatFileRepoObject(os.Args[1:])
+		porcelain.CatFileRepoObject(repo, args)
 	case "hash-object":
 		// Compute object id from a file
-		porcelain.HashAndWriteObject(os.Args[1:])
+		porcelain.HashAndWriteObject(repo, args)
 	case "update-index":
 		// Register file contents in the working tree to the index
-		porcelain.RegisterFileAndUpdateIndex(os.Args[1:])
+		porcelain.RegisterFileAndUpdateIndex(repo, args)
+	case "ls-files":
+		// Show information about files in the index and the working tree
+		porcelain.ListFiles(repo, args)
 	case "ls-tree":
 		// List the contents of a tree object
-		porcelain.LSTree(os.Args[1:])
+		porcelain.LSTree(repo, args)
 	case "write-tree":
 		// Create a tree object from the current index
-		porcelain.WriteTreeFromIndex(os.Args[1:])
+		porcelain.WriteTreeFromIndex(repo, args)
 	case "read-tree":
 		// Reads tree information from treeish object into the index
-		porcelain.ReadTreeToIndex(os.Args[1:])
+		porcelain.ReadTreeToIndex(repo, args)
 	case "checkout":
 		// Switch branches or restore working tree files.
-		porcelain.CheckoutCommit(os.Args[1:])
+		porcelain.CheckoutCommit(repo, args)
+	case "merge":
+		// Join two development histories together
+		porcelain.MergeBranch(repo, args)
+	case "merge-base":
+		// Find as good common ancestors as possible for a merge
+		porcelain.MergeBaseOps(repo, args)
 	case "branch":
 		// List, Create or Delete branch references.
-		porcelain.BranchOps(os.Args[1:])
+		porcelain.BranchOps(repo, args)
+	case "tag":
+		// List, create or delete tags.
+		porcelain.TagOps(repo, args)
+	case "check-ignore":
+		// Debug gitignore / exclude files.
+		porcelain.CheckIgnore(repo, args)
+	case "clean":
+		// Remove untracked files from the working tree.
+		porcelain.CleanWorkTree(repo, args)
+	case "fsck":
+		// Verify the connectivity and validity of the repository data.
+		porcelain.CheckRepository(repo, args)
+	case "gc":
+		// Pack reachable objects and remove redundant loose objects.
+		porcelain.GarbageCollect(repo, args)
+	case "pack-refs":
+		// Pack refs into .git/packed-refs.
+		porcelain.PackRefs(repo, args)
+	case "prune":
+		// Remove unreachable loose objects older than the grace period.
+		porcelain.PruneObjects(repo, args)
+	case "reflog":
+		// Show, expire or delete reflog entries.
+		porcelain.ReflogOps(repo, args)
+	case "repack":
+		// Pack unpacked objects in a repository.
+		porcelain.RepackObjects(repo, args)
+	case "symbolic-ref":
+		// Read, update or delete symbolic refs.
+		porcelain.SymbolicRef(repo, args)
+	case "update-ref":
+		// Update, create or delete refs safely, all or none.
+		porcelain.UpdateRef(repo, args)
 	default:
 		// Command not found
-		fmt.Printf("gegit: '%s' is not a git command. See 'gegit help' for available commands.\n", os.Args[1])
+		fmt.Printf("gegit: '%s' is not a git command. See 'gegit help' for available commands.\n", args[0])
 		fmt.Println("usage: gegit <command> [<args>]")
 	}
 }
@@ -0,0 +1,197 @@
+package plumbing
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// WriteIndexTree writes the tree objects of an index read with ReadIndexFile and returns the root tree. Directories still valid in the cache-tree (TREE extension) are reused as they are, and the cache-tree of index is updated for the next time : reports whether it changed, and should be written back with WriteIndexFile.
+func (r *Repository) WriteIndexTree(index *types.Index) ([20]byte, bool, error) {
+	for _, ie := range index.Entries {
+		if ie.Stage() != 0 {
+			return [20]byte{}, false, fmt.Errorf("%s: unmerged", ie.Filename)
+		}
+	}
+
+	if index.CacheTree == nil {
+		index.CacheTree = &types.CacheTree{EntryCount: -1}
+	}
+	updated, err := r.writeCacheTree(index.CacheTree, index.Entries, "")
+	if err != nil {
+		return [20]byte{}, false, err
+	}
+	return index.CacheTree.SHA, updated, nil
+}
+
+// writeCacheTree makes node valid for entries, the sorted index entries below the directory prefix ("" or ending with "/"), writing the tree objects of the directories which are not. Reports whether anything was written.
+func (r *Repository) writeCacheTree(node *types.CacheTree, entries []types.IndexEntry, prefix string) (bool, error) {
+	if node.EntryCount >= 0 && r.Objects.Has(node.SHA) {
+		return false, nil
+	}
+
+	treeEntries := []types.TreeEntry{}
+	subtrees := []*types.CacheTree{}
+	for i := 0; i < len(entries); {
+		name := entries[i].Filename[len(prefix):]
+		dir, _, isDir := strings.Cut(name, "/")
+
+		// Files, keeping the mode recorded in the index (regular, executable or symbolic link)
+		if !isDir {
+			mode := entries[i].Mode
+			if mode == 0 {
+				mode = constants.ModeFile
+			}
+			treeEntries = append(treeEntries, types.TreeEntry{Mode: mode, Name: name, SHA: entries[i].SHA1, Type: types.BlobObject})
+			i++
+			continue
+		}
+
+		// Entries below a directory are next to each other in the sorted index
+		dirPrefix := prefix + dir + "/"
+		j := i
+		for j < len(entries) && strings.HasPrefix(entries[j].Filename, dirPrefix) {
+			j++
+		}
+		child := findSubtree(node, dir)
+		if child == nil {
+			child = &types.CacheTree{Name: dir, EntryCount: -1}
+		}
+		if _, err := r.writeCacheTree(child, entries[i:j], dirPrefix); err != nil {
+			return false, err
+		}
+		subtrees = append(subtrees, child)
+		treeEntries = append(treeEntries, types.TreeEntry{Mode: constants.ModeTree, Name: dir, SHA: child.SHA, Type: types.TreeObject})
+		i = j
+	}
+
+	sha, err := r.writeTreeEntries(treeEntries)
+	if err != nil {
+		return false, err
+	}
+
+	// Like git, subtrees are kept ordered by name length, then name
+	sort.Slice(subtrees, func(a, b int) bool {
+		if len(subtrees[a].Name) != len(subtrees[b].Name) {
+			return len(subtrees[a].Name) < len(subtrees[b].Name)
+		}
+		return subtrees[a].Name < subtrees[b].Name
+	})
+	node.SHA, node.EntryCount, node.Subtrees = sha, len(entries), subtrees
+	return true, nil
+}
+
+// findSubtree returns the subtree of node with the given name, nil if there is none.
+func findSubtree(node *types.CacheTree, name string) *types.CacheTree {
+	for _, sub := range node.Subtrees {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// ValidCacheTrees returns the trees of the directories still valid in a cache-tree, which keep them from being pruned.
+func ValidCacheTrees(node *types.CacheTree) [][20]byte {
+	if node == nil {
+		return nil
+	}
+	trees := [][20]byte{}
+	if node.EntryCount >= 0 {
+		trees = append(trees, node.SHA)
+	}
+	for _, sub := range node.Subtrees {
+		trees = append(trees, ValidCacheTrees(sub)...)
+	}
+	return trees
+}
+
+// invalidateCacheTree marks the directories containing path as changed, from the root down.
+func invalidateCacheTree(node *types.CacheTree, path string) {
+	for node != nil {
+		node.EntryCount = -1
+		dir, rest, found := strings.Cut(path, "/")
+		if !found {
+			return
+		}
+		node, path = findSubtree(node, dir), rest
+	}
+}
+
+// parseCacheTree decodes the data of a TREE extension. Each directory is stored as "<name>\0<entry count> <subtree count>\n", followed by its tree SHA when valid (entry count >= 0) and by its subtrees.
+func parseCacheTree(data []byte) (*types.CacheTree, error) {
+	node, rest, err := parseCacheTreeNode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("corrupt cache-tree: %d trailing bytes", len(rest))
+	}
+	return node, nil
+}
+
+// parseCacheTreeNode decodes one directory of a TREE extension, and returns the data which follows it.
+func parseCacheTreeNode(data []byte) (*types.CacheTree, []byte, error) {
+	nul := bytes.IndexByte(data, 0)
+	if nul == -1 {
+		return nil, nil, fmt.Errorf("corrupt cache-tree: unterminated name")
+	}
+	node := &types.CacheTree{Name: string(data[:nul])}
+	data = data[nul+1:]
+
+	newline := bytes.IndexByte(data, '\n')
+	if newline == -1 {
+		return nil, nil, fmt.Errorf("corrupt cache-tree: unterminated counts")
+	}
+	counts := strings.Fields(string(data[:newline]))
+	data = data[newline+1:]
+	if len(counts) != 2 {
+		return nil, nil, fmt.Errorf("corrupt cache-tree: invalid counts")
+	}
+	entryCount, err1 := strconv.Atoi(counts[0])
+	subtreeCount, err2 := strconv.Atoi(counts[1])
+	if err1 != nil || err2 != nil || subtreeCount < 0 {
+		return nil, nil, fmt.Errorf("corrupt cache-tree: invalid counts")
+	}
+	node.EntryCount = entryCount
+
+	// Only valid directories have a tree
+	if entryCount >= 0 {
+		if len(data) < 20 {
+			return nil, nil, fmt.Errorf("corrupt cache-tree: truncated tree SHA")
+		}
+		copy(node.SHA[:], data[:20])
+		data = data[20:]
+	} else {
+		node.EntryCount = -1
+	}
+
+	for range subtreeCount {
+		sub, rest, err := parseCacheTreeNode(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		node.Subtrees = append(node.Subtrees, sub)
+		data = rest
+	}
+	return node, data, nil
+}
+
+// encodeCacheTree encodes a cache-tree as the data of a TREE extension (see parseCacheTree).
+func encodeCacheTree(node *types.CacheTree) []byte {
+	buffer := []byte(node.Name)
+	buffer = append(buffer, 0)
+	buffer = fmt.Appendf(buffer, "%d %d\n", node.EntryCount, len(node.Subtrees))
+	if node.EntryCount >= 0 {
+		buffer = append(buffer, node.SHA[:]...)
+	}
+	for _, sub := range node.Subtrees {
+		buffer = append(buffer, encodeCacheTree(sub)...)
+	}
+	return buffer
+}
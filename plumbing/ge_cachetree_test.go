@@ -0,0 +1,136 @@
+package plumbing
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+func TestCacheTreeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		tree *types.CacheTree
+	}{
+		{"empty root", &types.CacheTree{EntryCount: 0, SHA: sha1.Sum([]byte("empty"))}},
+		{"invalidated root", &types.CacheTree{EntryCount: -1}},
+		{"nested", &types.CacheTree{EntryCount: 4, SHA: sha1.Sum([]byte("root")), Subtrees: []*types.CacheTree{
+			{Name: "docs", EntryCount: 1, SHA: sha1.Sum([]byte("docs"))},
+			{Name: "src", EntryCount: -1, Subtrees: []*types.CacheTree{
+				{Name: "util", EntryCount: 2, SHA: sha1.Sum([]byte("util"))},
+			}},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCacheTree(encodeCacheTree(tt.tree))
+			if err != nil {
+				t.Fatalf("parseCacheTree: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.tree) {
+				t.Errorf("parseCacheTree(encodeCacheTree(tree)) = %+v, want %+v", got, tt.tree)
+			}
+		})
+	}
+}
+
+func TestParseCacheTreeRejectsCorruptData(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"unterminated name", "src"},
+		{"unterminated counts", "\x001 0"},
+		{"invalid counts", "\x00one 0\n"},
+		{"truncated tree SHA", "\x001 0\nshort"},
+		{"missing subtree", "\x00-1 1\n"},
+		{"trailing bytes", "\x00-1 0\nextra"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := parseCacheTree([]byte(tt.data)); err == nil {
+				t.Errorf("parseCacheTree gave %+v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestIndexKeepsCacheTreeAndExtensions(t *testing.T) {
+	for _, version := range []string{"2", "3", "4"} {
+		t.Run("version "+version, func(t *testing.T) {
+			repo := newTestRepository(t)
+			if err := repo.SetConfig("index.version", version); err != nil {
+				t.Fatal(err)
+			}
+
+			written := &types.Index{
+				Entries: []types.IndexEntry{testIndexEntry("a.txt", 0, 0), testIndexEntry("dir/b.txt", 0, 0)},
+				CacheTree: &types.CacheTree{EntryCount: 2, SHA: sha1.Sum([]byte("root")), Subtrees: []*types.CacheTree{
+					{Name: "dir", EntryCount: 1, SHA: sha1.Sum([]byte("dir"))},
+				}},
+				Extensions: []types.IndexExtension{{Signature: "REUC", Data: []byte("resolve undo\x00")}},
+			}
+			lock, err := repo.LockIndex()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.WriteIndexFile(lock, written); err != nil {
+				t.Fatalf("WriteIndexFile: %s", err)
+			}
+
+			index, err := repo.ReadIndexFile()
+			if err != nil {
+				t.Fatalf("ReadIndexFile: %s", err)
+			}
+			if !reflect.DeepEqual(index, written) {
+				t.Errorf("index read back differs from the one written\ngot:  %+v\nwant: %+v", index, written)
+			}
+		})
+	}
+}
+
+func TestWriteIndexTreeReusesValidDirectories(t *testing.T) {
+	repo := newTestRepository(t)
+	blob, err := repo.WriteObject(types.BlobObject, []byte("content\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := func(name string) types.IndexEntry {
+		ie := testIndexEntry(name, 0, 0)
+		ie.SHA1 = blob
+		return ie
+	}
+	index := &types.Index{Entries: []types.IndexEntry{entry("a.txt"), entry("dir/b.txt"), entry("dir/sub/c.txt")}}
+
+	tree, updated, err := repo.WriteIndexTree(index)
+	if err != nil || !updated {
+		t.Fatalf("WriteIndexTree = %x, %v, %v, want a new tree", tree, updated, err)
+	}
+	if index.CacheTree.EntryCount != 3 || len(index.CacheTree.Subtrees) != 1 || index.CacheTree.Subtrees[0].EntryCount != 2 {
+		t.Errorf("cache-tree not filled in for the index entries: %+v", index.CacheTree)
+	}
+
+	// Nothing changed, nothing to write
+	again, updated, err := repo.WriteIndexTree(index)
+	if err != nil || updated || again != tree {
+		t.Errorf("second WriteIndexTree = %x, %v, %v, want %x, false, nil", again, updated, err, tree)
+	}
+
+	// A changed file invalidates the directories above it only
+	index.Entries[2].SHA1, _ = repo.WriteObject(types.BlobObject, []byte("changed\n"))
+	invalidateCacheTree(index.CacheTree, "dir/sub/c.txt")
+	if index.CacheTree.EntryCount != -1 || index.CacheTree.Subtrees[0].EntryCount != -1 {
+		t.Errorf("directories above a changed file are still valid: %+v", index.CacheTree)
+	}
+	changed, updated, err := repo.WriteIndexTree(index)
+	if err != nil || !updated || changed == tree {
+		t.Errorf("WriteIndexTree after a change = %x, %v, %v, want a new tree", changed, updated, err)
+	}
+
+	// Unmerged entries can't be written
+	index.Entries[0].SetStage(2)
+	if _, _, err := repo.WriteIndexTree(index); err == nil {
+		t.Errorf("WriteIndexTree wrote a tree for an unmerged index")
+	}
+}
@@ -11,68 +11,70 @@ import (
 	"github.com/brickster241/GitEngine/utils/types"
 )
 
-// writeCommit creates a Git commit object, writes it to the object database, and returns the commit SHA.
-func WriteCommit(treeSHA [20]byte, parentsSHA [][20]byte, author types.Author, message string) ([20]byte, error) {
+// WriteCommit creates a Git commit object, writes it to the object database, and returns the commit SHA. author is used as the committer as well, and is dated now unless its When is set.
+func (r *Repository) WriteCommit(treeSHA [20]byte, parentsSHA [][20]byte, author types.Author, message string) ([20]byte, error) {
+	if author.When.IsZero() {
+		author.When = time.Now()
+	}
+
+	// Commit Message (must end with newline)
+	return r.WriteCommitObject(&types.CommitNode{
+		TreeSHA:    treeSHA,
+		ParentsSHA: parentsSHA,
+		Author:     author,
+		Committer:  author,
+		Message:    message + "\n",
+	})
+}
+
+// WriteCommitObject serializes a commit with EncodeCommit and writes it to the object database.
+func (r *Repository) WriteCommitObject(c *types.CommitNode) ([20]byte, error) {
+	return r.WriteObject(types.CommitObject, EncodeCommit(c))
+}
+
+// EncodeCommit serializes a commit into the content of a commit object. Commits read with ReadCommit encode back to the same bytes.
+func EncodeCommit(c *types.CommitNode) []byte {
 	var content bytes.Buffer
 
 	// Tree Line : "tree <sha_hex>\n"
 	content.WriteString("tree ")
-	content.WriteString(hex.EncodeToString(treeSHA[:]))
+	content.WriteString(hex.EncodeToString(c.TreeSHA[:]))
 	content.WriteByte('\n')
 
 	// Parent Line per parent (if exists) : "parent <sha_parent1>\n"
-	for _, parentSHA := range parentsSHA {
+	for _, parentSHA := range c.ParentsSHA {
 		content.WriteString("parent ")
 		content.WriteString(hex.EncodeToString(parentSHA[:]))
 		content.WriteByte('\n')
 	}
 
-	// Calculate sign, and timezone
-	now := time.Now()
-	timestamp := now.Unix()
-	_, offset := now.Zone()
-	sign := "+"
-	if offset < 0 {
-		sign = "-"
-		offset = -offset
-	}
-
-	tz := fmt.Sprintf("%s%02d%02d", sign, offset/3600, (offset%3600)/60)
-
 	// Author Line : "author <name> <email> <timestamp> <timezone>"
-	authorLine := fmt.Sprintf(
-		"author %s <%s> %d %s\n",
-		author.Name,
-		author.Email,
-		timestamp,
-		tz,
-	)
-	// Author Line : "committer <name> <email> <timestamp> <timezone>"
-	committerLine := fmt.Sprintf(
-		"committer %s <%s> %d %s\n",
-		author.Name,
-		author.Email,
-		timestamp,
-		tz,
-	)
-
-	content.WriteString(authorLine)
-	content.WriteString(committerLine)
-
-	// blank line before message
+	content.WriteString("author ")
+	content.WriteString(FormatSignature(c.Author))
 	content.WriteByte('\n')
 
-	// Commit Message (must end with newline)
-	content.WriteString(message)
+	// Committer Line : "committer <name> <email> <timestamp> <timezone>"
+	content.WriteString("committer ")
+	content.WriteString(FormatSignature(c.Committer))
 	content.WriteByte('\n')
 
-	// Write Commit Object to .git/objects
-	return WriteObject(types.CommitObject, content.Bytes())
+	// Other headers, continuation lines start with a space
+	for _, h := range c.ExtraHeaders {
+		content.WriteString(h.Key)
+		content.WriteByte(' ')
+		content.WriteString(strings.ReplaceAll(h.Value, "\n", "\n "))
+		content.WriteByte('\n')
+	}
+
+	// blank line before message
+	content.WriteByte('\n')
+	content.WriteString(c.Message)
+	return content.Bytes()
 }
 
 // ReadCommit reads and parses a commit object from the object database.
-func ReadCommit(sha [20]byte) (*types.CommitNode, error) {
-	objType, data, err := ReadObject(hex.EncodeToString(sha[:]))
+func (r *Repository) ReadCommit(sha [20]byte) (*types.CommitNode, error) {
+	objType, data, err := r.ReadObject(hex.EncodeToString(sha[:]))
 	if err != nil {
 		return nil, err
 	}
@@ -81,51 +83,133 @@ func ReadCommit(sha [20]byte) (*types.CommitNode, error) {
 	if objType != types.CommitObject {
 		return nil, fmt.Errorf("object is not a commit")
 	}
+	return ParseCommit(data)
+}
 
-	// Iterate Line by Line
-	lines := strings.Split(string(data), "\n")
+// ParseCommit parses the content of a commit object.
+func ParseCommit(data []byte) (*types.CommitNode, error) {
 	var c types.CommitNode
-	i := 0
+
+	// Headers end at the first blank line, the rest is the commit message
+	header, message, _ := strings.Cut(string(data), "\n\n")
+	c.Message = message
 
 	// Parse headers
-	for ; i < len(lines); i++ {
-		line := lines[i]
-		if line == "" {
-			i++ // skip blank lines
-			break
+	for _, line := range strings.Split(header, "\n") {
+
+		// Continuation of a multi-line header (e.g. gpgsig)
+		if strings.HasPrefix(line, " ") && len(c.ExtraHeaders) > 0 {
+			last := &c.ExtraHeaders[len(c.ExtraHeaders)-1]
+			last.Value += "\n" + line[1:]
+			continue
 		}
 
-		switch {
-		case strings.HasPrefix(line, "tree"): // Tree Line
-			hash, _ := hex.DecodeString(line[5:])
-			copy(c.TreeSHA[:], hash)
-
-		case strings.HasPrefix(line, "parent "): // Parent Line(s)
-			hash, _ := hex.DecodeString(line[7:])
-			var p [20]byte
-			copy(p[:], hash)
-			c.ParentsSHA = append(c.ParentsSHA, p)
-
-		case strings.HasPrefix(line, "author "): // Author Line
-			parts := strings.Split(line, " ")
-			emailLen := len(parts[2])
-			c.Author = types.Author{
-				Name:  parts[1],
-				Email: parts[2][1 : emailLen-1],
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree": // Tree Line
+			hash, err := hex.DecodeString(value)
+			if err != nil || len(hash) != 20 {
+				return nil, fmt.Errorf("invalid tree line in commit: %s", line)
 			}
+			c.TreeSHA = [20]byte(hash)
+
+		case "parent": // Parent Line(s)
+			hash, err := hex.DecodeString(value)
+			if err != nil || len(hash) != 20 {
+				return nil, fmt.Errorf("invalid parent line in commit: %s", line)
+			}
+			c.ParentsSHA = append(c.ParentsSHA, [20]byte(hash))
+
+		case "author": // Author Line
+			c.Author = ParseSignature(value)
+
+		case "committer": // Committer Line
+			c.Committer = ParseSignature(value)
+
+		case "":
+			// Trailing newline of a commit without message
 
-		case strings.HasPrefix(line, "committer "): // Committer Line
-			c.Committer = line[10:]
+		default: // encoding, gpgsig, mergetag...
+			c.ExtraHeaders = append(c.ExtraHeaders, types.CommitHeader{Key: key, Value: value})
 		}
 	}
-
-	// Remaining Lines = commit message
-	c.Message = strings.Join(lines[i:], "\n")
 	return &c, nil
 }
 
+// ParseSignature parses "<name> <<email>> <timestamp> <timezone>", the value of author, committer and tagger lines. Parsing starts from the end of the line, so names may contain spaces. Missing parts are left empty. The signature itself is kept in Raw, so that FormatSignature gives it back unchanged.
+func ParseSignature(signature string) types.Author {
+	a := parseSignatureFields(signature)
+	a.Raw = signature
+	return a
+}
+
+// parseSignatureFields does the parsing of ParseSignature, leaving Raw empty.
+func parseSignatureFields(signature string) types.Author {
+	var a types.Author
+
+	// Email is between the last "<" and ">"
+	gt := strings.LastIndexByte(signature, '>')
+	lt := -1
+	if gt != -1 {
+		lt = strings.LastIndexByte(signature[:gt], '<')
+	}
+	if lt == -1 {
+		a.Name = strings.TrimSpace(signature)
+		return a
+	}
+	a.Name = strings.TrimSpace(signature[:lt])
+	a.Email = signature[lt+1 : gt]
+
+	// "<timestamp> <timezone>" after the email
+	fields := strings.Fields(signature[gt+1:])
+	if len(fields) != 2 {
+		return a
+	}
+	secs, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return a
+	}
+	a.When = time.Unix(secs, 0).In(time.FixedZone("", parseTimezone(fields[1])))
+	return a
+}
+
+// parseTimezone converts "+hhmm" / "-hhmm" to an offset in seconds east of UTC. Invalid values give 0.
+func parseTimezone(tz string) int {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return 0
+	}
+	hours, errH := strconv.Atoi(tz[1:3])
+	minutes, errM := strconv.Atoi(tz[3:5])
+	if errH != nil || errM != nil {
+		return 0
+	}
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return offset
+}
+
+// FormatSignature is the inverse of ParseSignature : "<name> <<email>> <timestamp> <timezone>". A signature read by ParseSignature and left unchanged is given back byte for byte (odd spacing, "-0000" timezone...). A signature without a date is written without one.
+func FormatSignature(a types.Author) string {
+	if a.Raw != "" && sameSignature(parseSignatureFields(a.Raw), a) {
+		return a.Raw
+	}
+	if a.When.IsZero() {
+		return fmt.Sprintf("%s <%s>", a.Name, a.Email)
+	}
+	return fmt.Sprintf("%s <%s> %d %s", a.Name, a.Email, a.When.Unix(), a.When.Format("-0700"))
+}
+
+// sameSignature reports whether a and b hold the same name, email, time and timezone offset.
+func sameSignature(a, b types.Author) bool {
+	_, offsetA := a.When.Zone()
+	_, offsetB := b.When.Zone()
+	return a.Name == b.Name && a.Email == b.Email && a.When.Equal(b.When) && offsetA == offsetB
+}
+
 // ResolveCommitish takes a commit-ish string, and returns the commit sha associated with it.
-func ResolveCommitish(commitIsh string) ([20]byte, error) {
+func (r *Repository) ResolveCommitish(commitIsh string) ([20]byte, error) {
 
 	var base, suffix string
 	var resultSHA [20]byte // Store resultSHA
@@ -139,11 +223,30 @@ func ResolveCommitish(commitIsh string) ([20]byte, error) {
 		idx = len(commitIsh)
 	}
 
-	// if base is HEAD
-	if base == "HEAD" {
+	// "@" alone is a shortcut for HEAD
+	if base == "@" {
+		base = "HEAD"
+	}
+
+	// if base is a reflog selector : <ref>@{<n>}, <ref>@{<date>} or @{-<n>}
+	if at := strings.Index(base, "@{"); at != -1 && strings.HasSuffix(base, "}") {
+		name, spec := base[:at], base[at+2:len(base)-1]
+		if n, err := strconv.Atoi(spec); err == nil && n < 0 && name == "" {
+			previous, err := r.PreviousBranch(-n)
+			if err != nil {
+				return [20]byte{}, err
+			}
+			if resultSHA, err = r.ResolveCommitish(previous); err != nil {
+				return [20]byte{}, err
+			}
+		} else if resultSHA, err = r.ResolveReflog(name, spec); err != nil {
+			return [20]byte{}, err
+		}
+
+	} else if base == "HEAD" {
 
 		// Fetch HEAD Info
-		headInfo, err := ReadHEADInfo()
+		headInfo, err := r.ReadHEADInfo()
 		if err != nil {
 			return [20]byte{}, err
 		}
@@ -158,13 +261,13 @@ func ResolveCommitish(commitIsh string) ([20]byte, error) {
 
 	} else {
 
-		// Assume it is a branch instead
-		shaHex, exists := ReadBranchRef(base)
+		// Assume it is a ref instead : a tag, a branch, a remote-tracking branch... looked up like git
+		shaHex, exists := r.ReadShortRef(base)
 		if !exists {
 
-			// Check if it is an commit type object in .git/objects
-			objType, _, err := ReadObject(base)
-			if err != nil || objType != types.CommitObject {
+			// Check if it is an commit (or tag) type object in .git/objects
+			objType, _, err := r.ReadObject(base)
+			if err != nil || (objType != types.CommitObject && objType != types.TagObject) {
 				return [20]byte{}, fmt.Errorf("invalid object name: %s", base)
 			} else {
 				shaBytes, _ := hex.DecodeString(base)
@@ -173,6 +276,13 @@ func ResolveCommitish(commitIsh string) ([20]byte, error) {
 		} else {
 			resultSHA = shaHex
 		}
+
+		// A tag stands for the commit it points to
+		peeled, err := r.PeelObject(resultSHA, types.CommitObject)
+		if err != nil {
+			return [20]byte{}, fmt.Errorf("invalid object name: %s", base)
+		}
+		resultSHA = peeled
 	}
 
 	// Iterate the loop, for each ^ or ~, come up with logic
@@ -183,6 +293,19 @@ func ResolveCommitish(commitIsh string) ([20]byte, error) {
 		suffix = commitIsh[idx+1:]
 		numStr := "1"
 
+		// ^{} and ^{commit} peel to a commit, which resultSHA already is. Other types are not commits.
+		if sign == '^' && strings.HasPrefix(suffix, "{") {
+			end := strings.IndexByte(suffix, '}')
+			if end == -1 {
+				return [20]byte{}, fmt.Errorf("invalid object name: %s", commitIsh)
+			}
+			if peelType := suffix[1:end]; peelType != "" && peelType != string(types.CommitObject) {
+				return [20]byte{}, fmt.Errorf("%s: expected %s type, but the object dereferences to commit type", commitIsh, peelType)
+			}
+			idx += end + 2
+			continue
+		}
+
 		// If there is some part on the right remaining. Extract the number from it.
 		if len(suffix) > 0 {
 			nxtIdx := strings.IndexAny(suffix, "^~")
@@ -212,7 +335,7 @@ func ResolveCommitish(commitIsh string) ([20]byte, error) {
 		case '~':
 			// Get num(th) ancestor from baseSHA
 			for i := 0; i < num; i++ {
-				commit, err := ReadCommit(resultSHA)
+				commit, err := r.ReadCommit(resultSHA)
 				if err != nil {
 					return [20]byte{}, err
 				}
@@ -225,7 +348,7 @@ func ResolveCommitish(commitIsh string) ([20]byte, error) {
 			}
 		case '^':
 			// Get num(th) Parent from the baseSHA
-			commit, err := ReadCommit(resultSHA)
+			commit, err := r.ReadCommit(resultSHA)
 			if err != nil {
 				return [20]byte{}, err
 			}
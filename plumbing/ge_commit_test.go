@@ -0,0 +1,102 @@
+package plumbing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+func TestSignatureRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		signature  string
+		wantName   string
+		wantEmail  string
+		wantUnix   int64
+		wantOffset int  // seconds east of UTC
+		undated    bool // no timestamp, When is zero
+	}{
+		{"utc", "A U Thor <author@example.com> 1700000000 +0000", "A U Thor", "author@example.com", 1700000000, 0, false},
+		{"east", "Jane <jane@example.com> 1700000000 +0530", "Jane", "jane@example.com", 1700000000, 5*3600 + 30*60, false},
+		{"west", "Joe <joe@example.com> 1700000000 -0800", "Joe", "joe@example.com", 1700000000, -8 * 3600, false},
+		{"negative zero", "Joe <joe@example.com> 1700000000 -0000", "Joe", "joe@example.com", 1700000000, 0, false},
+		{"name with angle bracket", "Mr <Angle> <mr@example.com> 1 +0100", "Mr <Angle>", "mr@example.com", 1, 3600, false},
+		{"odd spacing", "Spacey  <spacey@example.com>  1700000000   +0200", "Spacey", "spacey@example.com", 1700000000, 2 * 3600, false},
+		{"empty email", "Nobody <> 0 +0000", "Nobody", "", 0, 0, false},
+		{"no date", "Undated <undated@example.com>", "Undated", "undated@example.com", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := ParseSignature(tt.signature)
+			if a.Name != tt.wantName || a.Email != tt.wantEmail {
+				t.Errorf("ParseSignature(%q) = %q <%q>, want %q <%q>", tt.signature, a.Name, a.Email, tt.wantName, tt.wantEmail)
+			}
+			if tt.undated {
+				if !a.When.IsZero() {
+					t.Errorf("ParseSignature(%q) is dated %s, want no date", tt.signature, a.When)
+				}
+			} else if _, offset := a.When.Zone(); a.When.Unix() != tt.wantUnix || offset != tt.wantOffset {
+				t.Errorf("ParseSignature(%q) is dated %d %+d, want %d %+d", tt.signature, a.When.Unix(), offset, tt.wantUnix, tt.wantOffset)
+			}
+			if got := FormatSignature(a); got != tt.signature {
+				t.Errorf("FormatSignature(ParseSignature(%q)) = %q", tt.signature, got)
+			}
+		})
+	}
+}
+
+func TestFormatSignature(t *testing.T) {
+	when := time.Unix(1700000000, 0).In(time.FixedZone("", -(3*3600 + 30*60)))
+	parsed := ParseSignature("Old  Name <old@example.com>  1700000000 -0330")
+	renamed := parsed
+	renamed.Name = "New Name"
+
+	tests := []struct {
+		name      string
+		signature types.Author
+		want      string
+	}{
+		{"new signature", types.Author{Name: "A", Email: "a@example.com", When: when}, "A <a@example.com> 1700000000 -0330"},
+		{"without date", types.Author{Name: "A", Email: "a@example.com"}, "A <a@example.com>"},
+		{"unchanged parsed signature", parsed, "Old  Name <old@example.com>  1700000000 -0330"},
+		{"changed parsed signature", renamed, "New Name <old@example.com> 1700000000 -0330"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatSignature(tt.signature); got != tt.want {
+				t.Errorf("FormatSignature() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitRoundTrip(t *testing.T) {
+	tree := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"
+	parent := "parent 8ab686eafeb1f44702738c8b0f24f2567c36da6d\n"
+	author := "author A U Thor <author@example.com> 1700000000 +0200\n"
+	committer := "committer C O Mitter <committer@example.com> 1700000100 -0500\n"
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"root commit", tree + author + committer + "\nInitial commit\n"},
+		{"merge commit", tree + parent + "parent 2c26b46b68ffc68ff99b453c1d30413413422d70\n" + author + committer + "\nMerge branch 'topic'\n"},
+		{"encoding header", tree + parent + author + committer + "encoding ISO-8859-1\n\nMessage\n"},
+		{"signed commit", tree + parent + author + committer + "gpgsig -----BEGIN PGP SIGNATURE-----\n \n iQEzBAABCAAdFiEE\n -----END PGP SIGNATURE-----\n\nSigned\n"},
+		{"message with blank lines", tree + author + committer + "\nSubject\n\nBody line\n\nMore body\n"},
+		{"empty message", tree + author + committer + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commit, err := ParseCommit([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseCommit: %s", err)
+			}
+			if got := string(EncodeCommit(commit)); got != tt.data {
+				t.Errorf("EncodeCommit(ParseCommit(data)) =\n%q\nwant\n%q", got, tt.data)
+			}
+		})
+	}
+}
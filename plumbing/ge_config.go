@@ -0,0 +1,72 @@
+package plumbing
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// GetConfig returns the value of a "<section>.<name>" key from .git/config. Like git, section and key names are case-insensitive.
+func (r *Repository) GetConfig(key string) (string, error) {
+
+	// Load the config file
+	cfg, err := ini.LoadSources(ini.LoadOptions{Insensitive: true}, r.GitPath("config"))
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid config key: %s", key)
+	}
+
+	// Check val for specific key
+	section, name := parts[0], parts[1]
+	val := cfg.Section(section).Key(name).String()
+	if val == "" {
+		return "", fmt.Errorf("config key not found: %s", key)
+	}
+
+	return val, nil
+}
+
+// SetConfig sets the value of a "<section>.<name>" key in .git/config.
+func (r *Repository) SetConfig(key, value string) error {
+
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid config key: %s", key)
+	}
+
+	// .git/config file Path
+	cfgPath := r.GitPath("config")
+
+	// Take config.lock before loading, so that a concurrent change is refused rather than lost
+	lock, err := Lock(cfgPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+
+	// Load the config file
+	cfg, err := ini.Load(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	// Check val for specific key
+	section, name := parts[0], parts[1]
+	cfg.Section(section).Key(name).SetValue(value)
+
+	// Write through config.lock
+	var buf bytes.Buffer
+	if _, err := cfg.WriteTo(&buf); err != nil {
+		return err
+	}
+	if err := lock.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return lock.Commit()
+}
@@ -0,0 +1,496 @@
+package plumbing
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// CheckIndex verifies the index beyond what reading it checks (checksum, entry layout) : entries must be sorted without duplicates, have valid modes, not mix merged and unmerged stages for a path, and point to existing blobs, and the valid directories of the cache-tree must exist and hold the right number of entries. It returns the problems found, or an error when the index can't be read at all.
+func (r *Repository) CheckIndex() ([]string, error) {
+	index, err := r.ReadIndexFile()
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []string{}
+	for i, ie := range index.Entries {
+		if i > 0 {
+			prev := index.Entries[i-1]
+			switch {
+			case prev.Filename > ie.Filename || (prev.Filename == ie.Filename && prev.Stage() > ie.Stage()):
+				problems = append(problems, fmt.Sprintf("index entries out of order: %s (stage %d) after %s (stage %d)", ie.Filename, ie.Stage(), prev.Filename, prev.Stage()))
+			case prev.Filename == ie.Filename && prev.Stage() == ie.Stage():
+				problems = append(problems, fmt.Sprintf("duplicate index entry: %s (stage %d)", ie.Filename, ie.Stage()))
+			case prev.Filename == ie.Filename && prev.Stage() == 0:
+				problems = append(problems, fmt.Sprintf("index entry %s is both merged and unmerged", ie.Filename))
+			}
+		}
+
+		switch ie.Mode {
+		case constants.ModeFile, constants.ModeExec, constants.ModeSymlink:
+			if !r.Objects.Has(ie.SHA1) {
+				problems = append(problems, fmt.Sprintf("missing blob %x for index entry %s", ie.SHA1, ie.Filename))
+			}
+		case constants.ModeGitlink:
+			// Submodule commits live in another repository
+		default:
+			problems = append(problems, fmt.Sprintf("invalid mode %o for index entry %s", ie.Mode, ie.Filename))
+		}
+	}
+
+	if index.CacheTree != nil {
+		problems = append(problems, r.checkCacheTree(index.CacheTree, index.Entries, "")...)
+	}
+	return problems, nil
+}
+
+// checkCacheTree verifies a valid cache-tree directory and its subtrees against entries, the index entries below prefix.
+func (r *Repository) checkCacheTree(node *types.CacheTree, entries []types.IndexEntry, prefix string) []string {
+	problems := []string{}
+	name := strings.TrimSuffix(prefix, "/")
+	if name == "" {
+		name = "/"
+	}
+
+	if node.EntryCount >= 0 {
+		if node.EntryCount != len(entries) {
+			problems = append(problems, fmt.Sprintf("cache-tree %s has %d entries, the index %d", name, node.EntryCount, len(entries)))
+		}
+		if !r.Objects.Has(node.SHA) {
+			problems = append(problems, fmt.Sprintf("missing tree %x for cache-tree %s", node.SHA, name))
+		}
+	}
+
+	for _, sub := range node.Subtrees {
+		subPrefix := prefix + sub.Name + "/"
+		below := []types.IndexEntry{}
+		for _, ie := range entries {
+			if strings.HasPrefix(ie.Filename, subPrefix) {
+				below = append(below, ie)
+			}
+		}
+		problems = append(problems, r.checkCacheTree(sub, below, subPrefix)...)
+	}
+	return problems
+}
+
+// fsckLink is a reference from an object to another one, of the expected type.
+type fsckLink struct {
+	sha     [20]byte
+	objType types.ObjectType
+}
+
+// Fsck checks the whole repository : every object is rehashed against its name and checked for syntax (tree entries order and modes, commit and tag headers), HEAD, refs, reflogs and the index must point to existing objects, and every object reachable from them must exist. Objects which aren't reachable are reported as unreachable, and as dangling when no other object points to them.
+func (r *Repository) Fsck() (*types.FsckResult, error) {
+	result := &types.FsckResult{}
+	report := func(isError bool, format string, args ...any) {
+		result.Problems = append(result.Problems, types.FsckProblem{Error: isError, Text: fmt.Sprintf(format, args...)})
+	}
+
+	// Every object : its type, and the objects it points to
+	objTypes := map[[20]byte]types.ObjectType{}
+	links := map[[20]byte][]fsckLink{}
+	shas := [][20]byte{}
+	if err := r.Objects.Iterate(func(sha [20]byte) error {
+		shas = append(shas, sha)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(shas, func(i, j int) bool { return bytes.Compare(shas[i][:], shas[j][:]) < 0 })
+
+	for _, sha := range shas {
+		objType, content, err := r.Objects.Read(sha)
+		if err != nil {
+			report(true, "error: %x: object corrupt or missing: %s", sha, err)
+			continue
+		}
+		if actual, err := HashObject(objType, content); err != nil || actual != sha {
+			report(true, "error: %x: hash-path mismatch, found at: %x", actual, sha)
+			continue
+		}
+		objTypes[sha] = objType
+
+		switch objType {
+		case types.TreeObject:
+			objLinks, problems := checkTree(content)
+			links[sha] = objLinks
+			for _, p := range problems {
+				report(p.Error, "%s in tree %x: %s", severity(p.Error), sha, p.Text)
+			}
+		case types.CommitObject:
+			id, text := checkCommit(content)
+			if id != "" {
+				report(true, "error in commit %x: %s: %s", sha, id, text)
+			}
+			commit, err := ParseCommit(content)
+			if err != nil {
+				if id == "" {
+					report(true, "error: %x: object could not be parsed: %s", sha, err)
+				}
+				continue
+			}
+			links[sha] = append(links[sha], fsckLink{commit.TreeSHA, types.TreeObject})
+			for _, parent := range commit.ParentsSHA {
+				links[sha] = append(links[sha], fsckLink{parent, types.CommitObject})
+			}
+		case types.BlobObject:
+			// Any content is valid
+		case types.TagObject:
+			if id, text := checkTag(content); id != "" {
+				report(true, "error in tag %x: %s: %s", sha, id, text)
+			}
+			if tag, err := ParseTag(content); err == nil {
+				links[sha] = append(links[sha], fsckLink{tag.ObjectSHA, tag.ObjectType})
+			}
+		default:
+			report(true, "error: %x: unknown object type %s", sha, objType)
+		}
+	}
+
+	// Starting points : HEAD, refs, reflogs and the index
+	roots := [][20]byte{}
+	addRoot := func(name string, sha [20]byte) {
+		if _, ok := objTypes[sha]; ok {
+			roots = append(roots, sha)
+		} else {
+			report(true, "error: %s: invalid sha1 pointer %x", name, sha)
+		}
+	}
+
+	head, err := r.ReadHEADInfo()
+	switch {
+	case err != nil:
+		report(true, "error: HEAD: %s", err)
+	case head.Detached:
+		addRoot("HEAD", head.SHA)
+	case head.SHA == [20]byte{}:
+		report(false, "notice: HEAD points to an unborn branch (%s)", head.Branch)
+	}
+
+	refs, err := r.ListRefs()
+	if err != nil {
+		return nil, err
+	}
+	refNames := make([]string, 0, len(refs))
+	for name := range refs {
+		refNames = append(refNames, name)
+	}
+	sort.Strings(refNames)
+	for _, name := range refNames {
+		addRoot(name, refs[name])
+	}
+	for _, name := range r.invalidRefs() {
+		report(true, "error: %s: invalid sha1 pointer %x", name, [20]byte{})
+	}
+	for _, name := range r.symbolicRefs() {
+		if _, err := r.ResolveSymbolicRef(name); err != nil {
+			report(true, "error: %s: %s", name, err)
+		}
+	}
+
+	reflogs, err := r.ReflogNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range reflogs {
+		entries, err := r.ReadReflog(name)
+		if err != nil {
+			report(true, "error: %s: %s", name, err)
+			continue
+		}
+		for _, entry := range entries {
+			for _, sha := range [][20]byte{entry.Old, entry.New} {
+				if sha == ([20]byte{}) {
+					continue
+				}
+				if _, ok := objTypes[sha]; ok {
+					roots = append(roots, sha)
+				} else {
+					report(true, "error: %s: invalid reflog entry %x", name, sha)
+				}
+			}
+		}
+	}
+
+	index, err := r.ReadIndexFile()
+	if err != nil {
+		report(true, "error: %s", err)
+	} else {
+		problems, _ := r.CheckIndex()
+		for _, problem := range problems {
+			report(true, "error: %s", problem)
+		}
+		for _, ie := range index.Entries {
+			if _, ok := objTypes[ie.SHA1]; ok {
+				roots = append(roots, ie.SHA1)
+			}
+		}
+		for _, sha := range ValidCacheTrees(index.CacheTree) {
+			if _, ok := objTypes[sha]; ok {
+				roots = append(roots, sha)
+			}
+		}
+	}
+
+	// Walk everything reachable, every object met must exist
+	reachable := map[[20]byte]bool{}
+	missing := map[[20]byte]bool{}
+	stack := append([][20]byte{}, roots...)
+	for len(stack) > 0 {
+		sha := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reachable[sha] {
+			continue
+		}
+		reachable[sha] = true
+		for _, link := range links[sha] {
+			if _, ok := objTypes[link.sha]; ok {
+				stack = append(stack, link.sha)
+			} else if !missing[link.sha] {
+				missing[link.sha] = true
+				report(true, "missing %s %x", link.objType, link.sha)
+			}
+		}
+	}
+
+	// Objects no one can reach, dangling when no object points to them at all
+	pointedTo := map[[20]byte]bool{}
+	for _, objLinks := range links {
+		for _, link := range objLinks {
+			pointedTo[link.sha] = true
+		}
+	}
+	for _, sha := range shas {
+		objType, ok := objTypes[sha]
+		if !ok || reachable[sha] {
+			continue
+		}
+		info := types.ObjectInfo{SHA: sha, Type: objType}
+		result.Unreachable = append(result.Unreachable, info)
+		if !pointedTo[sha] {
+			result.Dangling = append(result.Dangling, info)
+		}
+	}
+	return result, nil
+}
+
+// severity names the level of a problem as fsck prints it.
+func severity(isError bool) string {
+	if isError {
+		return "error"
+	}
+	return "warning"
+}
+
+// checkTree parses a tree object and checks its entries : names, modes, order and duplicates. It returns the objects the entries point to (submodule commits excluded) and the problems found, each kind once.
+func checkTree(content []byte) ([]fsckLink, []types.FsckProblem) {
+	links := []fsckLink{}
+	found := map[string]bool{}
+	problems := []types.FsckProblem{}
+	add := func(isError bool, id, text string) {
+		if !found[id] {
+			found[id] = true
+			problems = append(problems, types.FsckProblem{Error: isError, Text: id + ": " + text})
+		}
+	}
+
+	prevKey, prevName := "", ""
+	for i := 0; i < len(content); {
+		nul := bytes.IndexByte(content[i:], 0)
+		space := bytes.IndexByte(content[i:], ' ')
+		if nul == -1 || space == -1 || space > nul || i+nul+21 > len(content) {
+			add(true, "badTree", "cannot be parsed as a tree")
+			return nil, problems
+		}
+		modeStr, name := string(content[i:i+space]), string(content[i+space+1:i+nul])
+		sha := [20]byte(content[i+nul+1 : i+nul+21])
+		i += nul + 21
+
+		// Names must be usable as a single path component
+		switch {
+		case name == "":
+			add(false, "emptyName", "contains empty pathname")
+		case name == ".":
+			add(false, "hasDot", "contains '.'")
+		case name == "..":
+			add(false, "hasDotdot", "contains '..'")
+		case strings.EqualFold(name, ".git"):
+			add(false, "hasDotgit", "contains '.git'")
+		case strings.Contains(name, "/"):
+			add(false, "fullPathname", "contains full pathnames")
+		}
+
+		// Modes, written without leading zeros
+		if strings.HasPrefix(modeStr, "0") {
+			add(false, "zeroPaddedFilemode", "contains zero-padded file modes")
+		}
+		mode, err := strconv.ParseUint(modeStr, 8, 32)
+		if err != nil {
+			add(true, "badTree", "cannot be parsed as a tree")
+			return nil, problems
+		}
+		objType := types.BlobObject
+		switch uint32(mode) {
+		case constants.ModeFile, constants.ModeExec, constants.ModeSymlink, 0100664:
+		case constants.ModeTree:
+			objType = types.TreeObject
+		case constants.ModeGitlink:
+			objType = ""
+		default:
+			add(false, "badFilemode", "contains bad file modes")
+		}
+		if objType != "" {
+			links = append(links, fsckLink{sha, objType})
+		}
+
+		// Entries are sorted like git, directories as if their name ended with "/"
+		key := name
+		if objType == types.TreeObject {
+			key += "/"
+		}
+		if prevName != "" || prevKey != "" {
+			if name == prevName {
+				add(true, "duplicateEntries", "contains duplicate file entries")
+			} else if key < prevKey {
+				add(true, "treeNotSorted", "not properly sorted")
+			}
+		}
+		prevKey, prevName = key, name
+	}
+	return links, problems
+}
+
+// checkCommit checks the headers of a commit object : tree, parents, author and committer, in this order. It returns the id and description of the first problem, if any.
+func checkCommit(content []byte) (string, string) {
+	header, _, _ := strings.Cut(string(content), "\n\n")
+	lines := strings.Split(header, "\n")
+
+	// Tree
+	value, ok := strings.CutPrefix(lines[0], "tree ")
+	if !ok {
+		return "missingTree", "invalid format - expected 'tree' line"
+	}
+	if !isHexSHA(value) {
+		return "badTreeSha1", "invalid 'tree' line format - bad sha1"
+	}
+	lines = lines[1:]
+
+	// Parents
+	for len(lines) > 0 && strings.HasPrefix(lines[0], "parent ") {
+		if !isHexSHA(strings.TrimPrefix(lines[0], "parent ")) {
+			return "badParentSha1", "invalid 'parent' line format - bad sha1"
+		}
+		lines = lines[1:]
+	}
+
+	// Author, then committer
+	for _, key := range []string{"author", "committer"} {
+		if len(lines) == 0 || !strings.HasPrefix(lines[0], key+" ") {
+			return "missing" + strings.ToUpper(key[:1]) + key[1:], "invalid format - expected '" + key + "' line"
+		}
+		if id, text := checkIdent(strings.TrimPrefix(lines[0], key+" ")); id != "" {
+			return id, text
+		}
+		lines = lines[1:]
+	}
+	return "", ""
+}
+
+// checkTag checks the headers of a tag object : object, type, tag and the optional tagger. It returns the id and description of the first problem, if any.
+func checkTag(content []byte) (string, string) {
+	header, _, _ := strings.Cut(string(content), "\n\n")
+	lines := strings.Split(header, "\n")
+
+	value, ok := strings.CutPrefix(lines[0], "object ")
+	if !ok {
+		return "missingObject", "invalid format - expected 'object' line"
+	}
+	if !isHexSHA(value) {
+		return "badObjectSha1", "invalid 'object' line format - bad sha1"
+	}
+	if len(lines) < 2 || !strings.HasPrefix(lines[1], "type ") {
+		return "missingTypeEntry", "invalid format - expected 'type' line"
+	}
+	switch types.ObjectType(strings.TrimPrefix(lines[1], "type ")) {
+	case types.BlobObject, types.TreeObject, types.CommitObject, types.TagObject:
+	default:
+		return "badType", "invalid 'type' value"
+	}
+	if len(lines) < 3 || !strings.HasPrefix(lines[2], "tag ") {
+		return "missingTagEntry", "invalid format - expected 'tag' line"
+	}
+	if len(lines) > 3 && strings.HasPrefix(lines[3], "tagger ") {
+		return checkIdent(strings.TrimPrefix(lines[3], "tagger "))
+	}
+	return "", ""
+}
+
+// checkIdent checks an author, committer or tagger line value : "<name> <<email>> <timestamp> <timezone>". It returns the id and description of the first problem, if any.
+func checkIdent(ident string) (string, string) {
+	const prefix = "invalid author/committer line - "
+
+	lt := strings.IndexByte(ident, '<')
+	switch {
+	case lt == -1:
+		return "missingEmail", prefix + "missing email"
+	case strings.ContainsRune(ident[:lt], '>'):
+		return "badName", prefix + "bad name"
+	case lt == 0 || ident[lt-1] != ' ':
+		return "missingSpaceBeforeEmail", prefix + "missing space before email"
+	}
+	gt := strings.IndexByte(ident[lt+1:], '>')
+	if gt == -1 || strings.ContainsRune(ident[lt+1:lt+1+gt], '<') {
+		return "badEmail", prefix + "bad email"
+	}
+	rest := ident[lt+1+gt+1:]
+	if !strings.HasPrefix(rest, " ") {
+		return "missingSpaceBeforeDate", prefix + "missing space before date"
+	}
+
+	date, tz, _ := strings.Cut(rest[1:], " ")
+	if date == "" || strings.Trim(date, "0123456789") != "" {
+		return "badDate", prefix + "bad date"
+	}
+	if len(date) > 1 && date[0] == '0' {
+		return "zeroPaddedDate", prefix + "zero-padded date"
+	}
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') || strings.Trim(tz[1:], "0123456789") != "" {
+		return "badTimezone", prefix + "bad time zone"
+	}
+	return "", ""
+}
+
+// isHexSHA reports whether s is a full lowercase hex SHA.
+func isHexSHA(s string) bool {
+	return len(s) == 40 && strings.Trim(s, "0123456789abcdef") == ""
+}
+
+// invalidRefs returns the names of the files under .git/refs which don't hold a SHA.
+func (r *Repository) invalidRefs() []string {
+	invalid := []string{}
+	_ = filepath.WalkDir(r.GitPath("refs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || isHexSHA(strings.TrimSpace(string(data))) || strings.HasPrefix(string(data), "ref: ") {
+			return nil
+		}
+		if rel, err := filepath.Rel(r.GitDir, path); err == nil {
+			invalid = append(invalid, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(invalid)
+	return invalid
+}
@@ -0,0 +1,320 @@
+package plumbing
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreRule is a single pattern from a gitignore-style file, along with where it came from.
+type IgnoreRule struct {
+	Source  string // file the pattern was read from, e.g. ".gitignore", "src/.gitignore" or ".git/info/exclude"
+	Line    int    // 1-based line number in Source
+	Pattern string // pattern as written in the file
+
+	baseDir  string         // directory the pattern is relative to ("" for the root)
+	negate   bool           // "!" prefix : re-include paths excluded by a previous pattern
+	dirOnly  bool           // trailing "/" : only matches directories
+	anchored bool           // pattern contains a "/" : matched against the path relative to baseDir instead of the basename
+	re       *regexp.Regexp // compiled pattern
+}
+
+// IgnoreMatcher decides whether working tree paths are ignored. Patterns come from (highest precedence first) the .gitignore files in the path's directory and its parents, .git/info/exclude, then core.excludesFile.
+type IgnoreMatcher struct {
+	repo     *Repository
+	perDir   map[string][]*IgnoreRule // cache of parsed .gitignore files, keyed by directory
+	excludes []*IgnoreRule            // .git/info/exclude
+	global   []*IgnoreRule            // core.excludesFile
+}
+
+// NewIgnoreMatcher loads .git/info/exclude and core.excludesFile. .gitignore files in the working tree are loaded lazily as directories are visited.
+func (r *Repository) NewIgnoreMatcher() (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{
+		repo:   r,
+		perDir: map[string][]*IgnoreRule{},
+	}
+
+	// .git/info/exclude
+	excludes, err := readIgnoreFile(r.GitPath("info", "exclude"), filepath.ToSlash(filepath.Join(".git", "info", "exclude")), "")
+	if err != nil {
+		return nil, err
+	}
+	m.excludes = excludes
+
+	// core.excludesFile, defaulting to $XDG_CONFIG_HOME/git/ignore (or ~/.config/git/ignore)
+	excludesFile, err := r.GetConfig("core.excludesFile")
+	if err != nil {
+		excludesFile = ""
+		if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+			excludesFile = filepath.Join(xdg, "git", "ignore")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			excludesFile = filepath.Join(home, ".config", "git", "ignore")
+		}
+	} else if rest, ok := strings.CutPrefix(excludesFile, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			excludesFile = filepath.Join(home, rest)
+		}
+	}
+	if excludesFile != "" {
+		global, err := readIgnoreFile(excludesFile, excludesFile, "")
+		if err != nil {
+			return nil, err
+		}
+		m.global = global
+	}
+	return m, nil
+}
+
+// dirRules returns the parsed .gitignore of a working tree directory ("" for the root).
+func (m *IgnoreMatcher) dirRules(dir string) []*IgnoreRule {
+	if rules, ok := m.perDir[dir]; ok {
+		return rules
+	}
+
+	source := ".gitignore"
+	if dir != "" {
+		source = dir + "/.gitignore"
+	}
+
+	// Unreadable .gitignore files are treated as empty, like git does
+	rules, err := readIgnoreFile(m.repo.WorkPath(source), source, dir)
+	if err != nil {
+		rules = nil
+	}
+	m.perDir[dir] = rules
+	return rules
+}
+
+// MatchSelf returns the rule deciding whether path (relative to the working tree root) is ignored, looking at path itself only, without considering its parent directories. The rule may be a negation, in which case the path is explicitly NOT ignored. Returns nil if no pattern matches.
+func (m *IgnoreMatcher) MatchSelf(path string, isDir bool) *IgnoreRule {
+
+	// .gitignore files from the path's own directory up to the root, the closest one wins
+	dir := parentDir(path)
+	for {
+		if rule := lastMatch(m.dirRules(dir), path, isDir); rule != nil {
+			return rule
+		}
+		if dir == "" {
+			break
+		}
+		dir = parentDir(dir)
+	}
+
+	// Then .git/info/exclude, then core.excludesFile
+	if rule := lastMatch(m.excludes, path, isDir); rule != nil {
+		return rule
+	}
+	return lastMatch(m.global, path, isDir)
+}
+
+// Match returns the rule that decides whether path is ignored, and whether it is. A path is also ignored when one of its parent directories is, since git never looks inside an excluded directory.
+func (m *IgnoreMatcher) Match(path string, isDir bool) (*IgnoreRule, bool) {
+
+	// Check parent directories first, from the root down
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		if rule := m.MatchSelf(strings.Join(parts[:i], "/"), true); rule != nil && !rule.negate {
+			return rule, true
+		}
+	}
+
+	rule := m.MatchSelf(path, isDir)
+	return rule, rule != nil && !rule.negate
+}
+
+// IsIgnored reports whether path (relative to the working tree root) is ignored.
+func (m *IgnoreMatcher) IsIgnored(path string, isDir bool) bool {
+	_, ignored := m.Match(path, isDir)
+	return ignored
+}
+
+// lastMatch returns the last rule in the list matching path : later patterns override earlier ones.
+func lastMatch(rules []*IgnoreRule, path string, isDir bool) *IgnoreRule {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matches(path, isDir) {
+			return rules[i]
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule's pattern matches path (relative to the working tree root).
+func (rule *IgnoreRule) matches(path string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+
+	// Patterns only apply below the directory of their .gitignore
+	rel := path
+	if rule.baseDir != "" {
+		var ok bool
+		rel, ok = strings.CutPrefix(path, rule.baseDir+"/")
+		if !ok {
+			return false
+		}
+	}
+
+	if rule.anchored {
+		return rule.re.MatchString(rel)
+	}
+	return rule.re.MatchString(path[strings.LastIndex(path, "/")+1:])
+}
+
+// readIgnoreFile parses a gitignore-style file. A missing file yields no rules.
+func readIgnoreFile(filePath, source, baseDir string) ([]*IgnoreRule, error) {
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules := []*IgnoreRule{}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if rule := ParseIgnorePattern(scanner.Text(), baseDir); rule != nil {
+			rule.Source = source
+			rule.Line = lineNo
+			rules = append(rules, rule)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// ParseIgnorePattern parses one line of a gitignore file, relative to baseDir ("" for the root). Returns nil for blank lines, comments and invalid patterns.
+func ParseIgnorePattern(line, baseDir string) *IgnoreRule {
+	original := strings.TrimSuffix(line, "\r")
+	pattern := trimIgnoreTrailingSpaces(original)
+
+	// Blank lines and comments ("\#" escapes a leading hash)
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return nil
+	}
+
+	rule := &IgnoreRule{Pattern: pattern, baseDir: baseDir}
+
+	// "!" negates, "\!" is a literal exclamation mark
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+
+	// Trailing "/" only matches directories
+	if strings.HasSuffix(pattern, "/") && !strings.HasSuffix(pattern, "\\/") {
+		rule.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	if pattern == "" {
+		return nil
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern to baseDir
+	if strings.Contains(pattern, "/") {
+		rule.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+
+	expr, ok := ignorePatternToRegexp(pattern)
+	if !ok {
+		return nil
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return nil
+	}
+	rule.re = re
+	return rule
+}
+
+// trimIgnoreTrailingSpaces removes trailing spaces unless they are escaped with a backslash.
+func trimIgnoreTrailingSpaces(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\\ ") {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// ignorePatternToRegexp translates gitignore glob syntax (*, ?, [...], **) into a regular expression. Reports false for a pattern which can never match, like git's for an unterminated character class.
+func ignorePatternToRegexp(pattern string) (string, bool) {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**") {
+				atStart := i == 0 || pattern[i-1] == '/'
+				rest := pattern[i+2:]
+				switch {
+				case atStart && rest == "":
+					// "/**" at the end : everything inside
+					sb.WriteString(".*")
+					i++
+					continue
+				case atStart && strings.HasPrefix(rest, "/"):
+					// "**/" : zero or more directories
+					sb.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+			}
+			// Any other run of asterisks matches within a single path component
+			for i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+			}
+			sb.WriteString("[^/]*")
+
+		case '?':
+			sb.WriteString("[^/]")
+
+		case '[':
+			// Character class, "!" or "^" negates
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == 0 && i+2 < len(pattern) {
+				// "]" right after "[" is part of the class
+				if next := strings.IndexByte(pattern[i+2:], ']'); next != -1 {
+					end = next + 1
+				} else {
+					end = -1
+				}
+			}
+			if end == -1 {
+				return "", false
+			}
+			class := pattern[i+1 : i+1+end]
+			sb.WriteByte('[')
+			if strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^") {
+				sb.WriteByte('^')
+				class = class[1:]
+			}
+			sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(class, "\\", "\\\\"), "[", "\\["))
+			sb.WriteByte(']')
+			i += end + 1
+
+		case '\\':
+			// Escaped character is taken literally
+			if i+1 < len(pattern) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String(), true
+}
+
+// parentDir returns the parent of a working tree path, "" for top-level entries.
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
@@ -0,0 +1,137 @@
+package plumbing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnorePatternMatching(t *testing.T) {
+	tests := []struct {
+		pattern string
+		baseDir string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		// Basename patterns match at any depth
+		{"*.log", "", "debug.log", false, true},
+		{"*.log", "", "logs/debug.log", false, true},
+		{"*.log", "", "debug.log.txt", false, false},
+		{"build", "", "src/build", true, true},
+
+		// "?" and classes match a single character, never "/"
+		{"file?.txt", "", "file1.txt", false, true},
+		{"file?.txt", "", "file10.txt", false, false},
+		{"file[0-9].txt", "", "file7.txt", false, true},
+		{"file[!0-9].txt", "", "file7.txt", false, false},
+		{"file[!0-9].txt", "", "filex.txt", false, true},
+		{"[]]", "", "]", false, true},
+
+		// A slash anchors the pattern to its directory
+		{"/todo", "", "todo", false, true},
+		{"/todo", "", "docs/todo", false, false},
+		{"doc/*.txt", "", "doc/notes.txt", false, true},
+		{"doc/*.txt", "", "doc/api/notes.txt", false, false},
+
+		// Trailing slash only matches directories
+		{"out/", "", "out", true, true},
+		{"out/", "", "out", false, false},
+
+		// "**" spans directories
+		{"**/cache", "", "cache", true, true},
+		{"**/cache", "", "a/b/cache", true, true},
+		{"logs/**", "", "logs/2024/01.log", false, true},
+		{"a/**/z", "", "a/z", false, true},
+		{"a/**/z", "", "a/b/c/z", false, true},
+		{"a/**/z", "", "b/a/z", false, false},
+
+		// Escapes and trailing spaces
+		{"\\#notes", "", "#notes", false, true},
+		{"\\!important", "", "!important", false, true},
+		{"trailing  ", "", "trailing", false, true},
+		{"escaped\\ ", "", "escaped ", false, true},
+
+		// Patterns of a nested .gitignore only apply below its directory
+		{"*.o", "src", "src/main.o", false, true},
+		{"*.o", "src", "main.o", false, false},
+		{"/gen", "src", "src/gen", true, true},
+		{"/gen", "src", "gen", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			rule := ParseIgnorePattern(tt.pattern, tt.baseDir)
+			if rule == nil {
+				t.Fatalf("ParseIgnorePattern(%q) = nil", tt.pattern)
+			}
+			if got := rule.matches(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("pattern %q in %q matching %q (dir %v) = %v, want %v", tt.pattern, tt.baseDir, tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIgnorePatternSkipsLinesWithoutPattern(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "/", "!", "\r", "a[b", "[]"} {
+		if rule := ParseIgnorePattern(line, ""); rule != nil {
+			t.Errorf("ParseIgnorePattern(%q) = %+v, want nil", line, rule)
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	repo := newTestRepository(t)
+	files := map[string]string{
+		".gitignore":         "*.log\n!keep.log\nbuild/\nsecret/\n!secret/public.txt\n",
+		"src/.gitignore":     "*.tmp\n!debug.log\n",
+		".git/info/exclude":  "local.txt\n*.tmp\n",
+		"src/nested/.keep":   "",
+		"secret/public.txt":  "",
+		"build/output.bin":   "",
+		"src/debug.log":      "",
+		"src/nested/app.tmp": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(repo.WorkTree, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matcher, err := repo.NewIgnoreMatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"error.log", false, true},
+		{"keep.log", false, false},             // negated later in the same file
+		{"src/debug.log", false, false},        // negated by the closer .gitignore
+		{"src/other.log", false, true},         // root .gitignore applies below
+		{"src/nested/app.tmp", false, true},    // parent .gitignore
+		{"app.tmp", false, true},               // .git/info/exclude
+		{"local.txt", false, true},             // .git/info/exclude
+		{"build", true, true},                  // directory only pattern
+		{"build", false, false},                // a file named like it
+		{"build/output.bin", false, true},      // inside an ignored directory
+		{"secret/public.txt", false, true},     // can't be re-included inside an ignored directory
+		{"src/main.go", false, false},          // no pattern at all
+		{"src/nested", true, false},            // directory without a pattern
+		{"notes/build/file.txt", false, true},  // ignored directory at any depth
+		{"notes/build.txt/file", false, false}, // a name only starting like it
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := matcher.IsIgnored(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("IsIgnored(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
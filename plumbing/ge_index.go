@@ -7,19 +7,28 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
-	"syscall"
+	"strconv"
 
-	"github.com/brickster241/GitEngine/utils/constants"
 	"github.com/brickster241/GitEngine/utils/types"
 )
 
 // LoadIndex reads the index file and returns the list of IndexEntry.
-func LoadIndex() ([]types.IndexEntry, error) {
+func (r *Repository) LoadIndex() ([]types.IndexEntry, error) {
+	index, err := r.ReadIndexFile()
+	if err != nil {
+		return nil, err
+	}
+	return index.Entries, nil
+}
+
+// ReadIndexFile reads the index file (versions 2 to 4) : its entries and extensions.
+func (r *Repository) ReadIndexFile() (*types.Index, error) {
 
-	indexPath := filepath.Join(".git", "index")
+	indexPath := r.GitPath("index")
 	if _, err := os.Stat(indexPath); errors.Is(err, os.ErrNotExist) {
-		return []types.IndexEntry{}, nil // No index file yet
+		return &types.Index{Entries: []types.IndexEntry{}}, nil // No index file yet
 	}
 
 	// Read the entire index file
@@ -39,22 +48,32 @@ func LoadIndex() ([]types.IndexEntry, error) {
 	}
 
 	version := binary.BigEndian.Uint32(data[4:8])
-	if version != 2 {
+	if version < 2 || version > 4 {
 		return nil, fmt.Errorf("unsupported index version: %d", version)
 	}
 
 	entryCount := binary.BigEndian.Uint32(data[8:12])
 
+	// Verify the trailing checksum, unless it was skipped when writing (index.skipHash leaves it null)
+	trailer := [20]byte(data[len(data)-20:])
+	if sum := sha1.Sum(data[:len(data)-20]); trailer != ([20]byte{}) && trailer != sum {
+		return nil, fmt.Errorf("index file corrupt: bad checksum at offset %d (expected %x, found %x)", len(data)-20, sum, trailer)
+	}
+
 	// Parse entries
 	content := data[:len(data)-20]
 	entries := make([]types.IndexEntry, 0, entryCount)
 	offset := 12
+	previousName := ""
 
 	// Loop through entries
 	for i := uint32(0); i < entryCount; i++ {
 		entryStart := offset // Track where this entry starts
+		corrupt := func(reason string) error {
+			return fmt.Errorf("index file corrupt: entry %d at offset %d: %s", i, entryStart, reason)
+		}
 		if offset+62 > len(content) {
-			return nil, fmt.Errorf("corrupt index entry")
+			return nil, corrupt("truncated entry")
 		}
 
 		// Read fixed-size fields
@@ -87,47 +106,161 @@ func LoadIndex() ([]types.IndexEntry, error) {
 		ie.Flags = binary.BigEndian.Uint16(content[offset:])
 		offset += 2
 
+		// Version 3 entries may carry a second flags field
+		if ie.Flags&types.IndexFlagExtended != 0 {
+			if version == 2 || offset+2 > len(content) {
+				return nil, corrupt("unexpected extended flags")
+			}
+			ie.ExtendedFlags = binary.BigEndian.Uint16(content[offset:])
+			offset += 2
+		}
+
+		// Version 4 paths only store what differs from the previous path : how many bytes to drop from its end, then what to append
+		prefix := ""
+		if version == 4 {
+			strip, n := readOffsetVarint(content[offset:])
+			if n == 0 || strip > len(previousName) {
+				return nil, corrupt("invalid path prefix")
+			}
+			offset += n
+			prefix = previousName[:len(previousName)-strip]
+		}
+
 		start := offset
 		for offset < len(content) && content[offset] != 0 {
 			offset++
 		}
 		if offset >= len(content) {
-			return nil, fmt.Errorf("unterminated filename in index")
+			return nil, corrupt("unterminated filename")
 		}
 
-		ie.Filename = string(content[start:offset])
-		offset++ // Skip null terminator
+		ie.Filename = prefix + string(content[start:offset])
 
-		// Align to next multiple of 8 bytes FROM THE ENTRY START
-		entryLen := offset - entryStart
-		for (entryLen % 8) != 0 {
-			offset++
-			entryLen++
+		// The name length in the flags is capped, but must match shorter names
+		if nameLen := int(ie.Flags & types.IndexFlagNameLength); nameLen != types.IndexFlagNameLength && nameLen != len(ie.Filename) {
+			return nil, corrupt(fmt.Sprintf("name length %d does not match filename %q", nameLen, ie.Filename))
+		}
+		offset++ // Skip null terminator
+		previousName = ie.Filename
+
+		// Align to next multiple of 8 bytes FROM THE ENTRY START, version 4 entries are not padded
+		if version != 4 {
+			entryLen := offset - entryStart
+			for (entryLen % 8) != 0 {
+				offset++
+				entryLen++
+			}
 		}
 
 		// Append entry to list
 		entries = append(entries, ie)
 	}
 
-	return entries, nil
+	// Extensions follow the entries : a 4-byte signature, a 32-bit size and the data
+	index := &types.Index{Entries: entries}
+	for offset < len(content) {
+		if offset+8 > len(content) {
+			return nil, fmt.Errorf("index file corrupt: truncated extension at offset %d", offset)
+		}
+		signature := string(content[offset : offset+4])
+		size := int(binary.BigEndian.Uint32(content[offset+4:]))
+		offset += 8
+		if size > len(content)-offset {
+			return nil, fmt.Errorf("index file corrupt: extension %s at offset %d is truncated", signature, offset-8)
+		}
+		data := content[offset : offset+size]
+		offset += size
+
+		switch {
+		case signature == "TREE":
+			cacheTree, err := parseCacheTree(data)
+			if err != nil {
+				return nil, err
+			}
+			index.CacheTree = cacheTree
+		case signature == "EOIE" || signature == "IEOT":
+			// Offsets into the file as it was written, dropped
+		case signature[0] < 'A' || signature[0] > 'Z':
+			// Extensions which don't start with an uppercase letter can't be ignored
+			return nil, fmt.Errorf("unsupported index extension: %s", signature)
+		default:
+			index.Extensions = append(index.Extensions, types.IndexExtension{Signature: signature, Data: slices.Clone(data)})
+		}
+	}
+
+	return index, nil
+}
+
+// LockIndex takes index.lock, to be held from reading the index until it is written back, so that a concurrent update is refused rather than lost (like git's hold_locked_index). The lock is released by the write (WriteIndex, WriteIndexFile), or by Rollback.
+func (r *Repository) LockIndex() (*LockFile, error) {
+	return Lock(r.GitPath("index"))
+}
+
+// WriteIndex writes entries back to .git/index through lock (see LockIndex), keeping the extensions of the current index : the cache-tree is invalidated for the paths which changed, and the extensions describing the entries themselves (fsmonitor, untracked cache) are dropped if any did.
+func (r *Repository) WriteIndex(lock *LockFile, entries []types.IndexEntry) error {
+	index := &types.Index{}
+	if current, err := r.ReadIndexFile(); err == nil {
+		index = current
+	}
+
+	changed := changedIndexPaths(index.Entries, entries)
+	for _, path := range changed {
+		invalidateCacheTree(index.CacheTree, path)
+	}
+	if len(changed) > 0 {
+		index.Extensions = slices.DeleteFunc(index.Extensions, func(ext types.IndexExtension) bool {
+			return ext.Signature == "FSMN" || ext.Signature == "UNTR"
+		})
+	}
+
+	index.Entries = entries
+	return r.WriteIndexFile(lock, index)
+}
+
+// ResetIndexToTree replaces the index with the files of a tree through lock (see LockIndex), without stat data (like read-tree). It doesn't need the current index to be readable, which makes it the way to recover from a corrupt one.
+func (r *Repository) ResetIndexToTree(lock *LockFile, treeSHA [20]byte) error {
+	files, err := r.TreeFiles(treeSHA)
+	if err != nil {
+		lock.Rollback()
+		return err
+	}
+	entries := make([]types.IndexEntry, 0, len(files))
+	for path, te := range files {
+		entries = append(entries, types.IndexEntry{Filename: path, SHA1: te.SHA, Mode: te.Mode})
+	}
+	return r.WriteIndex(lock, entries)
 }
 
-// WriteIndex writes entries back to .git/index (handles adding each entry + checksum)
-func WriteIndex(entries []types.IndexEntry) error {
+// WriteIndexFile writes .git/index through lock (see LockIndex) : the entries, then the extensions (handles adding each entry + checksum).
+func (r *Repository) WriteIndexFile(lock *LockFile, index *types.Index) error {
+	entries := index.Entries
 
-	// Sort based on filename lexicographically
+	// Sort based on filename lexicographically, then on stage for unmerged paths
 	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Filename < entries[j].Filename
+		if entries[i].Filename != entries[j].Filename {
+			return entries[i].Filename < entries[j].Filename
+		}
+		return entries[i].Stage() < entries[j].Stage()
 	})
 
+	// Version from index.version, 2 being upgraded to 3 when some entry has extended flags
+	version, _ := r.IndexVersion()
+	for _, entry := range entries {
+		if entry.ExtendedFlags != 0 && version == 2 {
+			version = 3
+			break
+		}
+	}
+
 	var buffer []byte
 
-	// 12-byte header: "DIRC" + version(2) + entry count
+	// 12-byte header: "DIRC" + version + entry count
 	buffer = append(buffer, []byte("DIRC")...)
-	buffer = binary.BigEndian.AppendUint32(buffer, 2)                    // version 2
+	buffer = binary.BigEndian.AppendUint32(buffer, version)              // version 2, 3 or 4
 	buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(entries))) // entry count
 
 	// Add each index entry
+	previousName := ""
 	for _, entry := range entries {
 
 		entryStart := len(buffer)
@@ -156,8 +289,28 @@ func WriteIndex(entries []types.IndexEntry) error {
 			nameLen = 0xFFF
 		}
 
-		// Write the (possibly capped) length to flags field
-		buffer = binary.BigEndian.AppendUint16(buffer, uint16(nameLen))
+		// Write the (possibly capped) length to flags field, along with the assume-valid and stage bits, then the extended flags if any
+		flags := uint16(nameLen) | entry.Flags&(types.IndexFlagAssumeValid|types.IndexFlagStage)
+		if entry.ExtendedFlags != 0 {
+			flags |= types.IndexFlagExtended
+		}
+		buffer = binary.BigEndian.AppendUint16(buffer, flags)
+		if entry.ExtendedFlags != 0 {
+			buffer = binary.BigEndian.AppendUint16(buffer, entry.ExtendedFlags)
+		}
+
+		// Version 4 : only write what differs from the previous filename, without padding
+		if version == 4 {
+			common := 0
+			for common < len(previousName) && common < len(entry.Filename) && previousName[common] == entry.Filename[common] {
+				common++
+			}
+			buffer = appendOffsetVarint(buffer, len(previousName)-common)
+			buffer = append(buffer, entry.Filename[common:]...)
+			buffer = append(buffer, 0x00)
+			previousName = entry.Filename
+			continue
+		}
 
 		// Write the FULL filename (not truncated!)
 		buffer = append(buffer, []byte(entry.Filename)...)
@@ -171,34 +324,156 @@ func WriteIndex(entries []types.IndexEntry) error {
 		buffer = append(buffer, make([]byte, padLen)...)
 	}
 
-	// 20-byte SHA-1 checksum of all previous contents
-	hash := sha1.Sum(buffer)
+	// Extensions : the cache-tree first, then the others as they were read
+	if index.CacheTree != nil {
+		buffer = appendIndexExtension(buffer, "TREE", encodeCacheTree(index.CacheTree))
+	}
+	for _, ext := range index.Extensions {
+		buffer = appendIndexExtension(buffer, ext.Signature, ext.Data)
+	}
+
+	// 20-byte SHA-1 checksum of all previous contents, left null with index.skipHash
+	hash := [20]byte{}
+	if val, err := r.GetConfig("index.skipHash"); err != nil || val != "true" {
+		hash = sha1.Sum(buffer)
+	}
 	buffer = append(buffer, hash[:]...)
 
 	// Write updated index file
-	if err := os.WriteFile(filepath.Join(".git", "index"), buffer, constants.DefaultFilePerm); err != nil {
+	if err := lock.Write(buffer); err != nil {
+		lock.Rollback()
 		return err
 	}
-	return nil
+	return lock.Commit()
+}
+
+// appendIndexExtension appends an extension to the index file : signature, size and data.
+func appendIndexExtension(buffer []byte, signature string, data []byte) []byte {
+	buffer = append(buffer, signature...)
+	buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(data)))
+	return append(buffer, data...)
+}
+
+// changedIndexPaths returns the paths whose entries (content, mode or stages) differ between two versions of the index, including added and removed paths.
+func changedIndexPaths(before, after []types.IndexEntry) []string {
+	type entryKey struct {
+		path  string
+		stage int
+	}
+	type entryValue struct {
+		sha  [20]byte
+		mode uint32
+	}
+	beforeMap := map[entryKey]entryValue{}
+	for _, ie := range before {
+		beforeMap[entryKey{ie.Filename, ie.Stage()}] = entryValue{ie.SHA1, ie.Mode}
+	}
+
+	changed := map[string]bool{}
+	for _, ie := range after {
+		key := entryKey{ie.Filename, ie.Stage()}
+		if value, ok := beforeMap[key]; !ok || value != (entryValue{ie.SHA1, ie.Mode}) {
+			changed[ie.Filename] = true
+		}
+		delete(beforeMap, key)
+	}
+	for key := range beforeMap {
+		changed[key.path] = true
+	}
+
+	paths := make([]string, 0, len(changed))
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// IndexVersion returns the index format version to write : index.version from .git/config (2, 3 or 4), 2 by default. An invalid value gives version 2 along with an error, for the caller to warn about.
+func (r *Repository) IndexVersion() (uint32, error) {
+	val, err := r.GetConfig("index.version")
+	if err != nil {
+		return 2, nil
+	}
+	version, err := strconv.Atoi(val)
+	if err != nil || version < 2 || version > 4 {
+		return 2, fmt.Errorf("index.version set, but the value is invalid")
+	}
+	return uint32(version), nil
+}
+
+// readOffsetVarint decodes a variable-length integer in git's offset encoding (7 bits per byte, most significant first, with an implicit +1 per continuation byte). It returns the value and the number of bytes read, 0 when data is truncated.
+func readOffsetVarint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	c := data[0]
+	value, n := int(c&0x7f), 1
+	for c&0x80 != 0 {
+		if n >= len(data) {
+			return 0, 0
+		}
+		c = data[n]
+		n++
+		value = ((value + 1) << 7) | int(c&0x7f)
+	}
+	return value, n
 }
 
-// IndexToMap converts entries to map for fast lookup
+// appendOffsetVarint appends value in git's offset encoding (see readOffsetVarint).
+func appendOffsetVarint(out []byte, value int) []byte {
+	enc := []byte{byte(value & 0x7f)}
+	for value >>= 7; value > 0; value >>= 7 {
+		value--
+		enc = append([]byte{0x80 | byte(value&0x7f)}, enc...)
+	}
+	return append(out, enc...)
+}
+
+// IndexToMap converts entries to map for fast lookup. An unmerged path maps to its lowest stage entry, so a non-zero Stage tells it apart (see IndexFromMap).
 func IndexToMap(entries []types.IndexEntry) map[string]types.IndexEntry {
 	indexMap := map[string]types.IndexEntry{}
 	for _, e := range entries {
-		indexMap[e.Filename] = e
+		if existing, ok := indexMap[e.Filename]; !ok || e.Stage() < existing.Stage() {
+			indexMap[e.Filename] = e
+		}
 	}
 	return indexMap
 }
 
-// GetIndexEntryFromStat creates a fully populated index entry from the current filesystem state of the given path.
-func GetIndexEntryFromStat(path string, sha1sum [20]byte) (types.IndexEntry, error) {
+// IndexFromMap converts a map built by IndexToMap back to entries. Paths still mapping to an unmerged entry get all their stages back from entries, the original index.
+func IndexFromMap(indexMap map[string]types.IndexEntry, entries []types.IndexEntry) []types.IndexEntry {
+	updated := make([]types.IndexEntry, 0, len(indexMap))
+	for _, e := range indexMap {
+		if e.Stage() == 0 {
+			updated = append(updated, e)
+		}
+	}
+	for _, e := range entries {
+		if mapped, ok := indexMap[e.Filename]; ok && mapped.Stage() != 0 {
+			updated = append(updated, e)
+		}
+	}
+	return updated
+}
 
-	// Get file info
-	info, err := os.Stat(path)
-	if err != nil {
-		return types.IndexEntry{}, err
+// UnmergedPaths returns the paths of entries with a merge stage, in index order, along with the stages each one has.
+func UnmergedPaths(entries []types.IndexEntry) ([]string, map[string][]int) {
+	paths := []string{}
+	stages := map[string][]int{}
+	for _, e := range entries {
+		if e.Stage() == 0 {
+			continue
+		}
+		if _, ok := stages[e.Filename]; !ok {
+			paths = append(paths, e.Filename)
+		}
+		stages[e.Filename] = append(stages[e.Filename], e.Stage())
 	}
+	return paths, stages
+}
+
+// GetIndexEntryFromStat creates a fully populated index entry from the current filesystem state of the given path (relative to the working tree root). Symbolic links are not followed, and the mode is taken as is from the filesystem (see ResolveFileMode).
+func (r *Repository) GetIndexEntryFromStat(path string, sha1sum [20]byte) (types.IndexEntry, error) {
 
 	// clean the path to use as filename
 	cleanPath := filepath.Clean(path)
@@ -207,20 +482,38 @@ func GetIndexEntryFromStat(path string, sha1sum [20]byte) (types.IndexEntry, err
 	}
 	cleanPath = filepath.ToSlash(cleanPath) // Use forward slashes
 
+	// Get file info, without following symbolic links
+	info, err := os.Lstat(r.WorkPath(cleanPath))
+	if err != nil {
+		return types.IndexEntry{}, err
+	}
+
 	// Get system-specific file info
-	stat := info.Sys().(*syscall.Stat_t)
+	stat := statOf(info)
 	return types.IndexEntry{
-		Ctime:    uint32(stat.Ctimespec.Sec),
-		CtimeNs:  uint32(stat.Ctimespec.Nsec),
-		Mtime:    uint32(stat.Mtimespec.Sec),
-		MtimeNs:  uint32(stat.Mtimespec.Nsec),
-		Dev:      uint32(stat.Dev),
-		Ino:      uint32(stat.Ino),
-		Mode:     constants.ModeFile,
-		Uid:      uint32(stat.Uid),
-		Gid:      uint32(stat.Gid),
+		Ctime:    stat.Ctime,
+		CtimeNs:  stat.CtimeNs,
+		Mtime:    stat.Mtime,
+		MtimeNs:  stat.MtimeNs,
+		Dev:      stat.Dev,
+		Ino:      stat.Ino,
+		Mode:     WorkTreeMode(info),
+		Uid:      stat.Uid,
+		Gid:      stat.Gid,
 		FileSize: uint32(info.Size()),
 		SHA1:     sha1sum,
 		Filename: cleanPath,
 	}, nil
 }
+
+// IndexEntryMatchesStat reports whether the stat data cached in entry still matches the file described by info, i.e. the file can be assumed unchanged without rehashing it.
+func IndexEntryMatchesStat(entry types.IndexEntry, info os.FileInfo) bool {
+	stat := statOf(info)
+	return entry.Dev == stat.Dev &&
+		entry.Ino == stat.Ino &&
+		entry.FileSize == uint32(info.Size()) &&
+		entry.Mtime == stat.Mtime &&
+		entry.MtimeNs == stat.MtimeNs &&
+		entry.Ctime == stat.Ctime &&
+		entry.CtimeNs == stat.CtimeNs
+}
@@ -0,0 +1,151 @@
+package plumbing
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// newTestRepository initializes an empty repository in a temporary directory.
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	repo, _, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// testIndexEntry builds an index entry with the flags the index writer records for it.
+func testIndexEntry(name string, stage int, extendedFlags uint16) types.IndexEntry {
+	ie := types.IndexEntry{
+		Ctime: 1700000000, CtimeNs: 1, Mtime: 1700000001, MtimeNs: 2,
+		Dev: 3, Ino: 4, Mode: constants.ModeFile, Uid: 5, Gid: 6, FileSize: 7,
+		SHA1:          sha1.Sum([]byte(name)),
+		Flags:         uint16(min(len(name), types.IndexFlagNameLength)),
+		ExtendedFlags: extendedFlags,
+		Filename:      name,
+	}
+	ie.SetStage(stage)
+	if extendedFlags != 0 {
+		ie.Flags |= types.IndexFlagExtended
+	}
+	return ie
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	plain := []types.IndexEntry{
+		testIndexEntry("README.md", 0, 0),
+		testIndexEntry("src/main.go", 0, 0),
+		testIndexEntry("src/main_test.go", 0, 0),
+		testIndexEntry("src/util/strings.go", 0, 0),
+		testIndexEntry("unmerged.txt", 1, 0),
+		testIndexEntry("unmerged.txt", 2, 0),
+		testIndexEntry("unmerged.txt", 3, 0),
+		testIndexEntry(strings.Repeat("d/", 2100)+"long-name", 0, 0),
+	}
+	extended := append([]types.IndexEntry{
+		testIndexEntry("intent-to-add.txt", 0, types.IndexFlagIntentToAdd),
+		testIndexEntry("sparse/skipped.txt", 0, types.IndexFlagSkipWorktree),
+	}, plain...)
+
+	tests := []struct {
+		name        string
+		config      string // index.version, "" when unset
+		entries     []types.IndexEntry
+		wantVersion uint32
+	}{
+		{"default version", "", plain, 2},
+		{"version 2", "2", plain, 2},
+		{"version 2 upgraded for extended flags", "2", extended, 3},
+		{"version 3", "3", extended, 3},
+		{"version 4", "4", extended, 4},
+		{"invalid version", "7", plain, 2},
+		{"empty index", "4", []types.IndexEntry{}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			if tt.config != "" {
+				if err := repo.SetConfig("index.version", tt.config); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			lock, err := repo.LockIndex()
+			if err != nil {
+				t.Fatal(err)
+			}
+			written := append([]types.IndexEntry{}, tt.entries...)
+			if err := repo.WriteIndexFile(lock, &types.Index{Entries: written}); err != nil {
+				t.Fatalf("WriteIndexFile: %s", err)
+			}
+
+			data, err := os.ReadFile(repo.GitPath("index"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version := binary.BigEndian.Uint32(data[4:8]); version != tt.wantVersion {
+				t.Errorf("index written in version %d, want %d", version, tt.wantVersion)
+			}
+
+			index, err := repo.ReadIndexFile()
+			if err != nil {
+				t.Fatalf("ReadIndexFile: %s", err)
+			}
+			if !reflect.DeepEqual(index.Entries, written) {
+				t.Errorf("entries read back differ from the ones written\ngot:  %v\nwant: %v", index.Entries, written)
+			}
+		})
+	}
+}
+
+func TestIndexVersion(t *testing.T) {
+	tests := []struct {
+		config  string
+		want    uint32
+		wantErr bool
+	}{
+		{"", 2, false},
+		{"2", 2, false},
+		{"3", 3, false},
+		{"4", 4, false},
+		{"1", 2, true},
+		{"5", 2, true},
+		{"four", 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Quote(tt.config), func(t *testing.T) {
+			repo := newTestRepository(t)
+			if tt.config != "" {
+				if err := repo.SetConfig("index.version", tt.config); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := repo.IndexVersion()
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("IndexVersion() = %d, %v, want %d, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOffsetVarintRoundTrip(t *testing.T) {
+	for _, value := range []int{0, 1, 127, 128, 255, 16383, 16384, 1 << 20, 1<<31 - 1} {
+		encoded := appendOffsetVarint(nil, value)
+		got, n := readOffsetVarint(encoded)
+		if got != value || n != len(encoded) {
+			t.Errorf("readOffsetVarint(appendOffsetVarint(%d)) = %d, %d bytes, want %d, %d bytes", value, got, n, value, len(encoded))
+		}
+	}
+	if _, n := readOffsetVarint([]byte{0x80}); n != 0 {
+		t.Errorf("readOffsetVarint accepted a truncated value")
+	}
+}
@@ -0,0 +1,106 @@
+package plumbing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+)
+
+// LockFile is the "<path>.lock" file held while path is rewritten, like git does for the index, refs and config. It is created exclusively, so that a concurrent writer fails instead of overwriting the file, and renamed over path once complete, so that readers never observe a partial file.
+type LockFile struct {
+	Path string // file being rewritten
+	file *os.File
+}
+
+// Lock takes the lock on path by creating "<path>.lock". It fails if the lock file already exists.
+func Lock(path string) (*LockFile, error) {
+	lockPath := path + ".lock"
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, constants.DefaultFilePerm)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("unable to create '%s': File exists. Another gegit process seems to be running in this repository. If it still fails, a process may have crashed in this repository earlier: remove the file manually to continue", lockPath)
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to create '%s': %s", lockPath, err)
+	}
+	return &LockFile{Path: path, file: file}, nil
+}
+
+// Write appends data to the lock file.
+func (l *LockFile) Write(data []byte) error {
+	_, err := l.file.Write(data)
+	return err
+}
+
+// Commit flushes the lock file to disk and renames it over the locked path, releasing the lock.
+func (l *LockFile) Commit() error {
+	file := l.file
+	l.file = nil
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), l.Path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+// Rollback removes the lock file, leaving the locked path untouched. It does nothing once the lock is released, so it is safe to call on every error path.
+func (l *LockFile) Rollback() {
+	if l.file == nil {
+		return
+	}
+	l.file.Close()
+	os.Remove(l.file.Name())
+	l.file = nil
+}
+
+// WriteFileLocked replaces the content of path through its lock file (see LockFile).
+func WriteFileLocked(path string, data []byte) error {
+	lock, err := Lock(path)
+	if err != nil {
+		return err
+	}
+	if err := lock.Write(data); err != nil {
+		lock.Rollback()
+		return err
+	}
+	return lock.Commit()
+}
+
+// writeFileViaTemp writes data next to path and renames it into place, so readers never observe a partial file.
+func writeFileViaTemp(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp_"+filepath.Base(path)+"_")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
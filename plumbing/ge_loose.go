@@ -0,0 +1,194 @@
+package plumbing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// LooseObjectStore is the default ObjectStore : one zlib-compressed file per object under <dir>/xx/yyyy..., plus read access to the packfiles under <dir>/pack.
+type LooseObjectStore struct {
+	Dir string // objects directory, usually .git/objects
+
+	packsMu     sync.Mutex
+	packsLoaded bool
+	packs       []*packIndex
+}
+
+// NewLooseObjectStore creates a store rooted at the given objects directory.
+func NewLooseObjectStore(dir string) *LooseObjectStore {
+	return &LooseObjectStore{Dir: dir}
+}
+
+// loosePath returns the path of the loose object file for sha.
+func (s *LooseObjectStore) loosePath(sha [20]byte) string {
+	hexSha := hex.EncodeToString(sha[:])
+	return filepath.Join(s.Dir, hexSha[:2], hexSha[2:])
+}
+
+// Has reports whether the object exists either loose or in a pack.
+func (s *LooseObjectStore) Has(sha [20]byte) bool {
+	if _, err := os.Stat(s.loosePath(sha)); err == nil {
+		return true
+	}
+	return s.HasPacked(sha)
+}
+
+// Read inflates a loose object, falling back to packfiles when no loose object exists.
+func (s *LooseObjectStore) Read(sha [20]byte) (types.ObjectType, []byte, error) {
+
+	// Read File at path
+	f, err := os.Open(s.loosePath(sha))
+	if os.IsNotExist(err) {
+		// Not a loose object, look it up in the packs instead
+		return s.readPacked(sha)
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	// Defer file closing
+	defer f.Close()
+
+	// Z-lib decompress and read the object
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Defer z-lib reader closure
+	defer zr.Close()
+
+	// Read all data
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Split Header, Content -> then Header to parts
+	nullIdx := bytes.IndexByte(data, 0)
+	if nullIdx == -1 {
+		return "", nil, fmt.Errorf("corrupt object")
+	}
+
+	header := string(data[:nullIdx])
+	content := data[nullIdx+1:]
+
+	parts := strings.Split(header, " ")
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("invalid object header")
+	}
+
+	// Return ObjType and Content
+	objType := types.ObjectType(parts[0])
+	return objType, content, nil
+}
+
+// Write zlib-compresses "<type> <size>\0<content>" into the loose object file for sha.
+func (s *LooseObjectStore) Write(sha [20]byte, objType types.ObjectType, content []byte) error {
+
+	// If object already exists, do nothing
+	filePath := s.loosePath(sha)
+	if _, err := os.Stat(filePath); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Create directory
+	if err := os.MkdirAll(filepath.Dir(filePath), constants.DefaultDirPerm); err != nil {
+		return err
+	}
+
+	// "<type> <size>\0<content>"
+	header := fmt.Sprintf("%s %d\x00", objType, len(content))
+	store := append([]byte(header), content...)
+
+	// Z-lib compress and write the object
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(store); err != nil {
+		return err
+	}
+
+	// Close the writer
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// Write to a temporary file renamed to filePath, so that a partial object is never seen
+	return writeFileViaTemp(filePath, buf.Bytes(), constants.DefaultFilePerm)
+}
+
+// Iterate visits every loose object, then every packed object that has no loose copy.
+func (s *LooseObjectStore) Iterate(fn func(sha [20]byte) error) error {
+	seen := map[[20]byte]bool{}
+	if err := s.iterateLoose(func(sha [20]byte) error {
+		seen[sha] = true
+		return fn(sha)
+	}); err != nil {
+		return err
+	}
+
+	allPacks, err := s.loadPacks()
+	if err != nil {
+		return err
+	}
+	for _, p := range allPacks {
+		for i := 0; i < p.count; i++ {
+			sha := p.shaAt(i)
+			if seen[sha] {
+				continue
+			}
+			seen[sha] = true
+			if err := fn(sha); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// iterateLoose visits every object file in the two-hex-digit fan-out directories.
+func (s *LooseObjectStore) iterateLoose(fn func(sha [20]byte) error) error {
+	dirs, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+
+		// Loose objects live in two-hex-digit fan-out directories
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		if _, err := hex.DecodeString(dir.Name()); err != nil {
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(s.Dir, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			shaBytes, err := hex.DecodeString(dir.Name() + f.Name())
+			if err != nil || len(shaBytes) != 20 {
+				continue
+			}
+			if err := fn([20]byte(shaBytes)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
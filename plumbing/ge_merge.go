@@ -0,0 +1,368 @@
+package plumbing
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/diff"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// Labels of the conflict markers written when merging several merge bases together
+const (
+	virtualOursLabel   = "Temporary merge branch 1"
+	virtualTheirsLabel = "Temporary merge branch 2"
+)
+
+// MergeTrees performs a three-way merge of the ours and theirs trees against their common ancestor baseTree (the zero SHA for none). Paths changed on one side only take that side, paths changed on both sides are merged line by line. Paths which can't be merged are recorded as conflicts, with their versions in index stages 1 to 3. A file in the way of a directory of the other side is moved aside (see moveDirectoryFileConflicts). The labels name both sides in conflict markers.
+func (r *Repository) MergeTrees(baseTree, oursTree, theirsTree [20]byte, oursLabel, theirsLabel string) (*types.MergeResult, error) {
+
+	// Files of the three trees
+	sides := [3]map[string]types.TreeEntry{}
+	for i, treeSHA := range [3][20]byte{baseTree, oursTree, theirsTree} {
+		files, err := r.TreeFiles(treeSHA)
+		if err != nil {
+			return nil, err
+		}
+		sides[i] = files
+	}
+	base, ours, theirs := sides[0], sides[1], sides[2]
+
+	// Every path of the three trees, in order
+	pathSet := map[string]bool{}
+	for _, side := range sides {
+		for path := range side {
+			pathSet[path] = true
+		}
+	}
+	paths := make([]string, 0, len(pathSet))
+	for path := range pathSet {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	result := &types.MergeResult{Files: map[string]types.TreeEntry{}}
+
+	// A merged path goes to stage 0
+	resolve := func(path string, te types.TreeEntry) {
+		result.Entries = append(result.Entries, types.IndexEntry{Filename: path, SHA1: te.SHA, Mode: te.Mode})
+		result.Files[path] = te
+	}
+
+	// A conflicted path keeps every version it has in stages 1 (base), 2 (ours) and 3 (theirs)
+	conflict := func(c types.MergeConflict, workTree types.TreeEntry) {
+		for i, side := range sides {
+			if te, ok := side[c.Path]; ok {
+				result.Entries = append(result.Entries, types.IndexEntry{Filename: c.Path, SHA1: te.SHA, Mode: te.Mode, Flags: uint16(i+1) << 12})
+			}
+		}
+		result.Files[c.Path] = workTree
+		result.Conflicts = append(result.Conflicts, c)
+	}
+
+	for _, path := range paths {
+		o, inBase := base[path]
+		a, inOurs := ours[path]
+		b, inTheirs := theirs[path]
+
+		switch {
+		case sameTreeEntry(a, inOurs, b, inTheirs):
+			// Same on both sides, possibly deleted on both
+			if inOurs {
+				resolve(path, a)
+			}
+
+		case sameTreeEntry(o, inBase, a, inOurs):
+			// Only changed in theirs
+			if inTheirs {
+				resolve(path, b)
+			}
+
+		case sameTreeEntry(o, inBase, b, inTheirs):
+			// Only changed in ours
+			if inOurs {
+				resolve(path, a)
+			}
+
+		case !inOurs:
+			conflict(types.MergeConflict{Path: path, Kind: "modify/delete", DeletedBy: oursLabel, KeptBy: theirsLabel}, b)
+
+		case !inTheirs:
+			conflict(types.MergeConflict{Path: path, Kind: "modify/delete", DeletedBy: theirsLabel, KeptBy: oursLabel}, a)
+
+		default:
+			// Changed on both sides : merge the modes, then the contents
+			kind := "content"
+			if !inBase {
+				kind = "add/add"
+			}
+			mode, modeMerged := mergeModes(o.Mode, inBase, a.Mode, b.Mode)
+
+			if a.SHA == b.SHA {
+				if modeMerged {
+					resolve(path, types.TreeEntry{Name: path, Mode: mode, SHA: a.SHA, Type: types.BlobObject})
+				} else {
+					conflict(types.MergeConflict{Path: path, Kind: kind}, a)
+				}
+				continue
+			}
+
+			// Submodules have no content here to merge
+			if a.Mode == constants.ModeGitlink || b.Mode == constants.ModeGitlink || (inBase && o.Mode == constants.ModeGitlink) {
+				conflict(types.MergeConflict{Path: path, Kind: "submodule", KeptBy: oursLabel}, a)
+				continue
+			}
+
+			// Read the three versions
+			contents := [3][]byte{}
+			for i, te := range [3]types.TreeEntry{o, a, b} {
+				if i == 0 && !inBase {
+					continue
+				}
+				_, content, err := r.ReadObject(hex.EncodeToString(te.SHA[:]))
+				if err != nil {
+					return nil, err
+				}
+				contents[i] = content
+			}
+
+			// Symbolic links and binary files can't be merged line by line, ours is kept
+			if a.Mode == constants.ModeSymlink || b.Mode == constants.ModeSymlink || diff.IsBinary(contents[0]) || diff.IsBinary(contents[1]) || diff.IsBinary(contents[2]) {
+				conflict(types.MergeConflict{Path: path, Kind: "binary", KeptBy: oursLabel}, a)
+				continue
+			}
+
+			merged, conflicts := diff.Merge3(contents[0], contents[1], contents[2], oursLabel, theirsLabel, diff.Myers)
+			result.AutoMerged = append(result.AutoMerged, path)
+			sha, err := r.WriteObject(types.BlobObject, merged)
+			if err != nil {
+				return nil, err
+			}
+			te := types.TreeEntry{Name: path, Mode: mode, SHA: sha, Type: types.BlobObject}
+			if conflicts == 0 && modeMerged {
+				resolve(path, te)
+			} else {
+				conflict(types.MergeConflict{Path: path, Kind: kind}, te)
+			}
+		}
+	}
+	moveDirectoryFileConflicts(result, sides, oursLabel, theirsLabel)
+	return result, nil
+}
+
+// moveDirectoryFileConflicts moves aside the merged files which are in the way of a directory of the other side, like git : the file of the side labelled label goes to "<path>~<label>", recorded as a conflict with its versions in stages 1 to 3, so that the merged tree never holds a file and a directory of the same name.
+func moveDirectoryFileConflicts(result *types.MergeResult, sides [3]map[string]types.TreeEntry, oursLabel, theirsLabel string) {
+
+	// Directories of the merged tree
+	dirs := map[string]bool{}
+	for path := range result.Files {
+		for dir := parentDir(path); dir != "" && !dirs[dir]; dir = parentDir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	inTheWay := []string{}
+	for path := range result.Files {
+		if dirs[path] {
+			inTheWay = append(inTheWay, path)
+		}
+	}
+	sort.Strings(inTheWay)
+
+	for _, path := range inTheWay {
+		label := oursLabel
+		if _, inOurs := sides[1][path]; !inOurs {
+			label = theirsLabel
+		}
+
+		// A name free in the merged tree, e.g. "a~HEAD", else "a~HEAD_0"...
+		suffix := "~" + strings.ReplaceAll(label, "/", "_")
+		moved := path + suffix
+		for n := 0; ; n++ {
+			if _, taken := result.Files[moved]; !taken && !dirs[moved] {
+				break
+			}
+			moved = fmt.Sprintf("%s%s_%d", path, suffix, n)
+		}
+
+		// The versions of the file move to the new name, in conflict stages
+		result.Entries = slices.DeleteFunc(result.Entries, func(e types.IndexEntry) bool { return e.Filename == path })
+		for i, side := range sides {
+			if te, ok := side[path]; ok {
+				result.Entries = append(result.Entries, types.IndexEntry{Filename: moved, SHA1: te.SHA, Mode: te.Mode, Flags: uint16(i+1) << 12})
+			}
+		}
+		te := result.Files[path]
+		te.Name = moved
+		result.Files[moved] = te
+		delete(result.Files, path)
+
+		result.Conflicts = slices.DeleteFunc(result.Conflicts, func(c types.MergeConflict) bool { return c.Path == path })
+		result.Conflicts = append(result.Conflicts, types.MergeConflict{Path: moved, Kind: "file/directory", KeptBy: label, MovedFrom: path})
+	}
+	sort.Slice(result.Conflicts, func(i, j int) bool { return result.Conflicts[i].Path < result.Conflicts[j].Path })
+}
+
+// TreeFiles returns the blobs and gitlinks (submodule commits) of a tree by path, nothing for the zero SHA.
+func (r *Repository) TreeFiles(treeSHA [20]byte) (map[string]types.TreeEntry, error) {
+	files := map[string]types.TreeEntry{}
+	if treeSHA == [20]byte{} {
+		return files, nil
+	}
+	entries, err := r.FlattenTree(treeSHA)
+	if err != nil {
+		return nil, err
+	}
+	for path, te := range entries {
+		if te.Type == types.BlobObject || te.Mode == constants.ModeGitlink {
+			files[path] = te
+		}
+	}
+	return files, nil
+}
+
+// sameTreeEntry reports whether two optional entries are identical (content and mode), or both missing.
+func sameTreeEntry(x types.TreeEntry, hasX bool, y types.TreeEntry, hasY bool) bool {
+	return hasX == hasY && (!hasX || (x.SHA == y.SHA && x.Mode == y.Mode))
+}
+
+// mergeModes merges the modes of a file changed on both sides. It returns ours when they can't be merged.
+func mergeModes(base uint32, inBase bool, ours, theirs uint32) (uint32, bool) {
+	switch {
+	case ours == theirs:
+		return ours, true
+	case inBase && base == ours:
+		return theirs, true
+	case inBase && base == theirs:
+		return ours, true
+	default:
+		return ours, false
+	}
+}
+
+// MergedTree writes the tree of the merged working tree of a merge result, conflict markers included.
+func (r *Repository) MergedTree(result *types.MergeResult) ([20]byte, error) {
+	entries := make([]types.IndexEntry, 0, len(result.Files))
+	for path, te := range result.Files {
+		entries = append(entries, types.IndexEntry{Filename: path, SHA1: te.SHA, Mode: te.Mode})
+	}
+	return r.WriteTree(BuildTreeFromIndex(entries))
+}
+
+// MergeBaseTree returns the tree to use as common ancestor when merging two commits, along with their merge bases. Like git's recursive strategy, several merge bases are merged together into a virtual ancestor first, conflicts included (see virtualAncestorTree). Unrelated histories give the zero SHA (empty tree).
+func (r *Repository) MergeBaseTree(a, b [20]byte) ([20]byte, [][20]byte, error) {
+	bases, err := r.MergeBases(a, b)
+	if err != nil || len(bases) == 0 {
+		return [20]byte{}, bases, err
+	}
+	virtual, err := r.virtualAncestorTree(bases)
+	if err != nil {
+		return [20]byte{}, nil, err
+	}
+	return virtual, bases, nil
+}
+
+// virtualAncestorTree merges the commits bases one after the other into the tree of a virtual commit, whose parents are the bases merged so far. The ancestor of each of these merges is, recursively, the virtual ancestor of the merge bases of the next base and that virtual commit, i.e. of a hypothetical merge of the bases merged so far.
+func (r *Repository) virtualAncestorTree(bases [][20]byte) ([20]byte, error) {
+	if len(bases) == 0 {
+		return [20]byte{}, nil
+	}
+	first, err := r.ReadCommit(bases[0])
+	if err != nil {
+		return [20]byte{}, err
+	}
+	virtual := first.TreeSHA
+
+	for i, next := range bases[1:] {
+		innerBases, err := r.MergeBases(next, bases[:i+1]...)
+		if err != nil {
+			return [20]byte{}, err
+		}
+		innerBase, err := r.virtualAncestorTree(innerBases)
+		if err != nil {
+			return [20]byte{}, err
+		}
+		nextCommit, err := r.ReadCommit(next)
+		if err != nil {
+			return [20]byte{}, err
+		}
+		result, err := r.MergeTrees(innerBase, virtual, nextCommit.TreeSHA, virtualOursLabel, virtualTheirsLabel)
+		if err != nil {
+			return [20]byte{}, err
+		}
+		if virtual, err = r.MergedTree(result); err != nil {
+			return [20]byte{}, err
+		}
+	}
+	return virtual, nil
+}
+
+// ReadMergeHeads returns the commits being merged by a merge stopped on conflicts (.git/MERGE_HEAD), nil when no merge is in progress.
+func (r *Repository) ReadMergeHeads() ([][20]byte, error) {
+	data, err := os.ReadFile(r.GitPath("MERGE_HEAD"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	heads := [][20]byte{}
+	for _, line := range strings.Fields(string(data)) {
+		shaBytes, err := hex.DecodeString(line)
+		if err != nil || len(shaBytes) != 20 {
+			return nil, errors.New("invalid MERGE_HEAD contents")
+		}
+		heads = append(heads, [20]byte(shaBytes))
+	}
+	return heads, nil
+}
+
+// WriteMergeState records a merge stopped on conflicts : the merged commits (MERGE_HEAD), the prepared commit message (MERGE_MSG) and the merge options (MERGE_MODE).
+func (r *Repository) WriteMergeState(heads [][20]byte, message string, noFF bool) error {
+	var sb strings.Builder
+	for _, head := range heads {
+		sb.WriteString(hex.EncodeToString(head[:]) + "\n")
+	}
+	if err := os.WriteFile(r.GitPath("MERGE_HEAD"), []byte(sb.String()), constants.DefaultFilePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.GitPath("MERGE_MSG"), []byte(message), constants.DefaultFilePerm); err != nil {
+		return err
+	}
+	mode := ""
+	if noFF {
+		mode = "no-ff"
+	}
+	return os.WriteFile(r.GitPath("MERGE_MODE"), []byte(mode), constants.DefaultFilePerm)
+}
+
+// ReadMergeMessage returns the commit message prepared for the merge in progress, without its comment lines.
+func (r *Repository) ReadMergeMessage() (string, error) {
+	data, err := os.ReadFile(r.GitPath("MERGE_MSG"))
+	if err != nil {
+		return "", err
+	}
+	lines := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, strings.TrimRight(line, " \t"))
+		}
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n"), nil
+}
+
+// ClearMergeState removes the files recording a merge in progress.
+func (r *Repository) ClearMergeState() error {
+	for _, name := range []string{"MERGE_HEAD", "MERGE_MSG", "MERGE_MODE"} {
+		if err := os.Remove(r.GitPath(name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package plumbing
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// testTree writes a tree holding the given files (path to content) to the repository.
+func testTree(t *testing.T, repo *Repository, files map[string]string) [20]byte {
+	t.Helper()
+	if files == nil {
+		return [20]byte{}
+	}
+	entries := []types.IndexEntry{}
+	for path, content := range files {
+		sha, err := repo.WriteObject(types.BlobObject, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, types.IndexEntry{Filename: path, SHA1: sha, Mode: constants.ModeFile})
+	}
+	slices.SortFunc(entries, func(a, b types.IndexEntry) int { return strings.Compare(a.Filename, b.Filename) })
+	tree, err := repo.WriteTree(BuildTreeFromIndex(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// mergedContents reads the content of every file of the merged working tree.
+func mergedContents(t *testing.T, repo *Repository, result *types.MergeResult) map[string]string {
+	t.Helper()
+	contents := map[string]string{}
+	for path, te := range result.Files {
+		_, content, err := repo.Objects.Read(te.SHA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[path] = string(content)
+	}
+	return contents
+}
+
+// entryStages lists the stages of the merged index entries, by path.
+func entryStages(result *types.MergeResult) map[string][]int {
+	stages := map[string][]int{}
+	for _, e := range result.Entries {
+		stages[e.Filename] = append(stages[e.Filename], e.Stage())
+	}
+	for path := range stages {
+		slices.Sort(stages[path])
+	}
+	return stages
+}
+
+func TestMergeTrees(t *testing.T) {
+	binary := "\x00\x01binary"
+	tests := []struct {
+		name           string
+		base           map[string]string // nil for no common ancestor
+		ours           map[string]string
+		theirs         map[string]string
+		wantFiles      map[string]string
+		wantStages     map[string][]int
+		wantConflicts  []types.MergeConflict
+		wantAutoMerged []string
+	}{
+		{
+			name:       "clean",
+			base:       map[string]string{"a.txt": "1\n2\n3\n4\n5\n", "keep.txt": "same\n", "gone.txt": "old\n"},
+			ours:       map[string]string{"a.txt": "one\n2\n3\n4\n5\n", "keep.txt": "same\n", "new.txt": "ours\n"},
+			theirs:     map[string]string{"a.txt": "1\n2\n3\n4\nfive\n", "keep.txt": "same\n", "gone.txt": "old\n"},
+			wantFiles:  map[string]string{"a.txt": "one\n2\n3\n4\nfive\n", "keep.txt": "same\n", "new.txt": "ours\n"},
+			wantStages: map[string][]int{"a.txt": {0}, "keep.txt": {0}, "new.txt": {0}},
+
+			wantAutoMerged: []string{"a.txt"},
+		},
+		{
+			name:          "content conflict",
+			base:          map[string]string{"a.txt": "1\n2\n3\n"},
+			ours:          map[string]string{"a.txt": "1\nours\n3\n"},
+			theirs:        map[string]string{"a.txt": "1\ntheirs\n3\n"},
+			wantFiles:     map[string]string{"a.txt": "1\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\n3\n"},
+			wantStages:    map[string][]int{"a.txt": {1, 2, 3}},
+			wantConflicts: []types.MergeConflict{{Path: "a.txt", Kind: "content"}},
+
+			wantAutoMerged: []string{"a.txt"},
+		},
+		{
+			name:          "add/add conflict",
+			ours:          map[string]string{"a.txt": "ours\n"},
+			theirs:        map[string]string{"a.txt": "theirs\n"},
+			wantFiles:     map[string]string{"a.txt": "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\n"},
+			wantStages:    map[string][]int{"a.txt": {2, 3}},
+			wantConflicts: []types.MergeConflict{{Path: "a.txt", Kind: "add/add"}},
+
+			wantAutoMerged: []string{"a.txt"},
+		},
+		{
+			name:          "modify/delete",
+			base:          map[string]string{"a.txt": "old\n"},
+			ours:          map[string]string{},
+			theirs:        map[string]string{"a.txt": "changed\n"},
+			wantFiles:     map[string]string{"a.txt": "changed\n"},
+			wantStages:    map[string][]int{"a.txt": {1, 3}},
+			wantConflicts: []types.MergeConflict{{Path: "a.txt", Kind: "modify/delete", DeletedBy: "HEAD", KeptBy: "topic"}},
+		},
+		{
+			name:          "binary",
+			base:          map[string]string{"image.bin": binary + "0"},
+			ours:          map[string]string{"image.bin": binary + "1"},
+			theirs:        map[string]string{"image.bin": binary + "2"},
+			wantFiles:     map[string]string{"image.bin": binary + "1"},
+			wantStages:    map[string][]int{"image.bin": {1, 2, 3}},
+			wantConflicts: []types.MergeConflict{{Path: "image.bin", Kind: "binary", KeptBy: "HEAD"}},
+		},
+		{
+			name:          "file of ours in the way of a directory",
+			base:          map[string]string{"x": "x\n"},
+			ours:          map[string]string{"x": "x\n", "a": "file\n"},
+			theirs:        map[string]string{"x": "x\n", "a/b": "inside\n"},
+			wantFiles:     map[string]string{"x": "x\n", "a/b": "inside\n", "a~HEAD": "file\n"},
+			wantStages:    map[string][]int{"x": {0}, "a/b": {0}, "a~HEAD": {2}},
+			wantConflicts: []types.MergeConflict{{Path: "a~HEAD", Kind: "file/directory", KeptBy: "HEAD", MovedFrom: "a"}},
+		},
+		{
+			name:          "file of theirs in the way of a directory",
+			base:          map[string]string{"x": "x\n"},
+			ours:          map[string]string{"x": "x\n", "a/b": "inside\n"},
+			theirs:        map[string]string{"x": "x\n", "a": "file\n"},
+			wantFiles:     map[string]string{"x": "x\n", "a/b": "inside\n", "a~topic": "file\n"},
+			wantStages:    map[string][]int{"x": {0}, "a/b": {0}, "a~topic": {3}},
+			wantConflicts: []types.MergeConflict{{Path: "a~topic", Kind: "file/directory", KeptBy: "topic", MovedFrom: "a"}},
+		},
+		{
+			name:          "moved aside under a free name",
+			base:          map[string]string{"a~HEAD": "taken\n"},
+			ours:          map[string]string{"a~HEAD": "taken\n", "a": "file\n"},
+			theirs:        map[string]string{"a~HEAD": "taken\n", "a/b": "inside\n"},
+			wantFiles:     map[string]string{"a~HEAD": "taken\n", "a/b": "inside\n", "a~HEAD_0": "file\n"},
+			wantStages:    map[string][]int{"a~HEAD": {0}, "a/b": {0}, "a~HEAD_0": {2}},
+			wantConflicts: []types.MergeConflict{{Path: "a~HEAD_0", Kind: "file/directory", KeptBy: "HEAD", MovedFrom: "a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &Repository{Objects: NewMemoryObjectStore()}
+			result, err := repo.MergeTrees(testTree(t, repo, tt.base), testTree(t, repo, tt.ours), testTree(t, repo, tt.theirs), "HEAD", "topic")
+			if err != nil {
+				t.Fatalf("MergeTrees: %s", err)
+			}
+
+			if got := mergedContents(t, repo, result); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("merged files = %q, want %q", got, tt.wantFiles)
+			}
+			if got := entryStages(result); !reflect.DeepEqual(got, tt.wantStages) {
+				t.Errorf("index stages = %v, want %v", got, tt.wantStages)
+			}
+			if !slices.Equal(result.Conflicts, tt.wantConflicts) {
+				t.Errorf("conflicts = %+v, want %+v", result.Conflicts, tt.wantConflicts)
+			}
+			if !slices.Equal(result.AutoMerged, tt.wantAutoMerged) {
+				t.Errorf("auto-merged = %v, want %v", result.AutoMerged, tt.wantAutoMerged)
+			}
+
+			// The merged working tree can always be written, conflicts included
+			if _, err := repo.MergedTree(result); err != nil {
+				t.Errorf("MergedTree: %s", err)
+			}
+		})
+	}
+}
+
+func TestWriteTreeRefusesDuplicateEntries(t *testing.T) {
+	repo := &Repository{Objects: NewMemoryObjectStore()}
+	blob, err := repo.WriteObject(types.BlobObject, []byte("content\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []types.IndexEntry{
+		{Filename: "a", SHA1: blob, Mode: constants.ModeFile},
+		{Filename: "a/b", SHA1: blob, Mode: constants.ModeFile},
+	}
+	if tree, err := repo.WriteTree(BuildTreeFromIndex(entries)); err == nil {
+		t.Errorf("WriteTree wrote %x, holding a file and a directory both named 'a'", tree)
+	}
+}
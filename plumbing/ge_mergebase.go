@@ -0,0 +1,182 @@
+package plumbing
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// MergeBases returns the best common ancestors of a and b : the common ancestors which are not an ancestor of another common ancestor. Usually there is one, criss-cross merges can have several, unrelated histories have none. They are ordered by committer date, most recent first. With several others, like git merge-base A B C, the common ancestors of a and any of them are used (the merge bases of a and a hypothetical merge of the others).
+func (r *Repository) MergeBases(a [20]byte, others ...[20]byte) ([][20]byte, error) {
+
+	// Every ancestor of a, including a itself
+	ancestorsA, err := r.ancestors([][20]byte{a})
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk from the others, stopping at the first common commit on each path
+	candidates := [][20]byte{}
+	seen := map[[20]byte]bool{}
+	stack := append([][20]byte{}, others...)
+	for len(stack) > 0 {
+		sha := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[sha] {
+			continue
+		}
+		seen[sha] = true
+
+		if ancestorsA[sha] {
+			candidates = append(candidates, sha)
+			continue
+		}
+		commit, err := r.ReadCommit(sha)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, commit.ParentsSHA...)
+	}
+
+	// A candidate reachable from the parents of another one is redundant
+	parents := [][20]byte{}
+	for _, sha := range candidates {
+		commit, err := r.ReadCommit(sha)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, commit.ParentsSHA...)
+	}
+	redundant, err := r.ancestors(parents)
+	if err != nil {
+		return nil, err
+	}
+
+	bases := [][20]byte{}
+	for _, sha := range candidates {
+		if !redundant[sha] {
+			bases = append(bases, sha)
+		}
+	}
+	if err := r.sortByCommitterDate(bases); err != nil {
+		return nil, err
+	}
+	return bases, nil
+}
+
+// OctopusMergeBases returns the best common ancestors of all the given commits, as needed by a merge of all of them at once.
+func (r *Repository) OctopusMergeBases(commits [][20]byte) ([][20]byte, error) {
+	if len(commits) == 0 {
+		return nil, nil
+	}
+
+	// Fold the commits one at a time into the bases found so far
+	bases := [][20]byte{commits[0]}
+	for _, next := range commits[1:] {
+		folded := [][20]byte{}
+		for _, base := range bases {
+			found, err := r.MergeBases(base, next)
+			if err != nil {
+				return nil, err
+			}
+			for _, sha := range found {
+				if !slices.Contains(folded, sha) {
+					folded = append(folded, sha)
+				}
+			}
+		}
+		bases = folded
+	}
+	if err := r.sortByCommitterDate(bases); err != nil {
+		return nil, err
+	}
+	return bases, nil
+}
+
+// IsAncestor reports whether ancestor is reachable from commit (a commit is its own ancestor).
+func (r *Repository) IsAncestor(ancestor, commit [20]byte) (bool, error) {
+	reachable, err := r.ancestors([][20]byte{commit})
+	if err != nil {
+		return false, err
+	}
+	return reachable[ancestor], nil
+}
+
+// ForkPoint finds the point at which commit forked from a ref (e.g. refs/heads/master), taking into account every commit the ref pointed to according to its reflog, or only its tip without reflog : among the merge bases of commit and all those commits together, the one the ref pointed to most recently. Returns the fork point and whether one was found.
+func (r *Repository) ForkPoint(refName string, commit [20]byte) ([20]byte, bool, error) {
+
+	// Every commit the ref pointed to
+	entries, err := r.ReadReflog(refName)
+	if err != nil {
+		return [20]byte{}, false, err
+	}
+	tips := [][20]byte{}
+	addTip := func(sha [20]byte) {
+		if sha != ([20]byte{}) && !slices.Contains(tips, sha) && r.Objects.Has(sha) {
+			tips = append(tips, sha)
+		}
+	}
+	for i, entry := range entries {
+		if i == 0 {
+			addTip(entry.Old)
+		}
+		addTip(entry.New)
+	}
+	if len(tips) == 0 {
+		tip, ok := r.ReadRef(refName)
+		if !ok {
+			return [20]byte{}, false, fmt.Errorf("no such ref: %s", refName)
+		}
+		tips = append(tips, tip)
+	}
+
+	bases, err := r.MergeBases(commit, tips...)
+	if err != nil {
+		return [20]byte{}, false, err
+	}
+
+	// Tips are in reflog order, newest last
+	for i := len(tips) - 1; i >= 0; i-- {
+		if slices.Contains(bases, tips[i]) {
+			return tips[i], true, nil
+		}
+	}
+	return [20]byte{}, false, nil
+}
+
+// ancestors returns the set of commits reachable from roots, roots included.
+func (r *Repository) ancestors(roots [][20]byte) (map[[20]byte]bool, error) {
+	seen := map[[20]byte]bool{}
+	stack := append([][20]byte{}, roots...)
+	for len(stack) > 0 {
+		sha := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[sha] {
+			continue
+		}
+		seen[sha] = true
+
+		commit, err := r.ReadCommit(sha)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, commit.ParentsSHA...)
+	}
+	return seen, nil
+}
+
+// sortByCommitterDate sorts commits in place, most recent committer date first.
+func (r *Repository) sortByCommitterDate(shas [][20]byte) error {
+	dates := map[[20]byte]int64{}
+	for _, sha := range shas {
+		commit, err := r.ReadCommit(sha)
+		if err != nil {
+			return err
+		}
+		dates[sha] = commit.Committer.When.Unix()
+	}
+	sort.SliceStable(shas, func(i, j int) bool {
+		return dates[shas[i]] > dates[shas[j]]
+	})
+	return nil
+}
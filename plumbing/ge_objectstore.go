@@ -0,0 +1,96 @@
+package plumbing
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// ErrObjectNotFound is returned (wrapped) by an ObjectStore when the requested object does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is the storage backend behind the object database. Objects are addressed by the SHA-1 of their canonical "<type> <size>\0<content>" form, which callers compute before Write.
+type ObjectStore interface {
+	// Has reports whether the object exists in the store.
+	Has(sha [20]byte) bool
+
+	// Read returns the type and raw content (WITHOUT header) of an object. Missing objects return an error wrapping ErrObjectNotFound.
+	Read(sha [20]byte) (types.ObjectType, []byte, error)
+
+	// Write stores an object under the given SHA. Writing an object that already exists is a no-op.
+	Write(sha [20]byte, objType types.ObjectType, content []byte) error
+
+	// Iterate calls fn once for every object in the store, stopping at the first error.
+	Iterate(fn func(sha [20]byte) error) error
+}
+
+// MemoryObjectStore keeps objects in memory. Useful for tests, or for services which do not need objects to outlive the process.
+type MemoryObjectStore struct {
+	mu      sync.RWMutex
+	objects map[[20]byte]memoryObject
+}
+
+// memoryObject is a single object held by MemoryObjectStore.
+type memoryObject struct {
+	objType types.ObjectType
+	content []byte
+}
+
+// NewMemoryObjectStore creates an empty in-memory object store.
+func NewMemoryObjectStore() *MemoryObjectStore {
+	return &MemoryObjectStore{objects: map[[20]byte]memoryObject{}}
+}
+
+// Has reports whether the object exists in memory.
+func (m *MemoryObjectStore) Has(sha [20]byte) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.objects[sha]
+	return ok
+}
+
+// Read returns a copy of the stored object, so callers cannot mutate the store.
+func (m *MemoryObjectStore) Read(sha [20]byte) (types.ObjectType, []byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[sha]
+	if !ok {
+		return "", nil, fmt.Errorf("%x: %w", sha, ErrObjectNotFound)
+	}
+	return obj.objType, append([]byte(nil), obj.content...), nil
+}
+
+// Write stores a copy of content under sha.
+func (m *MemoryObjectStore) Write(sha [20]byte, objType types.ObjectType, content []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.objects[sha]; !ok {
+		m.objects[sha] = memoryObject{objType: objType, content: append([]byte(nil), content...)}
+	}
+	return nil
+}
+
+// Iterate visits every object in SHA order.
+func (m *MemoryObjectStore) Iterate(fn func(sha [20]byte) error) error {
+	m.mu.RLock()
+	shas := make([][20]byte, 0, len(m.objects))
+	for sha := range m.objects {
+		shas = append(shas, sha)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(shas, func(i, j int) bool {
+		return string(shas[i][:]) < string(shas[j][:])
+	})
+	for _, sha := range shas {
+		if err := fn(sha); err != nil {
+			return err
+		}
+	}
+	return nil
+}
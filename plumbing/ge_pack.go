@@ -0,0 +1,459 @@
+package plumbing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// Object type codes used inside a packfile object header.
+const (
+	packObjCommit   = 1
+	packObjTree     = 2
+	packObjBlob     = 3
+	packObjTag      = 4
+	packObjOfsDelta = 6
+	packObjRefDelta = 7
+
+	maxDeltaDepth = 4096 // guard against corrupt (cyclic) delta chains
+)
+
+// packObjectTypes maps a packfile type code to the object type it represents.
+var packObjectTypes = map[byte]types.ObjectType{
+	packObjCommit: types.CommitObject,
+	packObjTree:   types.TreeObject,
+	packObjBlob:   types.BlobObject,
+	packObjTag:    types.ObjectType("tag"),
+}
+
+// packIndex is an in-memory view of a version 2 pack index (.idx) and a handle to its packfile.
+type packIndex struct {
+	packPath  string      // path to the matching .pack file
+	fanout    [256]uint32 // fanout[b] = number of objects whose first SHA byte is <= b
+	shas      []byte      // N * 20 bytes of sorted object names
+	offsets   []byte      // N * 4 bytes of 31-bit offsets (or indexes into offsets64)
+	offsets64 []byte      // M * 8 bytes of large offsets
+	count     int         // number of objects in the pack
+
+	store *LooseObjectStore // store the pack belongs to, used to resolve REF_DELTA bases
+
+	mu   sync.Mutex // guards pack
+	pack *os.File   // lazily opened packfile
+}
+
+// loadPacks reads every <objects>/pack/*.idx file once and caches the parsed indexes.
+func (s *LooseObjectStore) loadPacks() ([]*packIndex, error) {
+	s.packsMu.Lock()
+	defer s.packsMu.Unlock()
+
+	if s.packsLoaded {
+		return s.packs, nil
+	}
+
+	// Find all pack indexes
+	idxPaths, err := filepath.Glob(filepath.Join(s.Dir, "pack", "*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(idxPaths)
+
+	loaded := []*packIndex{}
+	for _, idxPath := range idxPaths {
+
+		// Skip indexes whose packfile is missing (e.g. an interrupted repack)
+		packPath := strings.TrimSuffix(idxPath, ".idx") + ".pack"
+		if _, err := os.Stat(packPath); err != nil {
+			continue
+		}
+
+		idx, err := readPackIndex(idxPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filepath.Base(idxPath), err)
+		}
+		idx.packPath = packPath
+		idx.store = s
+		loaded = append(loaded, idx)
+	}
+
+	s.packs = loaded
+	s.packsLoaded = true
+	return s.packs, nil
+}
+
+// resetPacks drops the cached pack indexes so the next lookup rescans the pack directory.
+func (s *LooseObjectStore) resetPacks() {
+	s.packsMu.Lock()
+	defer s.packsMu.Unlock()
+
+	for _, p := range s.packs {
+		p.mu.Lock()
+		if p.pack != nil {
+			p.pack.Close()
+			p.pack = nil
+		}
+		p.mu.Unlock()
+	}
+	s.packs = nil
+	s.packsLoaded = false
+}
+
+// readPackIndex parses a version 2 pack index file.
+func readPackIndex(path string) (*packIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header : "\377tOc" + version(2)
+	if len(data) < 8+256*4+40 {
+		return nil, fmt.Errorf("pack index is too short")
+	}
+	if !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) {
+		return nil, fmt.Errorf("unsupported pack index (only version 2 is supported)")
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version != 2 {
+		return nil, fmt.Errorf("unsupported pack index version: %d", version)
+	}
+
+	// Fanout table
+	idx := &packIndex{}
+	offset := 8
+	for i := 0; i < 256; i++ {
+		idx.fanout[i] = binary.BigEndian.Uint32(data[offset:])
+		offset += 4
+	}
+	idx.count = int(idx.fanout[255])
+
+	// SHA table, CRC32 table (skipped), 31-bit offset table
+	shaEnd := offset + idx.count*20
+	crcEnd := shaEnd + idx.count*4
+	offEnd := crcEnd + idx.count*4
+	if offEnd+40 > len(data) {
+		return nil, fmt.Errorf("truncated pack index")
+	}
+	idx.shas = data[offset:shaEnd]
+	idx.offsets = data[crcEnd:offEnd]
+
+	// Remaining bytes before the two trailing checksums are the 64-bit offsets
+	idx.offsets64 = data[offEnd : len(data)-40]
+	if len(idx.offsets64)%8 != 0 {
+		return nil, fmt.Errorf("corrupt large offset table")
+	}
+	return idx, nil
+}
+
+// find returns the packfile offset of the given object, or false if the pack does not contain it.
+func (p *packIndex) find(sha [20]byte) (int64, bool) {
+
+	// Narrow the search down using the fanout table
+	lo := 0
+	if sha[0] > 0 {
+		lo = int(p.fanout[sha[0]-1])
+	}
+	hi := int(p.fanout[sha[0]])
+
+	// Binary search over the sorted SHA table
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.shas[(lo+i)*20:(lo+i+1)*20], sha[:]) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.shas[i*20:(i+1)*20], sha[:]) {
+		return 0, false
+	}
+	return p.offsetAt(i), true
+}
+
+// offsetAt returns the packfile offset of the i-th object in the index.
+func (p *packIndex) offsetAt(i int) int64 {
+	off := binary.BigEndian.Uint32(p.offsets[i*4:])
+
+	// MSB set means the remaining bits are an index into the 64-bit offset table
+	if off&0x80000000 != 0 {
+		large := int(off & 0x7fffffff)
+		return int64(binary.BigEndian.Uint64(p.offsets64[large*8:]))
+	}
+	return int64(off)
+}
+
+// shaAt returns the object name stored at position i of the index.
+func (p *packIndex) shaAt(i int) [20]byte {
+	var sha [20]byte
+	copy(sha[:], p.shas[i*20:(i+1)*20])
+	return sha
+}
+
+// file returns the (lazily opened) packfile handle.
+func (p *packIndex) file() (*os.File, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pack != nil {
+		return p.pack, nil
+	}
+
+	f, err := os.Open(p.packPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate packfile header : "PACK" + version(2 or 3)
+	header := make([]byte, 12)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if string(header[:4]) != "PACK" {
+		f.Close()
+		return nil, fmt.Errorf("invalid packfile header")
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		f.Close()
+		return nil, fmt.Errorf("unsupported packfile version: %d", version)
+	}
+
+	p.pack = f
+	return f, nil
+}
+
+// readAt inflates the object stored at the given packfile offset, resolving any delta chain.
+func (p *packIndex) readAt(offset int64, depth int) (types.ObjectType, []byte, error) {
+	if depth > maxDeltaDepth {
+		return "", nil, fmt.Errorf("delta chain too deep at offset %d", offset)
+	}
+
+	f, err := p.file()
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Read a generous chunk for the header: type/size varint plus an optional base reference
+	header := make([]byte, 32)
+	n, err := f.ReadAt(header, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", nil, err
+	}
+	header = header[:n]
+
+	// First byte : MSB continuation, 3 bits type, 4 bits size. Following bytes add 7 bits of size each.
+	if len(header) == 0 {
+		return "", nil, fmt.Errorf("truncated packfile at offset %d", offset)
+	}
+	typeCode := (header[0] >> 4) & 0x7
+	size := uint64(header[0] & 0x0f)
+	shift := uint(4)
+	pos := 1
+	for header[pos-1]&0x80 != 0 {
+		if pos >= len(header) {
+			return "", nil, fmt.Errorf("corrupt object header at offset %d", offset)
+		}
+		size |= uint64(header[pos]&0x7f) << shift
+		shift += 7
+		pos++
+	}
+
+	switch typeCode {
+	case packObjCommit, packObjTree, packObjBlob, packObjTag:
+		data, err := p.inflate(f, offset+int64(pos), size)
+		if err != nil {
+			return "", nil, err
+		}
+		return packObjectTypes[typeCode], data, nil
+
+	case packObjOfsDelta:
+		// Base offset is encoded relative to this object, with an implicit +1 per continuation byte
+		if pos >= len(header) {
+			return "", nil, fmt.Errorf("corrupt delta header at offset %d", offset)
+		}
+		c := header[pos]
+		pos++
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if pos >= len(header) {
+				return "", nil, fmt.Errorf("corrupt delta header at offset %d", offset)
+			}
+			c = header[pos]
+			pos++
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+		baseOffset := offset - rel
+		if baseOffset <= 0 || baseOffset >= offset {
+			return "", nil, fmt.Errorf("invalid delta base offset at %d", offset)
+		}
+
+		baseType, base, err := p.readAt(baseOffset, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		delta, err := p.inflate(f, offset+int64(pos), size)
+		if err != nil {
+			return "", nil, err
+		}
+		result, err := applyDelta(base, delta)
+		return baseType, result, err
+
+	case packObjRefDelta:
+		// Base is named by its raw 20-byte SHA, and can live anywhere in the object database
+		if pos+20 > len(header) {
+			return "", nil, fmt.Errorf("corrupt delta header at offset %d", offset)
+		}
+		var baseSHA [20]byte
+		copy(baseSHA[:], header[pos:pos+20])
+		pos += 20
+
+		var baseType types.ObjectType
+		var base []byte
+		if baseOffset, ok := p.find(baseSHA); ok {
+			baseType, base, err = p.readAt(baseOffset, depth+1)
+		} else {
+			baseType, base, err = p.store.Read(baseSHA)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		delta, err := p.inflate(f, offset+int64(pos), size)
+		if err != nil {
+			return "", nil, err
+		}
+		result, err := applyDelta(base, delta)
+		return baseType, result, err
+
+	default:
+		return "", nil, fmt.Errorf("unknown object type %d at offset %d", typeCode, offset)
+	}
+}
+
+// inflate decompresses the zlib stream starting at offset and checks the inflated size.
+func (p *packIndex) inflate(f *os.File, offset int64, size uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(io.NewSectionReader(f, offset, 1<<62))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return nil, fmt.Errorf("corrupt packed object at offset %d: %s", offset, err)
+	}
+	return data, nil
+}
+
+// applyDelta reconstructs an object from its base and a git delta instruction stream.
+func applyDelta(base, delta []byte) ([]byte, error) {
+
+	// Header : source size varint, target size varint
+	srcSize, n := readDeltaVarint(delta)
+	if n == 0 || srcSize != uint64(len(base)) {
+		return nil, fmt.Errorf("delta base size mismatch")
+	}
+	delta = delta[n:]
+	dstSize, n := readDeltaVarint(delta)
+	if n == 0 {
+		return nil, fmt.Errorf("corrupt delta header")
+	}
+	delta = delta[n:]
+
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		switch {
+		case op&0x80 != 0:
+			// Copy from base : bits 0-3 select offset bytes, bits 4-6 select size bytes
+			var cpOff, cpSize uint64
+			for i := uint(0); i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, fmt.Errorf("truncated delta copy instruction")
+					}
+					cpOff |= uint64(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if op&(1<<(4+i)) != 0 {
+					if len(delta) == 0 {
+						return nil, fmt.Errorf("truncated delta copy instruction")
+					}
+					cpSize |= uint64(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			if cpSize == 0 {
+				cpSize = 0x10000
+			}
+			if cpOff+cpSize > uint64(len(base)) {
+				return nil, fmt.Errorf("delta copy out of bounds")
+			}
+			out = append(out, base[cpOff:cpOff+cpSize]...)
+
+		case op != 0:
+			// Insert the next op bytes literally
+			if int(op) > len(delta) {
+				return nil, fmt.Errorf("truncated delta insert instruction")
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+
+		default:
+			return nil, fmt.Errorf("invalid delta opcode 0")
+		}
+	}
+
+	if uint64(len(out)) != dstSize {
+		return nil, fmt.Errorf("delta result size mismatch")
+	}
+	return out, nil
+}
+
+// readDeltaVarint decodes the little-endian base-128 sizes at the start of a delta. Returns value and bytes consumed (0 on error).
+func readDeltaVarint(data []byte) (uint64, int) {
+	var value uint64
+	var shift uint
+	for i, b := range data {
+		value |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// readPacked looks the SHA up in every pack index and inflates the object if found.
+func (s *LooseObjectStore) readPacked(sha [20]byte) (types.ObjectType, []byte, error) {
+	allPacks, err := s.loadPacks()
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, p := range allPacks {
+		if offset, ok := p.find(sha); ok {
+			return p.readAt(offset, 0)
+		}
+	}
+	return "", nil, fmt.Errorf("%x: %w", sha, ErrObjectNotFound)
+}
+
+// HasPacked reports whether any pack contains the given object.
+func (s *LooseObjectStore) HasPacked(sha [20]byte) bool {
+	allPacks, err := s.loadPacks()
+	if err != nil {
+		return false
+	}
+	for _, p := range allPacks {
+		if _, ok := p.find(sha); ok {
+			return true
+		}
+	}
+	return false
+}
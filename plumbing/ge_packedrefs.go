@@ -0,0 +1,288 @@
+package plumbing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// packedRefsHeader is the first line of .git/packed-refs : refs are sorted, and annotated tags are followed by the object they peel to.
+const packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
+// ReadPackedRefs parses .git/packed-refs : "<sha> <name>" lines, each optionally followed by a "^<peeled sha>" line, after an optional "#" header. A missing file holds no refs.
+func (r *Repository) ReadPackedRefs() ([]types.PackedRef, error) {
+	data, err := os.ReadFile(r.GitPath("packed-refs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return []types.PackedRef{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	refs := []types.PackedRef{}
+	for i, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "^"):
+			// Peeled value of the ref on the previous line
+			peeled, err := hex.DecodeString(line[1:])
+			if err != nil || len(peeled) != 20 || len(refs) == 0 {
+				return nil, fmt.Errorf("invalid packed-refs line %d: %s", i+1, line)
+			}
+			refs[len(refs)-1].Peeled = [20]byte(peeled)
+		default:
+			shaHex, name, found := strings.Cut(line, " ")
+			sha, err := hex.DecodeString(shaHex)
+			if !found || err != nil || len(sha) != 20 || name == "" {
+				return nil, fmt.Errorf("invalid packed-refs line %d: %s", i+1, line)
+			}
+			refs = append(refs, types.PackedRef{Name: name, SHA: [20]byte(sha)})
+		}
+	}
+	return refs, nil
+}
+
+// WritePackedRefs replaces .git/packed-refs with the given refs, sorted by name. No refs at all removes the file.
+func (r *Repository) WritePackedRefs(refs []types.PackedRef) error {
+	if len(refs) == 0 {
+		if err := os.Remove(r.GitPath("packed-refs")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	return WriteFileLocked(r.GitPath("packed-refs"), encodePackedRefs(refs))
+}
+
+// encodePackedRefs returns the content of .git/packed-refs holding the given refs, sorted by name.
+func encodePackedRefs(refs []types.PackedRef) []byte {
+	sorted := append([]types.PackedRef{}, refs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var buf bytes.Buffer
+	buf.WriteString(packedRefsHeader)
+	for _, ref := range sorted {
+		fmt.Fprintf(&buf, "%x %s\n", ref.SHA, ref.Name)
+		if ref.HasPeeled() {
+			fmt.Fprintf(&buf, "^%x\n", ref.Peeled)
+		}
+	}
+	return buf.Bytes()
+}
+
+// readPackedRef looks up a single ref by its full name in .git/packed-refs.
+func (r *Repository) readPackedRef(name string) ([20]byte, bool) {
+	refs, err := r.ReadPackedRefs()
+	if err != nil {
+		return [20]byte{}, false
+	}
+	for _, ref := range refs {
+		if ref.Name == name {
+			return ref.SHA, true
+		}
+	}
+	return [20]byte{}, false
+}
+
+// DeleteRef deletes a ref by its full name from both stores, its loose file and its entry in .git/packed-refs, along with its reflog.
+func (r *Repository) DeleteRef(name string) error {
+	tx := r.NewRefTransaction()
+	tx.Delete(name, [20]byte{}, false)
+	return tx.Commit()
+}
+
+// RenameRef moves a ref by its full name to another name, as a loose ref, in a single transaction : either the ref is renamed or it is left as it was. Its reflog follows it, and records the rename with message. A ref can be renamed to a name below itself (a to a/b) or above (a/b to a).
+func (r *Repository) RenameRef(oldName, newName, message string) error {
+	sha, ok := r.ReadRef(oldName)
+	if !ok {
+		return fmt.Errorf("no such ref: %s", oldName)
+	}
+
+	// Deleting the ref deletes its reflog, keep it aside, and make sure it can be written back under the new name
+	entries, err := r.ReadReflog(oldName)
+	if err != nil {
+		return err
+	}
+	if err := r.checkReflogPath(oldName, newName); err != nil {
+		return err
+	}
+
+	tx := r.NewRefTransaction()
+	tx.Add(types.RefUpdate{Name: oldName, Old: sha, HaveOld: true, Delete: true, NoDeref: true})
+	tx.Add(types.RefUpdate{Name: newName, New: sha, HaveOld: true, NoDeref: true, Message: message})
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	logPath := r.GitPath("logs", newName)
+	if err := os.MkdirAll(filepath.Dir(logPath), constants.DefaultDirPerm); err != nil {
+		return err
+	}
+	if err := r.WriteReflog(newName, entries); err != nil {
+		return err
+	}
+	return r.AppendReflog(newName, sha, sha, message)
+}
+
+// checkReflogPath makes sure the reflog of oldName can move to newName : no other reflog file may stand where newName needs a directory, and no directory of other reflogs where its file goes.
+func (r *Repository) checkReflogPath(oldName, newName string) error {
+	parts := strings.Split(newName, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		if dir == oldName {
+			continue
+		}
+		if info, err := os.Stat(r.GitPath("logs", dir)); err == nil && !info.IsDir() {
+			return fmt.Errorf("cannot rename '%s' to '%s': the reflog of '%s' is in the way", oldName, newName, dir)
+		}
+	}
+	if info, err := os.Stat(r.GitPath("logs", newName)); err == nil && info.IsDir() && !strings.HasPrefix(oldName, newName+"/") {
+		return fmt.Errorf("cannot rename '%s' to '%s': there are reflogs below '%s'", oldName, newName, newName)
+	}
+	return nil
+}
+
+// PackRefs moves loose refs into .git/packed-refs : all of them, or only tags (and refs already packed) unless all is set. Annotated tags are stored with their peeled value. .git/packed-refs is locked from being read until it is written back. Unless prune is false, the loose files are deleted once packed (see pruneLooseRef).
+func (r *Repository) PackRefs(all bool, prune bool) error {
+	lock, err := Lock(r.GitPath("packed-refs"))
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	packed, err := r.ReadPackedRefs()
+	if err != nil {
+		return err
+	}
+	byName := map[string]types.PackedRef{}
+	for _, ref := range packed {
+		byName[ref.Name] = ref
+	}
+
+	// Loose refs to pack, loose values taking precedence over packed ones
+	loose, err := r.looseRefs()
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for name, sha := range loose {
+		if _, isPacked := byName[name]; !all && !isPacked && !strings.HasPrefix(name, "refs/tags/") {
+			continue
+		}
+		ref := types.PackedRef{Name: name, SHA: sha}
+		if objType, _, err := r.Objects.Read(sha); err == nil && objType == types.TagObject {
+			if ref.Peeled, err = r.PeelObject(sha, ""); err != nil {
+				return err
+			}
+		}
+		byName[name] = ref
+		names = append(names, name)
+	}
+
+	refs := make([]types.PackedRef, 0, len(byName))
+	for _, ref := range byName {
+		refs = append(refs, ref)
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	if err := lock.Write(encodePackedRefs(refs)); err != nil {
+		return err
+	}
+	if err := lock.Commit(); err != nil {
+		return err
+	}
+
+	// The packed values now stand for the loose files
+	if prune {
+		for _, name := range names {
+			if err := r.pruneLooseRef(name, byName[name].SHA); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneLooseRef deletes the loose file of a packed ref, under the lock of the ref, provided it still holds sha : a ref which moved since it was packed keeps its loose value, and a ref locked by another process is left alone.
+func (r *Repository) pruneLooseRef(name string, sha [20]byte) error {
+	refPath := r.GitPath(name)
+	lock, err := Lock(refPath)
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		lock.Rollback()
+		r.removeEmptyRefDirs(filepath.Dir(refPath))
+	}()
+
+	data, err := os.ReadFile(refPath)
+	if err != nil || strings.TrimSpace(string(data)) != hex.EncodeToString(sha[:]) {
+		return nil
+	}
+	if err := os.Remove(refPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// looseRefs walks .git/refs and returns every ref file that holds a SHA, keyed by its full name (e.g. refs/heads/master).
+func (r *Repository) looseRefs() (map[string][20]byte, error) {
+	refs := map[string][20]byte{}
+	refsDir := r.GitPath("refs")
+
+	err := filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip directories and lock files, only read refs
+		if d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+
+		// Read SHA value, ignore anything that is not a valid SHA
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		shaBytes, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(shaBytes) != 20 {
+			return nil
+		}
+
+		// Ref name relative to .git, always with forward slashes
+		rel, err := filepath.Rel(r.GitDir, path)
+		if err != nil {
+			return err
+		}
+		refs[filepath.ToSlash(rel)] = [20]byte(shaBytes)
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// removeEmptyRefDirs removes the directories left empty below .git/refs by a deleted ref, up to (and excluding) refs/heads, refs/tags and refs itself.
+func (r *Repository) removeEmptyRefDirs(dir string) {
+	keep := map[string]bool{r.GitPath("refs"): true, r.GitPath("refs", "heads"): true, r.GitPath("refs", "tags"): true}
+	for !keep[dir] && strings.HasPrefix(dir, r.GitPath("refs")) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
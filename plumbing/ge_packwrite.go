@@ -0,0 +1,450 @@
+package plumbing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+const (
+	DefaultPackWindow = 10 // number of preceding objects tried as delta bases
+	DefaultPackDepth  = 50 // maximum length of a delta chain
+
+	deltaBlockSize   = 16 // size of the blocks indexed in a delta base
+	deltaMaxBucket   = 64 // maximum candidate offsets remembered per block hash
+	deltaMinSize     = 64 // objects smaller than this are never deltified
+	deltaMaxCopySize = 0xffffff
+)
+
+// packObject is an object queued for writing into a packfile.
+type packObject struct {
+	info    types.ObjectInfo
+	content []byte
+
+	base   *packObject // delta base, nil if stored whole
+	delta  []byte      // delta against base
+	depth  int         // length of the delta chain ending at this object
+	offset int64       // offset in the packfile, once written
+	crc    uint32      // CRC32 of the raw packed bytes
+}
+
+// WritePack writes the given objects into a single packfile plus version 2 index under <objects>/pack, delta-compressing similar blobs and trees. Returns the pack checksum which also names the files.
+func (s *LooseObjectStore) WritePack(objects []types.ObjectInfo, window, depth int) ([20]byte, error) {
+
+	// Load every object's content
+	queue := make([]*packObject, 0, len(objects))
+	for _, info := range objects {
+		objType, content, err := s.Read(info.SHA)
+		if err != nil {
+			return [20]byte{}, fmt.Errorf("could not read object %x: %s", info.SHA, err)
+		}
+		info.Type = objType
+		queue = append(queue, &packObject{info: info, content: content})
+	}
+
+	// Pick delta bases, then write the pack in the same order so every base precedes its deltas
+	sortForDeltas(queue)
+	findDeltas(queue, window, depth)
+
+	packData, err := encodePack(queue)
+	if err != nil {
+		return [20]byte{}, err
+	}
+	packSHA := [20]byte(packData[len(packData)-20:])
+	idxData := encodePackIndex(queue, packSHA)
+
+	// Write .pack first and .idx last, so a reader never sees an index without its pack
+	packDir := filepath.Join(s.Dir, "pack")
+	if err := os.MkdirAll(packDir, constants.DefaultDirPerm); err != nil {
+		return [20]byte{}, err
+	}
+	base := filepath.Join(packDir, "pack-"+hex.EncodeToString(packSHA[:]))
+	if err := writeFileViaTemp(base+".pack", packData, 0o444); err != nil {
+		return [20]byte{}, err
+	}
+	if err := writeFileViaTemp(base+".idx", idxData, 0o444); err != nil {
+		return [20]byte{}, err
+	}
+
+	s.resetPacks()
+	return packSHA, nil
+}
+
+// sortForDeltas orders objects so that similar ones are next to each other : by type, file name, path, then size (largest first).
+func sortForDeltas(queue []*packObject) {
+	sort.SliceStable(queue, func(i, j int) bool {
+		a, b := queue[i], queue[j]
+		if a.info.Type != b.info.Type {
+			return a.info.Type < b.info.Type
+		}
+		if na, nb := path.Base(a.info.Path), path.Base(b.info.Path); na != nb {
+			return na < nb
+		}
+		if a.info.Path != b.info.Path {
+			return a.info.Path < b.info.Path
+		}
+		return len(a.content) > len(b.content)
+	})
+}
+
+// findDeltas tries the previous `window` objects of the same type as delta bases for each blob and tree, keeping the smallest delta.
+func findDeltas(queue []*packObject, window, depth int) {
+	for i, obj := range queue {
+		if obj.info.Type != types.BlobObject && obj.info.Type != types.TreeObject {
+			continue
+		}
+		if len(obj.content) < deltaMinSize {
+			continue
+		}
+
+		// Only accept deltas that save at least half of the object
+		bestSize := len(obj.content) / 2
+		for j := i - 1; j >= 0 && j >= i-window; j-- {
+			base := queue[j]
+			if base.info.Type != obj.info.Type || base.depth >= depth {
+				continue
+			}
+			if len(base.content) < deltaMinSize {
+				continue
+			}
+			delta := computeDelta(base.content, obj.content)
+			if len(delta) < bestSize {
+				bestSize = len(delta)
+				obj.base = base
+				obj.delta = delta
+				obj.depth = base.depth + 1
+			}
+		}
+	}
+}
+
+// computeDelta encodes target as a git delta (copy / insert instructions) against base.
+func computeDelta(base, target []byte) []byte {
+	out := appendDeltaVarint(nil, uint64(len(base)))
+	out = appendDeltaVarint(out, uint64(len(target)))
+
+	// Index every block of the base by its hash
+	index := map[uint64][]int{}
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		h := blockHash(base[i:])
+		if len(index[h]) < deltaMaxBucket {
+			index[h] = append(index[h], i)
+		}
+	}
+
+	pending := 0 // start of bytes not yet emitted
+	i := 0
+	for i+deltaBlockSize <= len(target) {
+
+		// Find the longest match for the block starting at i
+		bestOff, bestLen := 0, 0
+		for _, off := range index[blockHash(target[i:])] {
+			n := 0
+			for off+n < len(base) && i+n < len(target) && base[off+n] == target[i+n] {
+				n++
+			}
+			if n > bestLen {
+				bestOff, bestLen = off, n
+			}
+		}
+		if bestLen < deltaBlockSize {
+			i++
+			continue
+		}
+
+		// Grow the match backwards over bytes that would otherwise be inserted
+		for bestOff > 0 && i > pending && base[bestOff-1] == target[i-1] {
+			bestOff--
+			i--
+			bestLen++
+		}
+
+		out = appendDeltaInsert(out, target[pending:i])
+		out = appendDeltaCopy(out, bestOff, bestLen)
+		i += bestLen
+		pending = i
+	}
+	return appendDeltaInsert(out, target[pending:])
+}
+
+// blockHash hashes the first deltaBlockSize bytes of data.
+func blockHash(data []byte) uint64 {
+	a := binary.LittleEndian.Uint64(data)
+	b := binary.LittleEndian.Uint64(data[8:])
+	return a*0x9e3779b97f4a7c15 ^ b
+}
+
+// appendDeltaVarint appends a little-endian base-128 size as used in delta headers.
+func appendDeltaVarint(out []byte, value uint64) []byte {
+	for value >= 0x80 {
+		out = append(out, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(out, byte(value))
+}
+
+// appendDeltaInsert appends insert instructions (at most 127 literal bytes each).
+func appendDeltaInsert(out, data []byte) []byte {
+	for len(data) > 0 {
+		n := min(len(data), 0x7f)
+		out = append(out, byte(n))
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	return out
+}
+
+// appendDeltaCopy appends copy instructions, splitting copies larger than 24 bits.
+func appendDeltaCopy(out []byte, offset, size int) []byte {
+	for size > 0 {
+		n := min(size, deltaMaxCopySize)
+
+		op := byte(0x80)
+		args := []byte{}
+		for b := 0; b < 4; b++ {
+			if v := byte(offset >> (8 * b)); v != 0 {
+				op |= 1 << b
+				args = append(args, v)
+			}
+		}
+		for b := 0; b < 3; b++ {
+			if v := byte(n >> (8 * b)); v != 0 {
+				op |= 1 << (4 + b)
+				args = append(args, v)
+			}
+		}
+		out = append(out, op)
+		out = append(out, args...)
+
+		offset += n
+		size -= n
+	}
+	return out
+}
+
+// encodePack serializes the queued objects into packfile bytes, including the trailing checksum.
+func encodePack(queue []*packObject) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// 12-byte header: "PACK" + version(2) + object count
+	buf.WriteString("PACK")
+	buf.Write(binary.BigEndian.AppendUint32(nil, 2))
+	buf.Write(binary.BigEndian.AppendUint32(nil, uint32(len(queue))))
+
+	typeCodes := map[types.ObjectType]byte{}
+	for code, objType := range packObjectTypes {
+		typeCodes[objType] = code
+	}
+
+	for _, obj := range queue {
+		obj.offset = int64(buf.Len())
+
+		// Object header : type + inflated size, then the base offset for deltas
+		var raw []byte
+		data := obj.content
+		if obj.base != nil {
+			raw = appendPackObjectHeader(raw, packObjOfsDelta, uint64(len(obj.delta)))
+			raw = appendOfsDeltaOffset(raw, obj.offset-obj.base.offset)
+			data = obj.delta
+		} else {
+			code, ok := typeCodes[obj.info.Type]
+			if !ok {
+				return nil, fmt.Errorf("cannot pack object %x of type %s", obj.info.SHA, obj.info.Type)
+			}
+			raw = appendPackObjectHeader(raw, code, uint64(len(data)))
+		}
+
+		// Z-lib compressed body
+		var zbuf bytes.Buffer
+		w := zlib.NewWriter(&zbuf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		raw = append(raw, zbuf.Bytes()...)
+
+		obj.crc = crc32.ChecksumIEEE(raw)
+		buf.Write(raw)
+	}
+
+	// 20-byte SHA-1 checksum of all previous contents
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes(), nil
+}
+
+// appendPackObjectHeader appends the variable-length type + size header of a packed object.
+func appendPackObjectHeader(out []byte, typeCode byte, size uint64) []byte {
+	c := typeCode<<4 | byte(size&0x0f)
+	size >>= 4
+	for size > 0 {
+		out = append(out, c|0x80)
+		c = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(out, c)
+}
+
+// appendOfsDeltaOffset appends the negative base offset of an OFS_DELTA object.
+func appendOfsDeltaOffset(out []byte, rel int64) []byte {
+	enc := []byte{byte(rel & 0x7f)}
+	for rel >>= 7; rel > 0; rel >>= 7 {
+		rel--
+		enc = append([]byte{0x80 | byte(rel&0x7f)}, enc...)
+	}
+	return append(out, enc...)
+}
+
+// encodePackIndex builds the version 2 index for a written pack.
+func encodePackIndex(queue []*packObject, packSHA [20]byte) []byte {
+	sorted := make([]*packObject, len(queue))
+	copy(sorted, queue)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].info.SHA[:], sorted[j].info.SHA[:]) < 0
+	})
+
+	// Header : "\377tOc" + version(2)
+	buf := []byte{0xff, 't', 'O', 'c'}
+	buf = binary.BigEndian.AppendUint32(buf, 2)
+
+	// Fanout table
+	var fanout [256]uint32
+	for _, obj := range sorted {
+		fanout[obj.info.SHA[0]]++
+	}
+	total := uint32(0)
+	for i := range fanout {
+		total += fanout[i]
+		buf = binary.BigEndian.AppendUint32(buf, total)
+	}
+
+	// SHA table, CRC32 table
+	for _, obj := range sorted {
+		buf = append(buf, obj.info.SHA[:]...)
+	}
+	for _, obj := range sorted {
+		buf = binary.BigEndian.AppendUint32(buf, obj.crc)
+	}
+
+	// 31-bit offsets, spilling into the 64-bit table when they do not fit
+	large := []byte{}
+	for _, obj := range sorted {
+		if obj.offset < 0x80000000 {
+			buf = binary.BigEndian.AppendUint32(buf, uint32(obj.offset))
+		} else {
+			buf = binary.BigEndian.AppendUint32(buf, 0x80000000|uint32(len(large)/8))
+			large = binary.BigEndian.AppendUint64(large, uint64(obj.offset))
+		}
+	}
+	buf = append(buf, large...)
+
+	// Pack checksum, then the checksum of the index itself
+	buf = append(buf, packSHA[:]...)
+	sum := sha1.Sum(buf)
+	return append(buf, sum[:]...)
+}
+
+// PackNames returns the checksums (hex) of all packs present in <objects>/pack.
+func (s *LooseObjectStore) PackNames() ([]string, error) {
+	idxPaths, err := filepath.Glob(filepath.Join(s.Dir, "pack", "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, p := range idxPaths {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(p), "pack-"), ".idx")
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RemovePack deletes the .pack and .idx files of the named pack.
+func (s *LooseObjectStore) RemovePack(name string) error {
+	s.resetPacks()
+
+	base := filepath.Join(s.Dir, "pack", "pack-"+name)
+	for _, ext := range []string{".idx", ".pack"} {
+		if err := os.Remove(base + ext); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// PackObjects returns the objects stored in the named pack, along with the last modification time of its packfile.
+func (s *LooseObjectStore) PackObjects(name string) ([][20]byte, time.Time, error) {
+	base := filepath.Join(s.Dir, "pack", "pack-"+name)
+	info, err := os.Stat(base + ".pack")
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	idx, err := readPackIndex(base + ".idx")
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	shas := make([][20]byte, 0, idx.count)
+	for i := 0; i < idx.count; i++ {
+		shas = append(shas, idx.shaAt(i))
+	}
+	return shas, info.ModTime(), nil
+}
+
+// LoosenObject writes a packed object as a loose object last modified at mtime, so that it keeps the age of its pack. An existing loose copy is left as it is.
+func (s *LooseObjectStore) LoosenObject(sha [20]byte, mtime time.Time) error {
+	path := s.loosePath(sha)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	objType, content, err := s.readPacked(sha)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(sha, objType, content); err != nil {
+		return err
+	}
+	return os.Chtimes(path, mtime, mtime)
+}
+
+// RemovePackedLooseObjects deletes loose objects that are also stored in a pack. Returns the number of objects removed.
+func (s *LooseObjectStore) RemovePackedLooseObjects() (int, error) {
+
+	// Collect first, so the fan-out directories are not modified while being read
+	redundant := [][20]byte{}
+	if err := s.iterateLoose(func(sha [20]byte) error {
+		if s.HasPacked(sha) {
+			redundant = append(redundant, sha)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, sha := range redundant {
+		path := s.loosePath(sha)
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed++
+
+		// Remove the fan-out directory once it is empty, ignore failure if it is not
+		_ = os.Remove(filepath.Dir(path))
+	}
+	return removed, nil
+}
@@ -0,0 +1,150 @@
+package plumbing
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	base := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 200)
+	edited := bytes.Clone(base)
+	copy(edited[4000:], "EDITED")
+
+	tests := []struct {
+		name   string
+		base   []byte
+		target []byte
+	}{
+		{"identical", base, base},
+		{"appended", base, append(bytes.Clone(base), "one more line\n"...)},
+		{"prepended", base, append([]byte("first line\n"), base...)},
+		{"edited in the middle", base, edited},
+		{"truncated", base, base[:1000]},
+		{"unrelated", []byte("short base"), bytes.Repeat([]byte{'x'}, 300)},
+		{"empty target", base, []byte{}},
+		{"empty base", []byte{}, []byte("some content")},
+		{"copy larger than 64 KiB", bytes.Repeat(base, 10), bytes.Repeat(base, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := computeDelta(tt.base, tt.target)
+			got, err := applyDelta(tt.base, delta)
+			if err != nil {
+				t.Fatalf("applyDelta: %s", err)
+			}
+			if !bytes.Equal(got, tt.target) {
+				t.Fatalf("applyDelta gave %d bytes, want the %d bytes of the target", len(got), len(tt.target))
+			}
+		})
+	}
+}
+
+func TestApplyDeltaRejectsCorruptDeltas(t *testing.T) {
+	base := []byte("0123456789")
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{"empty", []byte{}},
+		{"wrong base size", []byte{9, 2, 0x02, 'a', 'b'}},
+		{"truncated insert", []byte{10, 4, 0x04, 'a'}},
+		{"truncated copy", []byte{10, 4, 0x91}},
+		{"copy out of bounds", []byte{10, 4, 0x91, 8, 4}},
+		{"opcode 0", []byte{10, 1, 0x00}},
+		{"wrong result size", []byte{10, 3, 0x02, 'a', 'b'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := applyDelta(base, tt.delta); err == nil {
+				t.Fatalf("applyDelta gave %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestPackIndexRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets []int64
+	}{
+		{"empty", nil},
+		{"single object", []int64{12}},
+		{"several objects", []int64{12, 340, 1024, 99999}},
+		{"large offsets", []int64{12, 0x7fffffff, 0x80000000, 0x123456789}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := []*packObject{}
+			for i, offset := range tt.offsets {
+				sha := sha1.Sum([]byte(fmt.Sprintf("object %d", i)))
+				queue = append(queue, &packObject{info: types.ObjectInfo{SHA: sha}, offset: offset, crc: uint32(i)})
+			}
+			path := filepath.Join(t.TempDir(), "pack.idx")
+			if err := os.WriteFile(path, encodePackIndex(queue, sha1.Sum([]byte("pack"))), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			idx, err := readPackIndex(path)
+			if err != nil {
+				t.Fatalf("readPackIndex: %s", err)
+			}
+			if idx.count != len(queue) {
+				t.Fatalf("count = %d, want %d", idx.count, len(queue))
+			}
+			for _, obj := range queue {
+				offset, ok := idx.find(obj.info.SHA)
+				if !ok || offset != obj.offset {
+					t.Errorf("find(%x) = %d, %v, want %d, true", obj.info.SHA, offset, ok, obj.offset)
+				}
+			}
+			for i := 1; i < idx.count; i++ {
+				prev, cur := idx.shaAt(i-1), idx.shaAt(i)
+				if bytes.Compare(prev[:], cur[:]) >= 0 {
+					t.Errorf("shaAt(%d) = %x is not after %x", i, cur, prev)
+				}
+			}
+			if _, ok := idx.find(sha1.Sum([]byte("missing"))); ok {
+				t.Errorf("find found an object which is not in the pack")
+			}
+		})
+	}
+}
+
+func TestWritePackReadsBackEveryObject(t *testing.T) {
+	store := NewLooseObjectStore(t.TempDir())
+	base := bytes.Repeat([]byte("a line of some file which keeps on going\n"), 50)
+
+	objects := []types.ObjectInfo{}
+	contents := map[[20]byte][]byte{}
+	for i := 0; i < 5; i++ {
+		content := append(bytes.Clone(base), fmt.Sprintf("version %d\n", i)...)
+		sha, err := HashObject(types.BlobObject, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Write(sha, types.BlobObject, content); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, types.ObjectInfo{SHA: sha, Path: "file.txt"})
+		contents[sha] = content
+	}
+
+	if _, err := store.WritePack(objects, DefaultPackWindow, DefaultPackDepth); err != nil {
+		t.Fatalf("WritePack: %s", err)
+	}
+	for sha, content := range contents {
+		objType, got, err := store.readPacked(sha)
+		if err != nil {
+			t.Fatalf("readPacked(%x): %s", sha, err)
+		}
+		if objType != types.BlobObject || !bytes.Equal(got, content) {
+			t.Errorf("readPacked(%x) = %s %q, want blob %q", sha, objType, got, content)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package plumbing
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// DefaultPruneExpire is the grace period of unreachable objects when gc.pruneExpire is not set.
+const DefaultPruneExpire = "2.weeks.ago"
+
+// PruneLooseObjects deletes the loose objects which are not in keep and were last modified before expire, along with temporary object files left behind by interrupted writes. Packed objects are left alone. With dryRun, nothing is deleted. Returns the objects pruned (or which would be), with an empty type for the ones which can't be read.
+func (s *LooseObjectStore) PruneLooseObjects(keep map[[20]byte]bool, expire time.Time, dryRun bool) ([]types.ObjectInfo, error) {
+
+	// Collect first, so the fan-out directories are not modified while being read
+	expired := []types.ObjectInfo{}
+	if err := s.iterateLoose(func(sha [20]byte) error {
+		if keep[sha] {
+			return nil
+		}
+		info, err := os.Stat(s.loosePath(sha))
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(expire) {
+			objType, _, _ := s.Read(sha)
+			expired = append(expired, types.ObjectInfo{SHA: sha, Type: objType})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return expired, nil
+	}
+
+	for _, obj := range expired {
+		path := s.loosePath(obj.SHA)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		// Remove the fan-out directory once it is empty, ignore failure if it is not
+		_ = os.Remove(filepath.Dir(path))
+	}
+	return expired, s.pruneTempFiles(expire)
+}
+
+// RecentLooseObjects returns the loose objects which are not in keep and were last modified at or after expire, i.e. the unreachable ones PruneLooseObjects leaves alone.
+func (s *LooseObjectStore) RecentLooseObjects(keep map[[20]byte]bool, expire time.Time) ([][20]byte, error) {
+	recent := [][20]byte{}
+	err := s.iterateLoose(func(sha [20]byte) error {
+		if keep[sha] {
+			return nil
+		}
+		info, err := os.Stat(s.loosePath(sha))
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Before(expire) {
+			recent = append(recent, sha)
+		}
+		return nil
+	})
+	return recent, err
+}
+
+// pruneTempFiles deletes the temporary files of loose object writes (see writeFileViaTemp) last modified before expire. Recent ones may belong to a write still running.
+func (s *LooseObjectStore) pruneTempFiles(expire time.Time) error {
+	tmpFiles, err := filepath.Glob(filepath.Join(s.Dir, "??", "tmp_*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range tmpFiles {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Before(expire) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		_ = os.Remove(filepath.Dir(path))
+	}
+	return nil
+}
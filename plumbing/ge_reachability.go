@@ -0,0 +1,113 @@
+package plumbing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// ReachableObjects walks the object graph from the given roots (commits, trees, blobs or tags) and returns every object found, each exactly once, in discovery order.
+func (r *Repository) ReachableObjects(roots [][20]byte) ([]types.ObjectInfo, error) {
+	return r.walkObjects(roots, false)
+}
+
+// ReachableObjectsSkipMissing walks the object graph like ReachableObjects, but skips the objects which are missing or can't be read instead of failing : unreachable objects may point to objects already pruned.
+func (r *Repository) ReachableObjectsSkipMissing(roots [][20]byte) ([]types.ObjectInfo, error) {
+	return r.walkObjects(roots, true)
+}
+
+// walkObjects does the walk of ReachableObjects, skipping unreadable objects with skipMissing.
+func (r *Repository) walkObjects(roots [][20]byte, skipMissing bool) ([]types.ObjectInfo, error) {
+	seen := map[[20]byte]bool{}
+	result := []types.ObjectInfo{}
+
+	// Stack of objects still to visit
+	stack := make([]types.ObjectInfo, 0, len(roots))
+	for i := len(roots) - 1; i >= 0; i-- {
+		stack = append(stack, types.ObjectInfo{SHA: roots[i]})
+	}
+
+	for len(stack) > 0 {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if seen[curr.SHA] {
+			continue
+		}
+		seen[curr.SHA] = true
+
+		// Read Object to learn its type and children
+		objType, content, err := r.ReadObject(hex.EncodeToString(curr.SHA[:]))
+		if err != nil {
+			if skipMissing {
+				continue
+			}
+			return nil, fmt.Errorf("missing object %x: %s", curr.SHA, err)
+		}
+		curr.Type = objType
+		result = append(result, curr)
+
+		switch objType {
+		case types.CommitObject:
+			// Parents first, then the root tree so that it is visited next
+			commit, err := r.ReadCommit(curr.SHA)
+			if err != nil {
+				if skipMissing {
+					continue
+				}
+				return nil, err
+			}
+			for i := len(commit.ParentsSHA) - 1; i >= 0; i-- {
+				stack = append(stack, types.ObjectInfo{SHA: commit.ParentsSHA[i]})
+			}
+			stack = append(stack, types.ObjectInfo{SHA: commit.TreeSHA})
+
+		case types.TreeObject:
+			// Every entry in the tree, keeping the path as a hint for delta compression
+			entries, err := r.ReadTreeCurrentLevel(hex.EncodeToString(curr.SHA[:]))
+			if err != nil {
+				if skipMissing {
+					continue
+				}
+				return nil, err
+			}
+			for i := len(entries) - 1; i >= 0; i-- {
+				if entries[i].Mode == constants.ModeGitlink {
+					continue // submodule commit, from another repository
+				}
+				path := entries[i].Name
+				if curr.Path != "" {
+					path = curr.Path + "/" + entries[i].Name
+				}
+				stack = append(stack, types.ObjectInfo{SHA: entries[i].SHA, Path: path})
+			}
+
+		case types.BlobObject:
+			// Leaf, nothing to do
+
+		case types.TagObject:
+			// Annotated tag : "object <sha>" is the first header line
+			if target, ok := tagTarget(content); ok {
+				stack = append(stack, types.ObjectInfo{SHA: target})
+			}
+		}
+	}
+	return result, nil
+}
+
+// tagTarget extracts the SHA from the "object <sha>" header of a tag object.
+func tagTarget(content []byte) ([20]byte, bool) {
+	line, _, _ := bytes.Cut(content, []byte("\n"))
+	shaHex, ok := bytes.CutPrefix(line, []byte("object "))
+	if !ok {
+		return [20]byte{}, false
+	}
+	shaBytes, err := hex.DecodeString(string(shaHex))
+	if err != nil || len(shaBytes) != 20 {
+		return [20]byte{}, false
+	}
+	return [20]byte(shaBytes), true
+}
@@ -0,0 +1,324 @@
+package plumbing
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brickster241/GitEngine/utils"
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// ReadReflog reads the reflog of a ref (e.g. refs/heads/master or HEAD) from .git/logs, oldest entry first. A ref without reflog has no entries.
+func (r *Repository) ReadReflog(refName string) ([]types.ReflogEntry, error) {
+	data, err := os.ReadFile(r.GitPath("logs", refName))
+	if errors.Is(err, os.ErrNotExist) {
+		return []types.ReflogEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := []types.ReflogEntry{}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		entry, err := parseReflogLine(line)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// parseReflogLine parses "<old sha> <new sha> <name> <<email>> <timestamp> <timezone>\t<message>".
+func parseReflogLine(line string) (types.ReflogEntry, error) {
+	header, message, _ := strings.Cut(line, "\t")
+	if len(header) < 82 || header[40] != ' ' || header[81] != ' ' {
+		return types.ReflogEntry{}, fmt.Errorf("invalid reflog entry: %s", line)
+	}
+
+	oldSHA, errOld := hex.DecodeString(header[:40])
+	newSHA, errNew := hex.DecodeString(header[41:81])
+	if errOld != nil || errNew != nil {
+		return types.ReflogEntry{}, fmt.Errorf("invalid reflog entry: %s", line)
+	}
+	return types.ReflogEntry{
+		Old:       [20]byte(oldSHA),
+		New:       [20]byte(newSHA),
+		Committer: ParseSignature(header[82:]),
+		Message:   message,
+	}, nil
+}
+
+// ReflogNames returns the names of the refs which have a reflog under .git/logs (e.g. HEAD, refs/heads/master).
+func (r *Repository) ReflogNames() ([]string, error) {
+	names := []string{}
+	err := filepath.WalkDir(r.GitPath("logs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return err
+		}
+		rel, err := filepath.Rel(r.GitPath("logs"), path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Expiry of reflog entries when gc.reflogExpire and gc.reflogExpireUnreachable are not set
+const (
+	DefaultReflogExpire            = "90.days.ago"
+	DefaultReflogExpireUnreachable = "30.days.ago"
+)
+
+// formatReflogLine is the inverse of parseReflogLine. Messages are kept on a single line.
+func formatReflogLine(entry types.ReflogEntry) string {
+	line := fmt.Sprintf("%x %x %s", entry.Old, entry.New, FormatSignature(entry.Committer))
+	if message := strings.Join(strings.Fields(entry.Message), " "); message != "" {
+		line += "\t" + message
+	}
+	return line + "\n"
+}
+
+// shouldLogRef reports whether updates of a ref are recorded in its reflog, as core.logAllRefUpdates asks : HEAD and branches by default, every ref with "always", none with "false". A ref which already has a reflog is always logged.
+func (r *Repository) shouldLogRef(refName string) bool {
+	if _, err := os.Stat(r.GitPath("logs", refName)); err == nil {
+		return true
+	}
+	value, err := r.GetConfig("core.logAllRefUpdates")
+	if err != nil {
+		value = "true"
+	}
+	switch strings.ToLower(value) {
+	case "always":
+		return true
+	case "true":
+		return refName == "HEAD" || strings.HasPrefix(refName, "refs/heads/") || strings.HasPrefix(refName, "refs/remotes/") || strings.HasPrefix(refName, "refs/notes/")
+	}
+	return false
+}
+
+// AppendReflog records in the reflog of a ref (e.g. refs/heads/master or HEAD) that it moved from oldSHA to newSHA, by the configured user and now. The reflog is locked while the entry is appended, so that it doesn't get lost to an expiry rewriting the reflog.
+func (r *Repository) AppendReflog(refName string, oldSHA, newSHA [20]byte, message string) error {
+	if !r.shouldLogRef(refName) {
+		return nil
+	}
+
+	// Identity of whoever moved the ref, missing parts are left empty
+	committer := types.Author{When: time.Now()}
+	committer.Name, _ = r.GetConfig("user.name")
+	committer.Email, _ = r.GetConfig("user.email")
+
+	logPath := r.GitPath("logs", refName)
+	if err := os.MkdirAll(filepath.Dir(logPath), constants.DefaultDirPerm); err != nil {
+		return err
+	}
+	lock, err := Lock(logPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, constants.DefaultFilePerm)
+	if err != nil {
+		return err
+	}
+	entry := types.ReflogEntry{Old: oldSHA, New: newSHA, Committer: committer, Message: message}
+	if _, err := f.WriteString(formatReflogLine(entry)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteReflog replaces the reflog of a ref with the given entries, oldest first.
+func (r *Repository) WriteReflog(refName string, entries []types.ReflogEntry) error {
+	return WriteFileLocked(r.GitPath("logs", refName), encodeReflog(entries))
+}
+
+// encodeReflog returns the content of a reflog holding the given entries, oldest first.
+func encodeReflog(entries []types.ReflogEntry) []byte {
+	var sb strings.Builder
+	for _, entry := range entries {
+		sb.WriteString(formatReflogLine(entry))
+	}
+	return []byte(sb.String())
+}
+
+// CopyReflog gives a copy of a ref the history of the original.
+func (r *Repository) CopyReflog(oldName, newName string) error {
+	entries, err := r.ReadReflog(oldName)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	newPath := r.GitPath("logs", newName)
+	if err := os.MkdirAll(filepath.Dir(newPath), constants.DefaultDirPerm); err != nil {
+		return err
+	}
+	return r.WriteReflog(newName, entries)
+}
+
+// DeleteReflog removes the reflog of a ref, when the ref itself is deleted, along with the directories it leaves empty.
+func (r *Repository) DeleteReflog(refName string) error {
+	logPath := r.GitPath("logs", refName)
+	if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := filepath.Dir(logPath); strings.HasPrefix(dir, r.GitPath("logs", "refs")+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// ExpireReflog drops the entries of a reflog older than expire, and the ones older than expireUnreachable whose commit is not reachable from the current value of the ref. The reflog is locked from being read until it is written back, entries can't be appended in between. With dryRun, the reflog is left untouched. Returns the number of entries dropped (or which would be).
+func (r *Repository) ExpireReflog(refName string, expire, expireUnreachable time.Time, dryRun bool) (int, error) {
+	if _, err := os.Stat(r.GitPath("logs", refName)); errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	lock, err := Lock(r.GitPath("logs", refName))
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Rollback()
+	entries, err := r.ReadReflog(refName)
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	// Commits reachable from the tip, only needed when unreachable entries expire sooner
+	reachable := map[[20]byte]bool{}
+	if expireUnreachable.After(expire) {
+		if tip, ok := r.resolveRefName(refName); ok {
+			if reachable, err = r.ancestors([][20]byte{tip}); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	kept := []types.ReflogEntry{}
+	for _, entry := range entries {
+		when := entry.Committer.When
+		if when.Before(expire) || (when.Before(expireUnreachable) && !reachable[entry.New]) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+
+	dropped := len(entries) - len(kept)
+	if dryRun || dropped == 0 {
+		return dropped, nil
+	}
+	if err := lock.Write(encodeReflog(kept)); err != nil {
+		return 0, err
+	}
+	return dropped, lock.Commit()
+}
+
+// resolveRefName reads the current value of a ref by its full name, HEAD included.
+func (r *Repository) resolveRefName(refName string) ([20]byte, bool) {
+	if refName == "HEAD" {
+		head, err := r.ReadHEADInfo()
+		if err != nil || head.SHA == [20]byte{} {
+			return [20]byte{}, false
+		}
+		return head.SHA, true
+	}
+	return r.ReadRef(refName)
+}
+
+// ReflogRefName returns the full name of the ref whose reflog "<name>@{...}" refers to : HEAD for "HEAD", the current branch for "", else the branch, or the ref itself when given in full.
+func (r *Repository) ReflogRefName(name string) (string, error) {
+	switch {
+	case name == "HEAD" || strings.HasPrefix(name, "refs/"):
+		return name, nil
+	case name == "":
+		head, err := r.ReadHEADInfo()
+		if err != nil {
+			return "", err
+		}
+		if head.Detached {
+			return "HEAD", nil
+		}
+		return "refs/heads/" + head.Branch, nil
+	}
+	return "refs/heads/" + name, nil
+}
+
+// ResolveReflog resolves "<name>@{<spec>}" : the value of the ref <spec> moves ago when <spec> is a number, or at the date <spec> otherwise.
+func (r *Repository) ResolveReflog(name, spec string) ([20]byte, error) {
+	refName, err := r.ReflogRefName(name)
+	if err != nil {
+		return [20]byte{}, err
+	}
+	entries, err := r.ReadReflog(refName)
+	if err != nil {
+		return [20]byte{}, err
+	}
+	if len(entries) == 0 {
+		return [20]byte{}, fmt.Errorf("log for '%s' is empty", strings.TrimPrefix(refName, "refs/heads/"))
+	}
+
+	// <name>@{<n>}, counted from the newest entry
+	if n, err := strconv.Atoi(spec); err == nil && n >= 0 {
+		if n >= len(entries) {
+			return [20]byte{}, fmt.Errorf("log for '%s' only has %d entries", strings.TrimPrefix(refName, "refs/heads/"), len(entries))
+		}
+		return entries[len(entries)-1-n].New, nil
+	}
+
+	// <name>@{<date>}, the newest entry made at that date or before
+	date, err := utils.ParseDate(spec, time.Now())
+	if err != nil {
+		return [20]byte{}, fmt.Errorf("invalid reflog selector: %s@{%s}", name, spec)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Committer.When.After(date) {
+			return entries[i].New, nil
+		}
+	}
+
+	// Before the reflog starts, the ref had its oldest known value
+	if entries[0].Old != ([20]byte{}) {
+		return entries[0].Old, nil
+	}
+	return entries[0].New, nil
+}
+
+// PreviousBranch returns the branch (or the commit, if HEAD was detached) checked out before the n-th last checkout, which "@{-<n>}" refers to.
+func (r *Repository) PreviousBranch(n int) (string, error) {
+	entries, err := r.ReadReflog("HEAD")
+	if err != nil {
+		return "", err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		moves, ok := strings.CutPrefix(entries[i].Message, "checkout: moving from ")
+		if !ok {
+			continue
+		}
+		from, _, found := strings.Cut(moves, " to ")
+		if !found {
+			continue
+		}
+		if n--; n == 0 {
+			return from, nil
+		}
+	}
+	return "", fmt.Errorf("no previous branch to switch to")
+}
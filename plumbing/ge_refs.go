@@ -4,37 +4,33 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
-	"github.com/brickster241/GitEngine/utils/constants"
 	"github.com/brickster241/GitEngine/utils/types"
 )
 
 // ReadHEADInfo reads .git/HEAD and determines whether HEAD is detached. It returns: ref path (if symbolic), commit SHA (if detached), detached flag
-func ReadHEADInfo() (*types.HeadInfo, error) {
-	data, err := os.ReadFile(filepath.Join(".git", "HEAD"))
+func (r *Repository) ReadHEADInfo() (*types.HeadInfo, error) {
+	data, err := os.ReadFile(r.GitPath("HEAD"))
 	if err != nil {
 		return nil, err
 	}
 
 	line := strings.TrimSpace(string(data))
 
-	// Case 1: Symbolic HEAD
-	if strings.HasPrefix(line, "ref: refs/heads/") {
-
-		branch := strings.TrimPrefix(line, "ref: refs/heads/")
-
-		sha, exists := ReadBranchRef(branch)
-
-		if !exists {
-			return &types.HeadInfo{
-				Branch:   branch,
-				Detached: false,
-				SHA:      [20]byte{},
-			}, nil
+	// Case 1: Symbolic HEAD, possibly through more symbolic refs, ending on a branch
+	if _, isSymbolic := r.ReadSymbolicRef("HEAD"); isSymbolic {
+		refName, err := r.ResolveSymbolicRef("HEAD")
+		if err != nil {
+			return nil, err
+		}
+		branch, isBranch := strings.CutPrefix(refName, "refs/heads/")
+		if !isBranch {
+			return nil, fmt.Errorf("HEAD points outside of refs/heads/ : %s", refName)
 		}
 
+		// An unborn branch has no SHA yet
+		sha, _ := r.ReadBranchRef(branch)
 		return &types.HeadInfo{
 			Branch:   branch,
 			Detached: false,
@@ -57,71 +53,87 @@ func ReadHEADInfo() (*types.HeadInfo, error) {
 	}, nil
 }
 
-// ReadBranchRef reads a branch name (e.g. master). Returns: SHA, exists flag (false if branch does not exist)
-func ReadBranchRef(branch string) ([20]byte, bool) {
-	data, err := os.ReadFile(filepath.Join(".git", "refs", "heads", branch))
-	if err != nil {
-		return [20]byte{}, false
-	}
-
-	// Read SHA value
-	line := strings.TrimSpace(string(data))
-	shaBytes, err := hex.DecodeString(line)
-	if err != nil || len(shaBytes) != 20 {
-		return [20]byte{}, false
-	}
-
-	// Copy SHA bytes
-	var sha [20]byte
-	copy(sha[:], shaBytes)
-	return sha, true
-
+// ReadBranchRef reads a branch name (e.g. master), from its loose file or else from .git/packed-refs, following it when symbolic. Returns: SHA, exists flag (false if branch does not exist)
+func (r *Repository) ReadBranchRef(branch string) ([20]byte, bool) {
+	return r.ReadRef("refs/heads/" + branch)
 }
 
-// UpdateBranchRefWithSHA updates a branch ref to point to the given SHA. This is used during commit when HEAD is not detached.
-func UpdateBranchRefWithSHA(branch string, sha [20]byte) error {
-	refPath := filepath.Join(".git", "refs", "heads", branch)
-
-	// Create directory and file
-	if err := os.MkdirAll(filepath.Dir(refPath), constants.DefaultDirPerm); err != nil {
-		return err
-	}
-
-	// Update the file with SHA
-	return os.WriteFile(
-		refPath,
-		[]byte(fmt.Sprintf("%x\n", sha)),
-		constants.DefaultFilePerm,
-	)
+// UpdateBranchRefWithSHA moves a branch from oldSHA (zero for an unborn branch) to sha, failing if the branch moved in the meantime. This is used during commit when HEAD is not detached. The move is recorded with message in the reflogs of the branch, and of HEAD when it is on that branch.
+func (r *Repository) UpdateBranchRefWithSHA(branch string, sha, oldSHA [20]byte, message string) error {
+	tx := r.NewRefTransaction()
+	tx.Update("refs/heads/"+branch, sha, oldSHA, true, message)
+	return tx.Commit()
 }
 
-// UpdateHEADDetached moves HEAD directly to a commit SHA. Used ONLY when HEAD is detached.
-func UpdateHEADDetached(sha [20]byte) error {
-
-	// Write SHA to file
-	return os.WriteFile(
-		filepath.Join(".git", "HEAD"),
-		[]byte(fmt.Sprintf("%x\n", sha)),
-		constants.DefaultFilePerm,
-	)
+// UpdateHEADDetached moves HEAD directly from oldSHA to a commit SHA, recording the move with message in the reflog of HEAD. Used ONLY when HEAD is detached.
+func (r *Repository) UpdateHEADDetached(sha, oldSHA [20]byte, message string) error {
+	tx := r.NewRefTransaction()
+	tx.Add(types.RefUpdate{Name: "HEAD", New: sha, Old: oldSHA, HaveOld: true, NoDeref: true, Message: message})
+	return tx.Commit()
 }
 
-// CreateBranchRef creates a new branch reference under .git/refs/heads/<name> pointing to the given commit SHA. It fails if the branch already exists.
-func CreateBranchRef(branch string, sha [20]byte) error {
+// CreateBranchRef creates a new branch reference under .git/refs/heads/<name> pointing to the given commit SHA, starting its reflog with message. It fails if the branch already exists.
+func (r *Repository) CreateBranchRef(branch string, sha [20]byte, message string) error {
 
 	// Check whether the branch actually already exists
-	_, exists := ReadBranchRef(branch)
+	_, exists := r.ReadBranchRef(branch)
 	if exists {
 		return fmt.Errorf("a branch named '%s' already exists\n", branch)
 	}
 
-	// Create refPath, and hexSHA content to be written
-	refPath := filepath.Join(".git", "refs", "heads", branch)
-	hexSHA := hex.EncodeToString(sha[:]) + "\n"
+	tx := r.NewRefTransaction()
+	tx.Create("refs/heads/"+branch, sha, message)
+	return tx.Commit()
+}
+
+// ListRefs returns every ref that holds a SHA, keyed by its full name (e.g. refs/heads/master) : the loose refs under .git/refs, the packed refs they don't override, and the symbolic refs with the value they resolve to.
+func (r *Repository) ListRefs() (map[string][20]byte, error) {
+	refs, err := r.looseRefs()
+	if err != nil {
+		return nil, err
+	}
+	packed, err := r.ReadPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range packed {
+		if _, isLoose := refs[ref.Name]; !isLoose {
+			refs[ref.Name] = ref.SHA
+		}
+	}
+	for _, name := range r.symbolicRefs() {
+		if sha, exists := r.ReadRef(name); exists {
+			refs[name] = sha
+		}
+	}
+	return refs, nil
+}
+
+// ReadRef reads a ref by its name relative to the git directory, such as refs/heads/master, ORIG_HEAD or MERGE_HEAD, following symbolic refs. Only the first line is used. Refs under refs/ are looked up in .git/packed-refs when they have no loose file. Returns: SHA, exists flag
+func (r *Repository) ReadRef(name string) ([20]byte, bool) {
+	name, err := r.ResolveSymbolicRef(name)
+	if err != nil {
+		return [20]byte{}, false
+	}
+	data, err := os.ReadFile(r.GitPath(name))
+	if err != nil {
+		if strings.HasPrefix(name, "refs/") {
+			return r.readPackedRef(name)
+		}
+		return [20]byte{}, false
+	}
 
-	// Ensure parent directories exist (for nested branch names)
-	if err := os.MkdirAll(filepath.Dir(refPath), constants.DefaultDirPerm); err != nil {
-		return err
+	line, _, _ := strings.Cut(string(data), "\n")
+	shaBytes, err := hex.DecodeString(strings.TrimSpace(line))
+	if err != nil || len(shaBytes) != 20 {
+		return [20]byte{}, false
 	}
-	return os.WriteFile(refPath, []byte(hexSHA), constants.DefaultFilePerm)
+	return [20]byte(shaBytes), true
+}
+
+// UpdatePseudoRef writes a ref living directly in the git directory, such as ORIG_HEAD.
+func (r *Repository) UpdatePseudoRef(name string, sha [20]byte) error {
+	tx := r.NewRefTransaction()
+	tx.Update(name, sha, [20]byte{}, false, "")
+	return tx.Commit()
 }
@@ -0,0 +1,401 @@
+package plumbing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// RefTransaction batches updates of several refs, which either all happen or none does. Every ref is locked and checked against the value it is expected to hold before anything is written, so that a ref which moved in the meantime fails the whole transaction instead of being overwritten.
+type RefTransaction struct {
+	repo    *Repository
+	updates []types.RefUpdate
+}
+
+// lockedRef is a ref held by a transaction being committed.
+type lockedRef struct {
+	update   types.RefUpdate
+	path     string    // loose file of the ref
+	lock     *LockFile // nil once released, or until taken for a ref below a ref deleted by the same transaction
+	deferred bool      // below a ref deleted by the same transaction (a/b replacing a), locked once that ref is gone
+	old      [20]byte  // value before the transaction, zero if the ref didn't exist
+	exists   bool
+	oldLoose []byte // content of the loose file before the transaction, nil if there was none, to restore it on failure
+	logHEAD  bool   // HEAD is on this branch, its reflog records the move too
+	symref   string // symbolic ref (other than HEAD) the update went through, its reflog records the move too
+}
+
+// NewRefTransaction starts an empty ref transaction.
+func (r *Repository) NewRefTransaction() *RefTransaction {
+	return &RefTransaction{repo: r}
+}
+
+// Add queues an update of any kind (see types.RefUpdate).
+func (t *RefTransaction) Add(update types.RefUpdate) {
+	t.updates = append(t.updates, update)
+}
+
+// Create queues the creation of a ref pointing to sha. It fails if the ref already exists.
+func (t *RefTransaction) Create(name string, sha [20]byte, message string) {
+	t.Add(types.RefUpdate{Name: name, New: sha, HaveOld: true, Message: message})
+}
+
+// Update queues setting a ref to newSHA. With haveOld, the ref must hold oldSHA, or not exist when oldSHA is zero.
+func (t *RefTransaction) Update(name string, newSHA, oldSHA [20]byte, haveOld bool, message string) {
+	t.Add(types.RefUpdate{Name: name, New: newSHA, Old: oldSHA, HaveOld: haveOld, Message: message})
+}
+
+// Delete queues the deletion of a ref, loose and packed, along with its reflog. With haveOld, the ref must hold oldSHA.
+func (t *RefTransaction) Delete(name string, oldSHA [20]byte, haveOld bool) {
+	t.Add(types.RefUpdate{Name: name, Old: oldSHA, HaveOld: haveOld, Delete: true})
+}
+
+// Verify queues a check that a ref holds oldSHA, or doesn't exist when oldSHA is zero, leaving it as it is.
+func (t *RefTransaction) Verify(name string, oldSHA [20]byte) {
+	t.Add(types.RefUpdate{Name: name, Old: oldSHA, HaveOld: true, Verify: true})
+}
+
+// Commit applies the queued updates. Every ref is locked and checked first : when one can't be locked, doesn't hold its expected value or would point to a missing object, every lock is released and nothing has changed. Deleted refs are removed from .git/packed-refs too, under its own lock. Only once everything is prepared are the new values moved into place, and should one of these moves fail, the refs already changed get their old content back. The window left is the process dying in the middle of the moves, which leaves the refs half updated, like git. The reflogs are updated last, once every ref is in place, and are not rolled back.
+func (t *RefTransaction) Commit() error {
+	r := t.repo
+	head, err := r.ReadHEADInfo()
+	if err != nil {
+		head = &types.HeadInfo{Detached: true}
+	}
+	refs, err := r.ListRefs()
+	if err != nil {
+		return err
+	}
+	deleted := map[string]bool{}
+	for _, update := range t.updates {
+		if update.Delete {
+			deleted[update.Name] = true
+		}
+	}
+
+	locked := []*lockedRef{}
+	fail := func(err error) error {
+		r.releaseRefs(locked)
+		return err
+	}
+	seen := map[string]bool{}
+	for _, update := range t.updates {
+		if err := checkRefName(update.Name); err != nil {
+			return fail(err)
+		}
+
+		// A symbolic ref stands for the ref it points to, and both reflogs record the move
+		ref := &lockedRef{update: update}
+		if !update.NoDeref {
+			target, err := r.ResolveSymbolicRef(update.Name)
+			if err != nil {
+				return fail(fmt.Errorf("cannot lock ref '%s': %s", update.Name, err))
+			}
+			if target != update.Name && update.Name != "HEAD" {
+				ref.symref = update.Name
+			}
+			ref.update.Name = target
+		}
+		name := ref.update.Name
+		ref.logHEAD = !head.Detached && name == "refs/heads/"+head.Branch
+		if seen[name] {
+			return fail(fmt.Errorf("multiple updates for ref '%s' not allowed", name))
+		}
+		seen[name] = true
+		if err := checkRefConflict(name, update, refs, deleted); err != nil {
+			return fail(err)
+		}
+
+		ref.path = r.GitPath(name)
+		ref.deferred = !update.Delete && !update.Verify && isBelowDeletedRef(name, deleted)
+		locked = append(locked, ref)
+		if !ref.deferred {
+			if err := r.lockRef(ref); err != nil {
+				return fail(err)
+			}
+		}
+
+		// The value is read under the lock, it can't move anymore
+		ref.old, ref.exists = r.ReadRef(name)
+		if data, err := os.ReadFile(ref.path); err == nil {
+			ref.oldLoose = data
+		}
+		if err := r.prepareRefUpdate(ref, deleted); err != nil {
+			return fail(err)
+		}
+	}
+
+	packedLock, oldPacked, err := r.lockPackedRefsForDelete(locked)
+	if err != nil {
+		return fail(err)
+	}
+	if err := r.applyRefUpdates(locked, packedLock, oldPacked); err != nil {
+		return err
+	}
+	return r.updateReflogs(locked)
+}
+
+// lockRef takes the lock of a ref, creating its directories, and writes its new value to the lock file for updates.
+func (r *Repository) lockRef(ref *lockedRef) error {
+	name := ref.update.Name
+	if err := os.MkdirAll(filepath.Dir(ref.path), constants.DefaultDirPerm); err != nil {
+		return fmt.Errorf("cannot lock ref '%s': %s", name, err)
+	}
+	lock, err := Lock(ref.path)
+	if err != nil {
+		return fmt.Errorf("cannot lock ref '%s': %s", name, err)
+	}
+	ref.lock = lock
+	if ref.update.Delete || ref.update.Verify {
+		return nil
+	}
+	return lock.Write([]byte(fmt.Sprintf("%x\n", ref.update.New)))
+}
+
+// prepareRefUpdate checks a locked ref against its expected value, and that its new value can be written.
+func (r *Repository) prepareRefUpdate(ref *lockedRef, deleted map[string]bool) error {
+	update := ref.update
+	name := update.Name
+	switch {
+	case update.HaveOld && update.Old == [20]byte{} && ref.exists:
+		return fmt.Errorf("cannot lock ref '%s': reference already exists", name)
+	case update.HaveOld && update.Old != [20]byte{} && !ref.exists:
+		return fmt.Errorf("cannot lock ref '%s': unable to resolve reference '%s'", name, name)
+	case update.HaveOld && ref.exists && ref.old != update.Old:
+		return fmt.Errorf("cannot lock ref '%s': is at %x but expected %x", name, ref.old, update.Old)
+	}
+	if update.Delete || update.Verify {
+		return nil
+	}
+
+	// A directory left below the name would keep the ref from being renamed into place, unless the refs it holds are deleted first
+	if info, err := os.Stat(ref.path); err == nil && info.IsDir() && !hasDeletedRefBelow(name, deleted) {
+		return fmt.Errorf("cannot lock ref '%s': there is a directory in the way", name)
+	}
+	objType, _, err := r.Objects.Read(update.New)
+	if err != nil {
+		return fmt.Errorf("cannot update ref '%s': trying to write ref '%s' with nonexistent object %x", name, name, update.New)
+	}
+	if objType != types.CommitObject && (name == "HEAD" || strings.HasPrefix(name, "refs/heads/")) {
+		return fmt.Errorf("cannot update ref '%s': trying to write non-commit object %x to branch '%s'", name, update.New, name)
+	}
+	return nil
+}
+
+// lockPackedRefsForDelete locks .git/packed-refs and writes it without the refs deleted by the transaction to the lock file. Returns nil when none of them is packed, else the lock and the content of .git/packed-refs before the transaction.
+func (r *Repository) lockPackedRefsForDelete(locked []*lockedRef) (*LockFile, []byte, error) {
+	deleted := map[string]bool{}
+	for _, ref := range locked {
+		if ref.update.Delete {
+			deleted[ref.update.Name] = true
+		}
+	}
+	if len(deleted) == 0 {
+		return nil, nil, nil
+	}
+
+	lock, err := Lock(r.GitPath("packed-refs"))
+	if err != nil {
+		return nil, nil, err
+	}
+	oldPacked, err := os.ReadFile(r.GitPath("packed-refs"))
+	if err != nil && !os.IsNotExist(err) {
+		lock.Rollback()
+		return nil, nil, err
+	}
+	packed, err := r.ReadPackedRefs()
+	if err != nil {
+		lock.Rollback()
+		return nil, nil, err
+	}
+	kept := []types.PackedRef{}
+	for _, ref := range packed {
+		if !deleted[ref.Name] {
+			kept = append(kept, ref)
+		}
+	}
+	if len(kept) == len(packed) {
+		lock.Rollback()
+		return nil, nil, nil
+	}
+	if err := lock.Write(encodePackedRefs(kept)); err != nil {
+		lock.Rollback()
+		return nil, nil, err
+	}
+	return lock, oldPacked, nil
+}
+
+// applyRefUpdates moves the prepared values of a transaction into place : .git/packed-refs, then the deletions, which may make room for new refs (a/b replacing a), then the new values. When a move fails, the ones already done are undone in reverse order, putting the old contents back.
+func (r *Repository) applyRefUpdates(locked []*lockedRef, packedLock *LockFile, oldPacked []byte) error {
+	undo := []func(){}
+	fail := func(err error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		r.releaseRefs(locked)
+		return err
+	}
+
+	if packedLock != nil {
+		if err := packedLock.Commit(); err != nil {
+			return fail(err)
+		}
+		undo = append(undo, func() { r.restoreRefFile(r.GitPath("packed-refs"), oldPacked) })
+	}
+
+	// The loose file goes before its lock is released, no one sees the ref half deleted
+	for _, ref := range locked {
+		if !ref.update.Delete {
+			continue
+		}
+		if err := os.Remove(ref.path); err != nil && !os.IsNotExist(err) {
+			return fail(err)
+		}
+		undo = append(undo, func() { r.restoreRefFile(ref.path, ref.oldLoose) })
+		r.releaseRefs([]*lockedRef{ref})
+	}
+
+	// Refs below a deleted ref can be locked now that it is gone
+	for _, ref := range locked {
+		if ref.deferred {
+			if err := r.lockRef(ref); err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	for _, ref := range locked {
+		if ref.update.Delete || ref.update.Verify {
+			continue
+		}
+		err := ref.lock.Commit()
+		ref.lock = nil
+		if err != nil {
+			return fail(err)
+		}
+		undo = append(undo, func() { r.restoreRefFile(ref.path, ref.oldLoose) })
+	}
+
+	// Only the locks of the verified refs are left
+	r.releaseRefs(locked)
+	return nil
+}
+
+// updateReflogs records an applied transaction in the reflogs. Deleted refs lose theirs first, so that a new ref can take the place of their directory.
+func (r *Repository) updateReflogs(locked []*lockedRef) error {
+	for _, ref := range locked {
+		if ref.update.Delete {
+			if err := r.DeleteReflog(ref.update.Name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, ref := range locked {
+		update := ref.update
+		if update.Delete || update.Verify {
+			continue
+		}
+		if err := r.AppendReflog(update.Name, ref.old, update.New, update.Message); err != nil {
+			return err
+		}
+		if ref.symref != "" {
+			if err := r.AppendReflog(ref.symref, ref.old, update.New, update.Message); err != nil {
+				return err
+			}
+		}
+		if ref.logHEAD {
+			if err := r.AppendReflog("HEAD", ref.old, update.New, update.Message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreRefFile puts back the content a ref file had before a failed transaction, or removes the file when there was none.
+func (r *Repository) restoreRefFile(path string, content []byte) {
+	if content == nil {
+		os.Remove(path)
+		r.removeEmptyRefDirs(filepath.Dir(path))
+		return
+	}
+	os.MkdirAll(filepath.Dir(path), constants.DefaultDirPerm)
+	writeFileViaTemp(path, content, constants.DefaultFilePerm)
+}
+
+// releaseRefs removes the lock files still held for refs, along with the directories created for them and left empty.
+func (r *Repository) releaseRefs(refs []*lockedRef) {
+	for _, ref := range refs {
+		if ref.lock == nil {
+			continue
+		}
+		ref.lock.Rollback()
+		ref.lock = nil
+		r.removeEmptyRefDirs(filepath.Dir(ref.path))
+	}
+}
+
+// isBelowDeletedRef reports whether name is below a ref deleted by the same transaction (a/b when a is deleted).
+func isBelowDeletedRef(name string, deleted map[string]bool) bool {
+	for del := range deleted {
+		if strings.HasPrefix(name, del+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDeletedRefBelow reports whether refs below name are deleted by the same transaction (a/b when a is created).
+func hasDeletedRefBelow(name string, deleted map[string]bool) bool {
+	for del := range deleted {
+		if strings.HasPrefix(del, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRefConflict rejects writing a ref named like a directory of existing refs (a when a/b exists), or below an existing ref (a/b when a exists), as they can't both be files. Refs deleted by the same transaction are not in the way.
+func checkRefConflict(name string, update types.RefUpdate, refs map[string][20]byte, deleted map[string]bool) error {
+	if update.Delete || update.Verify {
+		return nil
+	}
+	for existing := range refs {
+		if deleted[existing] {
+			continue
+		}
+		if strings.HasPrefix(existing, name+"/") || strings.HasPrefix(name, existing+"/") {
+			return fmt.Errorf("cannot lock ref '%s': '%s' exists; cannot create '%s'", name, existing, name)
+		}
+	}
+	return nil
+}
+
+// checkRefName rejects the names git refuses for refs (see git check-ref-format). HEAD and pseudo-refs such as ORIG_HEAD are accepted, any other ref must be below refs/.
+func checkRefName(name string) error {
+	bad := fmt.Errorf("refusing to update ref with bad name '%s'", name)
+	if !strings.HasPrefix(name, "refs/") {
+		if !strings.HasSuffix(name, "HEAD") || strings.Trim(name, "ABCDEFGHIJKLMNOPQRSTUVWXYZ_") != "" {
+			return bad
+		}
+		return nil
+	}
+	if strings.HasSuffix(name, ".") || strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.ContainsAny(name, " ~^:?*[\\\x7f") {
+		return bad
+	}
+	for _, c := range name {
+		if c < 0x20 {
+			return bad
+		}
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || strings.HasPrefix(part, ".") || strings.HasSuffix(part, ".lock") {
+			return bad
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package plumbing
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"testing"
+
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+func TestCheckRefName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"HEAD", true},
+		{"ORIG_HEAD", true},
+		{"MERGE_HEAD", true},
+		{"refs/heads/master", true},
+		{"refs/heads/feature/login", true},
+		{"refs/tags/v1.0", true},
+		{"refs/heads/a.b", true},
+		{"refs/heads/a-b_c", true},
+
+		{"master", false}, // outside refs/ and not a pseudo-ref
+		{"Head", false},
+		{"FOO_HEAD2", false},
+		{"refs/heads/", false},
+		{"refs//heads/master", false},
+		{"refs/heads/master.", false},
+		{"refs/heads/.hidden", false},
+		{"refs/heads/a..b", false},
+		{"refs/heads/master.lock", false},
+		{"refs/heads/a.lock/b", false},
+		{"refs/heads/a@{1}", false},
+		{"refs/heads/a b", false},
+		{"refs/heads/a~1", false},
+		{"refs/heads/a^", false},
+		{"refs/heads/a:b", false},
+		{"refs/heads/a?", false},
+		{"refs/heads/a*", false},
+		{"refs/heads/a[b", false},
+		{"refs/heads/a\\b", false},
+		{"refs/heads/a\x7fb", false},
+		{"refs/heads/a\tb", false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.name), func(t *testing.T) {
+			if err := checkRefName(tt.name); (err == nil) != tt.valid {
+				t.Errorf("checkRefName(%q) = %v, want valid %v", tt.name, err, tt.valid)
+			}
+		})
+	}
+}
+
+// testCommits writes n commits, with the empty tree and no parent, differing by their message.
+func testCommits(t *testing.T, repo *Repository, n int) [][20]byte {
+	t.Helper()
+	tree, err := repo.WriteObject(types.TreeObject, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits := [][20]byte{}
+	for i := range n {
+		data := fmt.Sprintf("tree %x\nauthor A <a@example.com> 1700000000 +0000\ncommitter A <a@example.com> 1700000000 +0000\n\nCommit %d\n", tree, i)
+		sha, err := repo.WriteObject(types.CommitObject, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, sha)
+	}
+	return commits
+}
+
+func TestRefTransaction(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	tests := []struct {
+		name    string
+		updates func(c [][20]byte) []types.RefUpdate
+		wantErr bool
+	}{
+		{
+			name: "create, update and delete together",
+			updates: func(c [][20]byte) []types.RefUpdate {
+				return []types.RefUpdate{
+					{Name: "refs/heads/new", New: c[1], HaveOld: true},
+					{Name: "refs/heads/master", New: c[2], Old: c[0], HaveOld: true},
+					{Name: "refs/heads/old", Old: c[0], HaveOld: true, Delete: true},
+				}
+			},
+		},
+		{
+			name: "update without expected value",
+			updates: func(c [][20]byte) []types.RefUpdate {
+				return []types.RefUpdate{{Name: "refs/heads/master", New: c[1]}}
+			},
+		},
+		{
+			name: "stale expected value",
+			updates: func(c [][20]byte) []types.RefUpdate {
+				return []types.RefUpdate{
+					{Name: "refs/heads/new", New: c[1], HaveOld: true},
+					{Name: "refs/heads/master", New: c[2], Old: c[1], HaveOld: true},
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "create over an existing ref",
+			updates: func(c [][20]byte) []types.RefUpdate {
+				return []types.RefUpdate{{Name: "refs/heads/master", New: c[1], HaveOld: true}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "failed verify",
+			updates: func(c [][20]byte) []types.RefUpdate {
+				return []types.RefUpdate{
+					{Name: "refs/heads/master", New: c[1]},
+					{Name: "refs/heads/old", Old: c[1], HaveOld: true, Verify: true},
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing object",
+			updates: func(c [][20]byte) []types.RefUpdate {
+				return []types.RefUpdate{
+					{Name: "refs/heads/master", New: c[1]},
+					{Name: "refs/heads/new", New: [20]byte{1}},
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad ref name",
+			updates: func(c [][20]byte) []types.RefUpdate {
+				return []types.RefUpdate{
+					{Name: "refs/heads/master", New: c[1]},
+					{Name: "refs/heads/bad..name", New: c[1]},
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "same ref twice",
+			updates: func(c [][20]byte) []types.RefUpdate {
+				return []types.RefUpdate{
+					{Name: "refs/heads/master", New: c[1]},
+					{Name: "refs/heads/master", New: c[2]},
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "ref in the way of a directory",
+			updates: func(c [][20]byte) []types.RefUpdate {
+				return []types.RefUpdate{{Name: "refs/heads/old/topic", New: c[1]}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "directory replacing a deleted ref",
+			updates: func(c [][20]byte) []types.RefUpdate {
+				return []types.RefUpdate{
+					{Name: "refs/heads/old", Delete: true},
+					{Name: "refs/heads/old/topic", New: c[1]},
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			c := testCommits(t, repo, 3)
+			setup := repo.NewRefTransaction()
+			setup.Create("refs/heads/master", c[0], "")
+			setup.Create("refs/heads/old", c[0], "")
+			if err := setup.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			before, err := repo.ListRefs()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tx := repo.NewRefTransaction()
+			updates := tt.updates(c)
+			for _, update := range updates {
+				tx.Add(update)
+			}
+			err = tx.Commit()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Commit() = %v, want error %v", err, tt.wantErr)
+			}
+
+			// A failed transaction leaves every ref as it was, a successful one applies every update
+			want := before
+			if err == nil {
+				want = maps.Clone(before)
+				for _, update := range updates {
+					switch {
+					case update.Delete:
+						delete(want, update.Name)
+					case !update.Verify:
+						want[update.Name] = update.New
+					}
+				}
+			}
+			got, err := repo.ListRefs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("refs after the transaction = %x, want %x", got, want)
+			}
+		})
+	}
+}
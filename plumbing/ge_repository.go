@@ -0,0 +1,261 @@
+package plumbing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+)
+
+// Repository is a handle to a single repository : where its git directory and working tree live, and the object store holding its objects. Every plumbing operation hangs off a Repository, so several repositories can be used from one process.
+type Repository struct {
+	GitDir   string      // absolute path of the git directory (usually <WorkTree>/.git)
+	WorkTree string      // absolute path of the root of the working tree
+	Objects  ObjectStore // object database, loose objects + packs under GitDir/objects by default
+}
+
+// Open opens the repository whose working tree root is path. The directory must contain a .git directory (or .git file). Use Discover to search parent directories as well.
+func Open(path string) (*Repository, error) {
+
+	// Resolve absolute path, clean path
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check that .git exists and is a git directory (or points to one)
+	gitDir, ok := resolveGitDir(filepath.Join(absPath, ".git"))
+	if !ok {
+		return nil, fmt.Errorf("not a git repository: %s", absPath)
+	}
+
+	return newRepository(gitDir, absPath), nil
+}
+
+// Discover finds the repository containing path by walking up its parent directories until one with a .git directory (or a "gitdir: <path>" .git file) is found. The search stops at filesystem boundaries unless GIT_DISCOVERY_ACROSS_FILESYSTEM is set.
+func Discover(path string) (*Repository, error) {
+
+	// Resolve absolute path, clean path
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remember the device we started on to detect filesystem boundaries
+	startDev, hasDev := deviceOf(absPath)
+	acrossFS := os.Getenv("GIT_DISCOVERY_ACROSS_FILESYSTEM") != ""
+
+	for dir := absPath; ; {
+
+		// Check for .git in the current directory
+		if gitDir, ok := resolveGitDir(filepath.Join(dir, ".git")); ok {
+			return newRepository(gitDir, dir), nil
+		}
+
+		// Move to the parent, stop at the root
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+
+		// Stop at filesystem boundaries
+		if dev, ok := deviceOf(parent); hasDev && ok && dev != startDev && !acrossFS {
+			return nil, fmt.Errorf("not a git repository (or any parent up to mount point %s): %s", dir, absPath)
+		}
+		dir = parent
+	}
+
+	return nil, fmt.Errorf("not a git repository (or any of the parent directories): %s", absPath)
+}
+
+// OpenFromEnv opens the repository for a command running in cwd, honoring GIT_DIR and GIT_WORK_TREE the way git does : GIT_DIR names the git directory (the working tree then defaults to cwd), GIT_WORK_TREE overrides the working tree root, otherwise the repository is discovered from cwd.
+func OpenFromEnv(cwd string) (*Repository, error) {
+	gitDirEnv := os.Getenv("GIT_DIR")
+	workTreeEnv := os.Getenv("GIT_WORK_TREE")
+
+	var repo *Repository
+	if gitDirEnv != "" {
+
+		// Explicit git directory, relative paths are relative to cwd
+		gitDir := gitDirEnv
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(cwd, gitDir)
+		}
+		resolved, ok := resolveGitDir(gitDir)
+		if !ok {
+			return nil, fmt.Errorf("not a git repository: '%s'", gitDirEnv)
+		}
+
+		workTree, err := filepath.Abs(cwd)
+		if err != nil {
+			return nil, err
+		}
+		repo = newRepository(resolved, workTree)
+	} else {
+
+		// Walk up from cwd
+		discovered, err := Discover(cwd)
+		if err != nil {
+			return nil, err
+		}
+		repo = discovered
+	}
+
+	// Explicit working tree overrides whatever was found
+	if workTreeEnv != "" {
+		workTree := workTreeEnv
+		if !filepath.IsAbs(workTree) {
+			workTree = filepath.Join(cwd, workTree)
+		}
+		absWorkTree, err := filepath.Abs(workTree)
+		if err != nil {
+			return nil, err
+		}
+		repo.WorkTree = absWorkTree
+	}
+	return repo, nil
+}
+
+// resolveGitDir checks whether path is a git directory, or a .git file pointing to one ("gitdir: <path>"). Returns the absolute git directory.
+func resolveGitDir(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+
+	// A git directory must at least contain HEAD, objects and refs
+	if info.IsDir() {
+		for _, name := range []string{"HEAD", "objects", "refs"} {
+			if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+				return "", false
+			}
+		}
+		absPath, err := filepath.Abs(path)
+		return absPath, err == nil
+	}
+
+	// .git file : "gitdir: <path>", relative to the directory containing the file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", false
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	return resolveGitDir(target)
+}
+
+// deviceOf returns the device id of the filesystem holding path, if the platform exposes it.
+func deviceOf(path string) (uint64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	stat, ok := sysStat(info)
+	return uint64(stat.Dev), ok
+}
+
+// Init creates (or reinitializes) a repository whose working tree root is path : the .git directory with objects, refs/heads, refs/tags, HEAD and config. Also reports whether the repository already existed.
+func Init(path string) (*Repository, bool, error) {
+
+	// Resolve absolute path, clean path
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Check whether .git already exists
+	reinitialize := false
+	if _, err := os.Stat(filepath.Join(absPath, ".git")); err == nil {
+		reinitialize = true
+	}
+
+	// Create the necessary directories
+	for _, dir := range constants.Dir_paths {
+		if err := os.MkdirAll(filepath.Join(absPath, dir), constants.DefaultDirPerm); err != nil {
+			return nil, false, err
+		}
+	}
+
+	repo := newRepository(filepath.Join(absPath, ".git"), absPath)
+
+	// Create HEAD file which will point to master branch
+	if err := WriteFileLocked(repo.GitPath("HEAD"), []byte(constants.Head)); err != nil {
+		return nil, false, err
+	}
+
+	// Write config file
+	if err := WriteFileLocked(repo.GitPath("config"), []byte(constants.Config)); err != nil {
+		return nil, false, err
+	}
+	return repo, reinitialize, nil
+}
+
+// newRepository builds a handle with the default on-disk object store.
+func newRepository(gitDir, workTree string) *Repository {
+	return &Repository{
+		GitDir:   gitDir,
+		WorkTree: workTree,
+		Objects:  NewLooseObjectStore(filepath.Join(gitDir, "objects")),
+	}
+}
+
+// GitPath returns the path of a file inside the git directory, e.g. GitPath("refs", "heads", "master").
+func (r *Repository) GitPath(elem ...string) string {
+	return filepath.Join(append([]string{r.GitDir}, elem...)...)
+}
+
+// RepoPath converts a path given on the command line (absolute, or relative to the current directory) into a working tree path as stored in the index : relative to the working tree root, with forward slashes. The root itself is returned as "".
+func (r *Repository) RepoPath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(r.WorkTree, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+
+		// Retry with symlinks resolved (e.g. /tmp -> /private/tmp), the path may still be inside
+		realRoot, err1 := filepath.EvalSymlinks(r.WorkTree)
+		realPath, err2 := evalSymlinksPartial(absPath)
+		if err1 == nil && err2 == nil {
+			rel, err = filepath.Rel(realRoot, realPath)
+		}
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("'%s' is outside repository at '%s'", path, r.WorkTree)
+		}
+	}
+
+	if rel == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// evalSymlinksPartial resolves symlinks in the longest existing prefix of path, so paths of deleted files can still be resolved.
+func evalSymlinksPartial(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return "", err
+	}
+	resolvedParent, err := evalSymlinksPartial(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedParent, filepath.Base(path)), nil
+}
+
+// WorkPath returns the on-disk path of a working tree path as stored in the index (relative, forward slashes).
+func (r *Repository) WorkPath(path string) string {
+	return filepath.Join(r.WorkTree, filepath.FromSlash(path))
+}
@@ -0,0 +1,85 @@
+package plumbing
+
+import (
+	"container/heap"
+	"errors"
+	"time"
+
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// ErrStopWalk can be returned by a WalkCommits callback to end the walk early without an error.
+var ErrStopWalk = errors.New("stop walk")
+
+// queuedCommit is a commit waiting in the walk queue.
+type queuedCommit struct {
+	sha    [20]byte
+	commit *types.CommitNode
+	when   time.Time // committer date
+	seq    int       // insertion order, to break ties between equal dates
+}
+
+// commitQueue is a max-heap of commits on committer date.
+type commitQueue []*queuedCommit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	if !q[i].when.Equal(q[j].when) {
+		return q[i].when.After(q[j].when)
+	}
+	return q[i].seq < q[j].seq
+}
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x any)   { *q = append(*q, x.(*queuedCommit)) }
+func (q *commitQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// WalkCommits visits the commits reachable from roots, most recent committer date first, each exactly once. fn receives each commit and returns the parents to walk next : commit.ParentsSHA walks the whole history, commit.ParentsSHA[:1] only follows first parents. Returning ErrStopWalk ends the walk.
+func (r *Repository) WalkCommits(roots [][20]byte, fn func(sha [20]byte, commit *types.CommitNode) ([][20]byte, error)) error {
+	queue := &commitQueue{}
+	seen := map[[20]byte]bool{}
+	seq := 0
+
+	// Read a commit and add it to the queue, unless it was already queued
+	push := func(sha [20]byte) error {
+		if seen[sha] {
+			return nil
+		}
+		seen[sha] = true
+		commit, err := r.ReadCommit(sha)
+		if err != nil {
+			return err
+		}
+		heap.Push(queue, &queuedCommit{sha: sha, commit: commit, when: commit.Committer.When, seq: seq})
+		seq++
+		return nil
+	}
+
+	for _, root := range roots {
+		if err := push(root); err != nil {
+			return err
+		}
+	}
+
+	for queue.Len() > 0 {
+		curr := heap.Pop(queue).(*queuedCommit)
+
+		parents, err := fn(curr.sha, curr.commit)
+		if errors.Is(err, ErrStopWalk) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		for _, parent := range parents {
+			if err := push(parent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package plumbing
+
+import "os"
+
+// fileStat holds the filesystem metadata cached in an index entry, used to detect changed files without rehashing them.
+type fileStat struct {
+	Ctime   uint32 // seconds since epoch
+	CtimeNs uint32 // nanoseconds
+	Mtime   uint32 // seconds since epoch
+	MtimeNs uint32 // nanoseconds
+	Dev     uint32 // device
+	Ino     uint32 // inode
+	Uid     uint32 // user id
+	Gid     uint32 // group id
+}
+
+// statOf extracts the index stat fields from info. On platforms without a native stat structure (see sysStat), only the modification time is known : ctime falls back to mtime, device / inode / owner are zero.
+func statOf(info os.FileInfo) fileStat {
+	if st, ok := sysStat(info); ok {
+		return st
+	}
+
+	mtime := info.ModTime()
+	return fileStat{
+		Ctime:   uint32(mtime.Unix()),
+		CtimeNs: uint32(mtime.Nanosecond()),
+		Mtime:   uint32(mtime.Unix()),
+		MtimeNs: uint32(mtime.Nanosecond()),
+	}
+}
@@ -0,0 +1,26 @@
+//go:build freebsd || netbsd
+
+package plumbing
+
+import (
+	"os"
+	"syscall"
+)
+
+// sysStat reads the native FreeBSD / NetBSD stat structure (st_ctimespec / st_mtimespec).
+func sysStat(info os.FileInfo) (fileStat, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}, false
+	}
+	return fileStat{
+		Ctime:   uint32(stat.Ctimespec.Sec),
+		CtimeNs: uint32(stat.Ctimespec.Nsec),
+		Mtime:   uint32(stat.Mtimespec.Sec),
+		MtimeNs: uint32(stat.Mtimespec.Nsec),
+		Dev:     uint32(stat.Dev),
+		Ino:     uint32(stat.Ino),
+		Uid:     stat.Uid,
+		Gid:     stat.Gid,
+	}, true
+}
@@ -0,0 +1,24 @@
+package plumbing
+
+import (
+	"os"
+	"syscall"
+)
+
+// sysStat reads the native Linux stat structure (st_ctim / st_mtim).
+func sysStat(info os.FileInfo) (fileStat, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}, false
+	}
+	return fileStat{
+		Ctime:   uint32(stat.Ctim.Sec),
+		CtimeNs: uint32(stat.Ctim.Nsec),
+		Mtime:   uint32(stat.Mtim.Sec),
+		MtimeNs: uint32(stat.Mtim.Nsec),
+		Dev:     uint32(stat.Dev),
+		Ino:     uint32(stat.Ino),
+		Uid:     stat.Uid,
+		Gid:     stat.Gid,
+	}, true
+}
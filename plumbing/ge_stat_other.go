@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !solaris
+
+package plumbing
+
+import "os"
+
+// sysStat has no native stat structure to read on this platform, statOf falls back to os.FileInfo only.
+func sysStat(info os.FileInfo) (fileStat, bool) {
+	return fileStat{}, false
+}
@@ -0,0 +1,134 @@
+package plumbing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// maxSymrefDepth is how many refs are read along a chain of symbolic refs, the ref holding the SHA included, before giving up, like git.
+const maxSymrefDepth = 5
+
+// ReadSymbolicRef reads the ref a symbolic ref points to, from its "ref: <target>" file (e.g. HEAD, or refs/remotes/origin/HEAD). Only loose refs can be symbolic. Returns: target, isSymbolic flag
+func (r *Repository) ReadSymbolicRef(name string) (string, bool) {
+	data, err := os.ReadFile(r.GitPath(name))
+	if err != nil {
+		return "", false
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	target, isSymbolic := strings.CutPrefix(strings.TrimSpace(line), "ref: ")
+	if !isSymbolic || target == "" {
+		return "", false
+	}
+	return strings.TrimSpace(target), true
+}
+
+// ResolveSymbolicRef follows symbolic refs from name down to the ref which holds a SHA, which may not exist yet (an unborn branch). A ref which isn't symbolic resolves to itself. Fails on a loop, or when the chain is longer than maxSymrefDepth refs.
+func (r *Repository) ResolveSymbolicRef(name string) (string, error) {
+	target, isSymbolic := r.ReadSymbolicRef(name)
+	if !isSymbolic {
+		return name, nil
+	}
+	return r.resolveSymbolicChain(name, target)
+}
+
+// resolveSymbolicChain follows symbolic refs from target, as if name pointed to it, which allows checking a symbolic ref before writing it. Fails like ResolveSymbolicRef.
+func (r *Repository) resolveSymbolicChain(name, target string) (string, error) {
+	seen := map[string]bool{name: true}
+	for depth := 1; ; depth++ {
+		if seen[target] {
+			return "", fmt.Errorf("symbolic ref loop at '%s'", target)
+		}
+		if depth == maxSymrefDepth {
+			return "", fmt.Errorf("too many levels of symbolic refs at '%s'", name)
+		}
+		seen[target] = true
+		name = target
+
+		next, isSymbolic := r.ReadSymbolicRef(name)
+		if !isSymbolic {
+			return name, nil
+		}
+		target = next
+	}
+}
+
+// WriteSymbolicRef points the symbolic ref name at the ref target, which doesn't have to exist yet. The chain of symbolic refs from target must not loop nor be too long, and HEAD must end on a branch. With a message, the change of value is recorded in the reflog of name.
+func (r *Repository) WriteSymbolicRef(name, target, message string) error {
+	if err := checkRefName(name); err != nil {
+		return err
+	}
+	if err := checkRefName(target); err != nil {
+		return err
+	}
+	resolved, err := r.resolveSymbolicChain(name, target)
+	if err != nil {
+		return err
+	}
+	if name == "HEAD" && !strings.HasPrefix(resolved, "refs/heads/") {
+		return fmt.Errorf("refusing to point HEAD outside of refs/heads/ : %s", resolved)
+	}
+	oldSHA, _ := r.ReadRef(name)
+
+	refPath := r.GitPath(name)
+	if err := os.MkdirAll(filepath.Dir(refPath), constants.DefaultDirPerm); err != nil {
+		return err
+	}
+	if err := WriteFileLocked(refPath, []byte("ref: "+target+"\n")); err != nil {
+		return err
+	}
+	if message == "" {
+		return nil
+	}
+
+	// The value is read back through the new target, loops included
+	newSHA, _ := r.ReadRef(name)
+	return r.AppendReflog(name, oldSHA, newSHA, message)
+}
+
+// DeleteSymbolicRef deletes a symbolic ref itself, along with its reflog, leaving the ref it points to alone.
+func (r *Repository) DeleteSymbolicRef(name string) error {
+	if _, isSymbolic := r.ReadSymbolicRef(name); !isSymbolic {
+		return fmt.Errorf("%s is not a symbolic ref", name)
+	}
+	tx := r.NewRefTransaction()
+	tx.Add(types.RefUpdate{Name: name, Delete: true, NoDeref: true})
+	return tx.Commit()
+}
+
+// symbolicRefs walks .git/refs and returns the full names of the symbolic refs found there.
+func (r *Repository) symbolicRefs() []string {
+	names := []string{}
+	_ = filepath.WalkDir(r.GitPath("refs"), func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(r.GitDir, path)
+		if err != nil {
+			return nil
+		}
+		if _, isSymbolic := r.ReadSymbolicRef(filepath.ToSlash(rel)); isSymbolic {
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return names
+}
+
+// ReadShortRef looks up a ref by the name it is given on the command line, trying the full names it may stand for in git's order : the name as is (refs/... or a pseudo-ref such as ORIG_HEAD), then below refs/, refs/tags/, refs/heads/, refs/remotes/, and finally refs/remotes/<name>/HEAD (origin for origin/HEAD). Symbolic refs are followed. Returns: SHA, exists flag
+func (r *Repository) ReadShortRef(name string) ([20]byte, bool) {
+	candidates := []string{"refs/" + name, "refs/tags/" + name, "refs/heads/" + name, "refs/remotes/" + name, "refs/remotes/" + name + "/HEAD"}
+	if checkRefName(name) == nil {
+		candidates = append([]string{name}, candidates...)
+	}
+	for _, candidate := range candidates {
+		if sha, exists := r.ReadRef(candidate); exists {
+			return sha, true
+		}
+	}
+	return [20]byte{}, false
+}
@@ -0,0 +1,122 @@
+package plumbing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestRef writes a loose ref file as is, bypassing every check.
+func writeTestRef(t *testing.T, repo *Repository, name, content string) {
+	t.Helper()
+	path := repo.GitPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveSymbolicRef(t *testing.T) {
+	tests := []struct {
+		name    string
+		refs    map[string]string // loose ref files, by name
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"not symbolic", map[string]string{}, "refs/heads/master", "refs/heads/master", false},
+		{"unborn branch", map[string]string{}, "HEAD", "refs/heads/master", false},
+		{"chain", map[string]string{
+			"refs/remotes/origin/HEAD": "ref: refs/remotes/origin/main\n",
+			"refs/heads/alias":         "ref: refs/remotes/origin/HEAD\n",
+		}, "refs/heads/alias", "refs/remotes/origin/main", false},
+		{"deepest chain allowed", map[string]string{
+			"refs/s1": "ref: refs/s2\n",
+			"refs/s2": "ref: refs/s3\n",
+			"refs/s3": "ref: refs/s4\n",
+			"refs/s4": "ref: refs/heads/end\n",
+		}, "refs/s1", "refs/heads/end", false},
+		{"chain too deep", map[string]string{
+			"refs/s1": "ref: refs/s2\n",
+			"refs/s2": "ref: refs/s3\n",
+			"refs/s3": "ref: refs/s4\n",
+			"refs/s4": "ref: refs/s5\n",
+			"refs/s5": "ref: refs/heads/end\n",
+		}, "refs/s1", "", true},
+		{"self loop", map[string]string{"refs/s1": "ref: refs/s1\n"}, "refs/s1", "", true},
+		{"loop", map[string]string{
+			"refs/s1": "ref: refs/s2\n",
+			"refs/s2": "ref: refs/s3\n",
+			"refs/s3": "ref: refs/s1\n",
+		}, "refs/s1", "", true},
+		{"loop reached from HEAD", map[string]string{
+			"HEAD":    "ref: refs/s1\n",
+			"refs/s1": "ref: refs/s2\n",
+			"refs/s2": "ref: refs/s1\n",
+		}, "HEAD", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			for name, content := range tt.refs {
+				writeTestRef(t, repo, name, content)
+			}
+			got, err := repo.ResolveSymbolicRef(tt.ref)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ResolveSymbolicRef(%q) = %q, %v, want %q, error %v", tt.ref, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteSymbolicRef(t *testing.T) {
+	tests := []struct {
+		name    string
+		refs    map[string]string // loose ref files written first, by name
+		ref     string
+		target  string
+		wantErr bool
+	}{
+		{"HEAD on a branch", nil, "HEAD", "refs/heads/topic", false},
+		{"HEAD on a symbolic ref to a branch", map[string]string{"refs/alias": "ref: refs/heads/master\n"}, "HEAD", "refs/alias", false},
+		{"symbolic ref anywhere below refs/", nil, "refs/remotes/origin/HEAD", "refs/remotes/origin/main", false},
+		{"HEAD outside of refs/heads/", nil, "HEAD", "refs/tags/v1", true},
+		{"HEAD on a symbolic ref leaving refs/heads/", map[string]string{"refs/alias": "ref: refs/tags/v1\n"}, "HEAD", "refs/alias", true},
+		{"bad name", nil, "refs/heads/a..b", "refs/heads/master", true},
+		{"bad target", nil, "refs/alias", "refs/heads/a b", true},
+		{"target outside refs/", nil, "refs/alias", "master", true},
+		{"pointing at itself", nil, "refs/alias", "refs/alias", true},
+		{"closing a loop", map[string]string{"refs/other": "ref: refs/alias\n"}, "refs/alias", "refs/other", true},
+		{"chain getting too deep", map[string]string{
+			"refs/s1": "ref: refs/s2\n",
+			"refs/s2": "ref: refs/s3\n",
+			"refs/s3": "ref: refs/s4\n",
+			"refs/s4": "ref: refs/heads/end\n",
+		}, "refs/alias", "refs/s1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			for name, content := range tt.refs {
+				writeTestRef(t, repo, name, content)
+			}
+			before, wasSymbolic := repo.ReadSymbolicRef(tt.ref)
+
+			err := repo.WriteSymbolicRef(tt.ref, tt.target, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteSymbolicRef(%q, %q) = %v, want error %v", tt.ref, tt.target, err, tt.wantErr)
+			}
+
+			// A refused symbolic ref is left as it was
+			wantTarget, wantSymbolic := tt.target, true
+			if tt.wantErr {
+				wantTarget, wantSymbolic = before, wasSymbolic
+			}
+			if target, isSymbolic := repo.ReadSymbolicRef(tt.ref); target != wantTarget || isSymbolic != wantSymbolic {
+				t.Errorf("ReadSymbolicRef(%q) = %q, %v, want %q, %v", tt.ref, target, isSymbolic, wantTarget, wantSymbolic)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package plumbing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// WriteTag creates an annotated tag object named name for the object sha, writes it to the object database, and returns the tag SHA. The tagger is dated now unless its When is set.
+func (r *Repository) WriteTag(name string, sha [20]byte, tagger types.Author, message string) ([20]byte, error) {
+	objType, _, err := r.Objects.Read(sha)
+	if err != nil {
+		return [20]byte{}, err
+	}
+	if tagger.When.IsZero() {
+		tagger.When = time.Now()
+	}
+
+	// Tag Message (must end with newline)
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	return r.WriteObject(types.TagObject, EncodeTag(&types.TagNode{
+		ObjectSHA:  sha,
+		ObjectType: objType,
+		Name:       name,
+		Tagger:     tagger,
+		Message:    message,
+	}))
+}
+
+// EncodeTag serializes a tag into the content of a tag object. Tags read with ReadTag and left unchanged encode back to the same bytes, whatever the order of their headers.
+func EncodeTag(t *types.TagNode) []byte {
+	if t.Raw != nil {
+		if read, err := ParseTag(t.Raw); err == nil && sameTag(read, t) {
+			return t.Raw
+		}
+	}
+
+	var content bytes.Buffer
+
+	// Object Line : "object <sha_hex>\n"
+	content.WriteString("object ")
+	content.WriteString(hex.EncodeToString(t.ObjectSHA[:]))
+	content.WriteByte('\n')
+
+	// Type Line : "type <commit|tree|blob|tag>\n"
+	content.WriteString("type ")
+	content.WriteString(string(t.ObjectType))
+	content.WriteByte('\n')
+
+	// Tag Line : "tag <name>\n"
+	content.WriteString("tag ")
+	content.WriteString(t.Name)
+	content.WriteByte('\n')
+
+	// Tagger Line : "tagger <name> <email> <timestamp> <timezone>"
+	if t.Tagger != (types.Author{}) {
+		content.WriteString("tagger ")
+		content.WriteString(FormatSignature(t.Tagger))
+		content.WriteByte('\n')
+	}
+
+	// Other headers, continuation lines start with a space
+	for _, h := range t.ExtraHeaders {
+		content.WriteString(h.Key)
+		content.WriteByte(' ')
+		content.WriteString(strings.ReplaceAll(h.Value, "\n", "\n "))
+		content.WriteByte('\n')
+	}
+
+	// blank line before message
+	content.WriteByte('\n')
+	content.WriteString(t.Message)
+	return content.Bytes()
+}
+
+// sameTag reports whether a and b hold the same object, type, name, tagger, headers and message.
+func sameTag(a, b *types.TagNode) bool {
+	return a.ObjectSHA == b.ObjectSHA && a.ObjectType == b.ObjectType && a.Name == b.Name &&
+		sameSignature(a.Tagger, b.Tagger) && slices.Equal(a.ExtraHeaders, b.ExtraHeaders) && a.Message == b.Message
+}
+
+// ReadTag reads and parses a tag object from the object database.
+func (r *Repository) ReadTag(sha [20]byte) (*types.TagNode, error) {
+	objType, data, err := r.Objects.Read(sha)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check whether it is a tag object
+	if objType != types.TagObject {
+		return nil, fmt.Errorf("object is not a tag")
+	}
+	return ParseTag(data)
+}
+
+// ParseTag parses the content of a tag object. The content itself is kept in Raw, so that EncodeTag gives it back unchanged.
+func ParseTag(data []byte) (*types.TagNode, error) {
+	t := types.TagNode{Raw: bytes.Clone(data)}
+
+	// Headers end at the first blank line, the rest is the tag message
+	header, message, _ := strings.Cut(string(data), "\n\n")
+	t.Message = message
+
+	// Parse headers
+	for _, line := range strings.Split(header, "\n") {
+
+		// Continuation of a multi-line header
+		if strings.HasPrefix(line, " ") && len(t.ExtraHeaders) > 0 {
+			last := &t.ExtraHeaders[len(t.ExtraHeaders)-1]
+			last.Value += "\n" + line[1:]
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "object": // Object Line
+			hash, err := hex.DecodeString(value)
+			if err != nil || len(hash) != 20 {
+				return nil, fmt.Errorf("invalid object line in tag: %s", line)
+			}
+			t.ObjectSHA = [20]byte(hash)
+
+		case "type": // Type Line
+			t.ObjectType = types.ObjectType(value)
+
+		case "tag": // Tag Line
+			t.Name = value
+
+		case "tagger": // Tagger Line
+			t.Tagger = ParseSignature(value)
+
+		case "":
+			// Trailing newline of a tag without message
+
+		default:
+			t.ExtraHeaders = append(t.ExtraHeaders, types.CommitHeader{Key: key, Value: value})
+		}
+	}
+	if t.ObjectSHA == [20]byte{} || t.ObjectType == "" {
+		return nil, fmt.Errorf("invalid tag: missing object or type")
+	}
+	return &t, nil
+}
+
+// PeelObject follows annotated tags from sha down to an object of type want, going from a commit to its tree when a tree is wanted. An empty want stops at the first object which is not a tag.
+func (r *Repository) PeelObject(sha [20]byte, want types.ObjectType) ([20]byte, error) {
+	for {
+		objType, content, err := r.Objects.Read(sha)
+		if err != nil {
+			return [20]byte{}, err
+		}
+		switch {
+		case objType == want || (want == "" && objType != types.TagObject):
+			return sha, nil
+		case objType == types.TagObject:
+			tag, err := ParseTag(content)
+			if err != nil {
+				return [20]byte{}, err
+			}
+			sha = tag.ObjectSHA
+		case objType == types.CommitObject && want == types.TreeObject:
+			commit, err := ParseCommit(content)
+			if err != nil {
+				return [20]byte{}, err
+			}
+			sha = commit.TreeSHA
+		default:
+			return [20]byte{}, fmt.Errorf("expected %s type, but the object dereferences to %s type", want, objType)
+		}
+	}
+}
+
+// ReadTagRef reads a tag by its name (e.g. v1.0), loose or packed. Returns: SHA (of the tag object for annotated tags), exists flag
+func (r *Repository) ReadTagRef(name string) ([20]byte, bool) {
+	return r.ReadRef("refs/tags/" + name)
+}
+
+// CreateTagRef creates .git/refs/tags/<name> pointing to sha, a tag object or any other object for lightweight tags. It fails if the tag already exists.
+func (r *Repository) CreateTagRef(name string, sha [20]byte) error {
+	if _, exists := r.ReadTagRef(name); exists {
+		return fmt.Errorf("tag '%s' already exists", name)
+	}
+
+	tx := r.NewRefTransaction()
+	tx.Create("refs/tags/"+name, sha, "")
+	return tx.Commit()
+}
+
+// ListTags returns the names of all tags, loose or packed, sorted.
+func (r *Repository) ListTags() ([]string, error) {
+	refs, err := r.ListRefs()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range refs {
+		if tag, ok := strings.CutPrefix(name, "refs/tags/"); ok {
+			names = append(names, tag)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,66 @@
+package plumbing
+
+import "testing"
+
+func TestTagRoundTrip(t *testing.T) {
+	object := "object 8ab686eafeb1f44702738c8b0f24f2567c36da6d\n"
+	tagger := "tagger A U Thor <author@example.com> 1700000000 +0200\n"
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"annotated tag", object + "type commit\ntag v1.0\n" + tagger + "\nRelease 1.0\n"},
+		{"without tagger", object + "type commit\ntag v0.1\n\nVery old tag\n"},
+		{"extra headers", object + "type commit\ntag v1.1\n" + tagger + "encoding UTF-8\n\nMessage\n"},
+		{"headers out of order", "tag v1.2\n" + object + tagger + "type commit\n\nMessage\n"},
+		{"header before the tagger", object + "type commit\ntag v1.3\nfoo bar\n" + tagger + "\nMessage\n"},
+		{"multi-line header", object + "type commit\ntag v1.4\n" + tagger + "sig line one\n line two\n\nSigned\n"},
+		{"no blank line without message", object + "type commit\ntag v1.5\n" + tagger},
+		{"empty message", object + "type tree\ntag v1.6\n" + tagger + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, err := ParseTag([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseTag: %s", err)
+			}
+			if got := string(EncodeTag(tag)); got != tt.data {
+				t.Errorf("EncodeTag(ParseTag(data)) =\n%q\nwant\n%q", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestEncodeTagWritesChangedTags(t *testing.T) {
+	data := "tag v1.0\nobject 8ab686eafeb1f44702738c8b0f24f2567c36da6d\ntype commit\n\nOld message\n"
+	tag, err := ParseTag([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.Message = "New message\n"
+
+	want := "object 8ab686eafeb1f44702738c8b0f24f2567c36da6d\ntype commit\ntag v1.0\n\nNew message\n"
+	if got := string(EncodeTag(tag)); got != want {
+		t.Errorf("EncodeTag() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestParseTagRejectsInvalidTags(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"missing object", "type commit\ntag v1\n\nMessage\n"},
+		{"missing type", "object 8ab686eafeb1f44702738c8b0f24f2567c36da6d\ntag v1\n\nMessage\n"},
+		{"invalid object", "object 8ab686\ntype commit\ntag v1\n\nMessage\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tag, err := ParseTag([]byte(tt.data)); err == nil {
+				t.Errorf("ParseTag gave %+v, want an error", tag)
+			}
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
@@ -49,14 +48,14 @@ func BuildTreeFromIndex(entries []types.IndexEntry) *types.TreeNode {
 }
 
 // WriteTree recursively writes tree objects to the object database and returns the SHA of the root tree.
-func WriteTree(node *types.TreeNode) ([20]byte, error) {
+func (r *Repository) WriteTree(node *types.TreeNode) ([20]byte, error) {
 	var entries []types.TreeEntry
 
 	// recursion first (dirs)
 	for name, child := range node.Dirs {
-		sha, err := WriteTree(child)
+		sha, err := r.WriteTree(child)
 		if err != nil {
-			return [20]byte{}, nil
+			return [20]byte{}, err
 		}
 
 		// Add TreeEntry to the list of entries
@@ -68,27 +67,52 @@ func WriteTree(node *types.TreeNode) ([20]byte, error) {
 		})
 	}
 
-	// Files
+	// Files, keeping the mode recorded in the index (regular, executable or symbolic link)
 	for name, ie := range node.Files {
+		mode := ie.Mode
+		if mode == 0 {
+			mode = constants.ModeFile
+		}
 		entries = append(entries, types.TreeEntry{
-			Mode: constants.ModeFile,
+			Mode: mode,
 			Name: name,
 			SHA:  ie.SHA1,
 			Type: types.BlobObject,
 		})
 	}
 
-	// Sort the entries now
+	return r.writeTreeEntries(entries)
+}
+
+// writeTreeEntries writes a tree object made of the given entries, in any order, and returns its SHA.
+func (r *Repository) writeTreeEntries(entries []types.TreeEntry) ([20]byte, error) {
+
+	// Sort the entries first. Like git, directories sort as if their name ended with "/".
+	sortKey := func(e types.TreeEntry) string {
+		if e.Type == types.TreeObject {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
 	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Name < entries[j].Name
+		return sortKey(entries[i]) < sortKey(entries[j])
 	})
 
+	// Names must be unique, a file and a directory can't share one
+	names := map[string]bool{}
+	for _, e := range entries {
+		if names[e.Name] {
+			return [20]byte{}, fmt.Errorf("duplicate tree entry '%s'", e.Name)
+		}
+		names[e.Name] = true
+	}
+
 	var content bytes.Buffer
 
 	// Build Tree content (no header yet)
 	for _, e := range entries {
-		// "<mode> <name>\0"
-		modeStr := fmt.Sprintf("%06o", e.Mode)
+		// "<mode> <name>\0", git writes modes without leading zeros (40000 for trees)
+		modeStr := fmt.Sprintf("%o", e.Mode)
 		content.WriteString(modeStr)
 		content.WriteByte(' ')
 		content.WriteString(e.Name)
@@ -99,14 +123,14 @@ func WriteTree(node *types.TreeNode) ([20]byte, error) {
 	}
 
 	// Write Tree Object to .git/objects
-	return WriteObject(types.TreeObject, content.Bytes())
+	return r.WriteObject(types.TreeObject, content.Bytes())
 }
 
 // ReadTreeCurrentLevel reads one shaHex object, decodes it and prints it in a type-specific but non-recursive way.
-func ReadTreeCurrentLevel(shaHex string) ([]types.TreeEntry, error) {
+func (r *Repository) ReadTreeCurrentLevel(shaHex string) ([]types.TreeEntry, error) {
 
 	// Read Tree Object
-	objType, content, err := ReadObject(shaHex)
+	objType, content, err := r.ReadObject(shaHex)
 	if err != nil {
 		return nil, err
 	}
@@ -152,8 +176,11 @@ func ReadTreeCurrentLevel(shaHex string) ([]types.TreeEntry, error) {
 		}
 
 		entryType := types.BlobObject
-		if uint32Mode == constants.ModeTree {
+		switch uint32Mode {
+		case constants.ModeTree:
 			entryType = types.TreeObject
+		case constants.ModeGitlink:
+			entryType = types.CommitObject // commit of a submodule, not stored in this repository
 		}
 
 		entries = append(entries, types.TreeEntry{
@@ -169,17 +196,50 @@ func ReadTreeCurrentLevel(shaHex string) ([]types.TreeEntry, error) {
 	return entries, nil
 }
 
+// TreeEntryAtPath looks up a path (relative to the root of the tree, "" for the tree itself) inside a tree, reading only the trees along the way. Returns the entry and whether it exists.
+func (r *Repository) TreeEntryAtPath(treeSHA [20]byte, path string) (types.TreeEntry, bool, error) {
+	entry := types.TreeEntry{Mode: constants.ModeTree, SHA: treeSHA, Type: types.TreeObject}
+	if path == "" {
+		return entry, true, nil
+	}
+
+	// Descend one path component at a time
+	for _, part := range strings.Split(path, "/") {
+		if entry.Type != types.TreeObject {
+			return types.TreeEntry{}, false, nil
+		}
+		entries, err := r.ReadTreeCurrentLevel(hex.EncodeToString(entry.SHA[:]))
+		if err != nil {
+			return types.TreeEntry{}, false, err
+		}
+
+		found := false
+		for _, e := range entries {
+			if e.Name == part {
+				entry, found = e, true
+				break
+			}
+		}
+		if !found {
+			return types.TreeEntry{}, false, nil
+		}
+	}
+
+	entry.Name = path
+	return entry, true, nil
+}
+
 // FlattenTree recursively walks a tree object and returns a flat map of path → TreeEntry (like Git's index representation).
-func FlattenTree(treeSHA [20]byte) (map[string]types.TreeEntry, error) {
+func (r *Repository) FlattenTree(treeSHA [20]byte) (map[string]types.TreeEntry, error) {
 	out := make(map[string]types.TreeEntry)
-	err := flattenTreeRecur(treeSHA, "", out)
+	err := r.flattenTreeRecur(treeSHA, "", out)
 	return out, err
 }
 
-func flattenTreeRecur(treeSHA [20]byte, prefix string, out map[string]types.TreeEntry) error {
+func (r *Repository) flattenTreeRecur(treeSHA [20]byte, prefix string, out map[string]types.TreeEntry) error {
 
 	// Read Tree at current level
-	entries, err := ReadTreeCurrentLevel(hex.EncodeToString(treeSHA[:]))
+	entries, err := r.ReadTreeCurrentLevel(hex.EncodeToString(treeSHA[:]))
 	if err != nil {
 		return err
 	}
@@ -203,7 +263,7 @@ func flattenTreeRecur(treeSHA [20]byte, prefix string, out map[string]types.Tree
 
 		// It is a Tree, recursive call
 		if e.Type == types.TreeObject {
-			if err := flattenTreeRecur(e.SHA, path, out); err != nil {
+			if err := r.flattenTreeRecur(e.SHA, path, out); err != nil {
 				return err
 			}
 		}
@@ -212,10 +272,10 @@ func flattenTreeRecur(treeSHA [20]byte, prefix string, out map[string]types.Tree
 }
 
 // ReadHEADTreeSHA returns the tree SHA pointed to by HEAD. If no commits exist yet, returns (nil, false).
-func ReadHEADTreeSHA() ([20]byte, bool, error) {
+func (r *Repository) ReadHEADTreeSHA() ([20]byte, bool, error) {
 
 	// Get HEAD Info
-	headInfo, err := ReadHEADInfo()
+	headInfo, err := r.ReadHEADInfo()
 	if err != nil {
 		return [20]byte{}, false, err
 	}
@@ -226,7 +286,7 @@ func ReadHEADTreeSHA() ([20]byte, bool, error) {
 	}
 
 	// Read Content for the Commit object
-	_, content, err := ReadObject(hex.EncodeToString(headInfo.SHA[:]))
+	_, content, err := r.ReadObject(hex.EncodeToString(headInfo.SHA[:]))
 	if err != nil {
 		return [20]byte{}, false, err
 	}
@@ -247,13 +307,13 @@ func ReadHEADTreeSHA() ([20]byte, bool, error) {
 }
 
 // ResolveTreeish takes a tree-ish string, and returns the tree sha associated with it.
-func ResolveTreeish(treeIsh string) ([20]byte, error) {
+func (r *Repository) ResolveTreeish(treeIsh string) ([20]byte, error) {
 
 	// Check whether the tree-ish is actually a commit-ish. If Tree-ish is actually a Commit-ish, return SHA directly using ReadCommit.
-	commitSHA, err := ResolveCommitish(treeIsh)
+	commitSHA, err := r.ResolveCommitish(treeIsh)
 	if err == nil {
 		// Use commit SHA to get tree val
-		commit, err := ReadCommit(commitSHA)
+		commit, err := r.ReadCommit(commitSHA)
 		if err != nil {
 			return [20]byte{}, err
 		}
@@ -262,7 +322,7 @@ func ResolveTreeish(treeIsh string) ([20]byte, error) {
 
 	// Special case, if treeIsh = HEAD^{tree}. HEAD^{N} are already covered above
 	if treeIsh == "HEAD^{tree}" {
-		treeSHA, ok, err := ReadHEADTreeSHA()
+		treeSHA, ok, err := r.ReadHEADTreeSHA()
 		if err != nil {
 			return [20]byte{}, err
 		}
@@ -272,8 +332,18 @@ func ResolveTreeish(treeIsh string) ([20]byte, error) {
 		return treeSHA, nil
 	}
 
+	// <rev>^{tree} : any tree-ish peels to its tree
+	if base, ok := strings.CutSuffix(treeIsh, "^{tree}"); ok {
+		return r.ResolveTreeish(base)
+	}
+
+	// A tag pointing to a tree (or to a tag of a tree)
+	if tagSHA, exists := r.ReadTagRef(treeIsh); exists {
+		return r.PeelObject(tagSHA, types.TreeObject)
+	}
+
 	// Check whether the tree-ish object is a valid SHA and is of type tree / commit
-	objType, _, err := ReadObject(treeIsh)
+	objType, _, err := r.ReadObject(treeIsh)
 	if err != nil {
 		return [20]byte{}, err
 	}
@@ -287,59 +357,62 @@ func ResolveTreeish(treeIsh string) ([20]byte, error) {
 	copy(shaArr[:], treeSHA)
 
 	// Check objType and confirm whether it's tree or blob Object. Commit object are parsed already.
-	if objType == types.TreeObject {
+	switch objType {
+	case types.TreeObject:
 		return shaArr, nil
-	} else {
+	case types.TagObject:
+		return r.PeelObject(shaArr, types.TreeObject)
+	default:
 		// Blob Object : return error
 		return [20]byte{}, fmt.Errorf("Object Type is not Tree-ish")
 	}
 }
 
-// UpdateWorkingTreeToSHA : Given a tree SHA, make the working directory exactly match that tree.
-func UpdateWorkingTreeToSHA(treeSHA [20]byte) error {
+// UpdateWorkingTreeToSHA : Given a tree SHA, make the working directory exactly match that tree. Untracked files ignored by .gitignore rules are kept.
+func (r *Repository) UpdateWorkingTreeToSHA(treeSHA [20]byte) error {
 
 	// Get All Tree Entries
-	treeEntries, err := FlattenTree(treeSHA)
+	treeEntries, err := r.FlattenTree(treeSHA)
+	if err != nil {
+		return err
+	}
+
+	// Load the ignore rules, ignored files are left alone
+	matcher, err := r.NewIgnoreMatcher()
 	if err != nil {
 		return err
 	}
 
 	// Scan Working Tree
+	files, err := r.WorkTreeFiles("", matcher)
+	if err != nil {
+		return err
+	}
 	workTreeFiles := map[string]bool{}
-	if err = filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			fmt.Println("Error accessing path:", err)
-			return nil
-		}
-		// Skip the root directory itself
-		if path == "." {
-			return nil
-		}
+	for _, path := range files {
+		workTreeFiles[path] = true
+	}
 
-		// Skip the .git directory
-		if d.IsDir() && d.Name() == ".git" {
-			return filepath.SkipDir
+	// Tracked files are removed even when they are ignored, submodules are left alone
+	indexEntries, err := r.LoadIndex()
+	if err != nil {
+		return err
+	}
+	for _, ie := range indexEntries {
+		if ie.Mode == constants.ModeGitlink {
+			continue
 		}
-
-		// Skip directories, only add files
-		if d.IsDir() {
-			return nil
+		if _, err := os.Lstat(r.WorkPath(ie.Filename)); err == nil {
+			workTreeFiles[ie.Filename] = true
 		}
-
-		// Add the file to the map
-		cleanPath := filepath.ToSlash(filepath.Clean(path))
-		workTreeFiles[cleanPath] = true
-		return nil
-	}); err != nil {
-		return err
 	}
 
-	// Delete Files which are not in TreeEntries
+	// Delete Files which are not in TreeEntries, or are a directory there
 	for path := range workTreeFiles {
-		if _, exists := treeEntries[path]; !exists {
+		if entry, exists := treeEntries[path]; !exists || entry.Type == types.TreeObject {
 
 			// Delete From Worktree
-			if err := os.Remove(path); err != nil {
+			if err := os.Remove(r.WorkPath(path)); err != nil {
 				return err
 			}
 		}
@@ -354,57 +427,46 @@ func UpdateWorkingTreeToSHA(treeSHA [20]byte) error {
 		}
 
 		// Read Content from the Tree, and Write it. to the file
-		_, content, err := ReadObject(hex.EncodeToString(entry.SHA[:]))
+		_, content, err := r.ReadObject(hex.EncodeToString(entry.SHA[:]))
 		if err != nil {
 			return err
 		}
 
-		// Make required directories if not present
-		if err := os.MkdirAll(filepath.Dir(path), constants.DefaultDirPerm); err != nil {
-			return err
-		}
-
-		// Write content to File
-		if err := os.WriteFile(path, content, constants.DefaultFilePerm); err != nil {
+		// Write content to File, as an executable or a symbolic link depending on the mode
+		if err := r.WriteWorkTreeFile(path, entry.Mode, content); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// CheckoutToTreeSHA: Given a tree SHA, Update the Working directory , .git/index to match the Tree.
-func CheckoutToTreeSHA(treeSHA [20]byte, headContent string) error {
+// CheckoutToTreeSHA: Given a tree SHA, Update the Working directory , .git/index to match the Tree. HEAD is pointed at the branch headRef (e.g. refs/heads/master), or detached at commitSHA when headRef is empty, and the move recorded with message in its reflog.
+func (r *Repository) CheckoutToTreeSHA(treeSHA [20]byte, headRef string, commitSHA [20]byte, message string) error {
+	oldSHA, _ := r.ReadRef("HEAD")
+
+	// Hold the index from the scan of the working tree until it is rewritten, released by ResetIndexToTree
+	lock, err := r.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
 
 	// UpdateWorkingTree based on treeSHA
-	if err := UpdateWorkingTreeToSHA(treeSHA); err != nil {
+	if err := r.UpdateWorkingTreeToSHA(treeSHA); err != nil {
 		return fmt.Errorf("could not update working tree: %s", err)
 	}
 
 	// Update in .git/HEAD
-	if err := os.WriteFile(filepath.Join(".git", "HEAD"), []byte(headContent), constants.DefaultFilePerm); err != nil {
-		return fmt.Errorf("could not update .git/HEAD: %s", err)
-	}
-
-	// Update the .git/index : Get Tree Entries and convert them to []IndexEntry
-	treeEntries, err := FlattenTree(treeSHA)
-	if err != nil {
-		return fmt.Errorf("could not flatten Tree contents: %s", err)
-	}
-	treeIndexEntries := []types.IndexEntry{}
-
-	// Iterate through the entries and convert them to []IndexEntry, with default values for everything else. Only blobs will be used.
-	for _, te := range treeEntries {
-		if te.Type == types.BlobObject {
-			treeIndexEntries = append(treeIndexEntries, types.IndexEntry{
-				Filename: te.Name,
-				SHA1:     te.SHA,
-				Mode:     te.Mode,
-			})
+	if headRef != "" {
+		if err := r.WriteSymbolicRef("HEAD", headRef, message); err != nil {
+			return fmt.Errorf("could not update .git/HEAD: %s", err)
 		}
+	} else if err := r.UpdateHEADDetached(commitSHA, oldSHA, message); err != nil {
+		return fmt.Errorf("could not update .git/HEAD: %s", err)
 	}
 
-	// Write the Index based on these new []IndexEntry slice. Will automatically sort based on Filename.
-	if err := WriteIndex(treeIndexEntries); err != nil {
+	// Update the .git/index
+	if err := r.ResetIndexToTree(lock, treeSHA); err != nil {
 		return fmt.Errorf("couldn't update .git/index: %s", err)
 	}
 	return nil
@@ -0,0 +1,168 @@
+package plumbing
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+)
+
+// WalkWorkTree walks the working tree below dir ("" for the root), skipping the .git directory and nested repositories (submodules). fn is called for every file and directory with its path relative to the working tree root, and whether it is ignored (always false when matcher is nil). Everything inside an ignored directory is ignored too. Returning filepath.SkipDir from fn on a directory skips its contents.
+func (r *Repository) WalkWorkTree(dir string, matcher *IgnoreMatcher, fn func(path string, d fs.DirEntry, ignored bool) error) error {
+	root := r.WorkPath(dir)
+
+	// Directories found to be ignored, so that their contents are too
+	ignoredDirs := map[string]bool{}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Println("Error accessing path:", err)
+			return nil
+		}
+		// Skip the root directory itself
+		if path == root {
+			return nil
+		}
+
+		// Skip the .git directory, and directories holding one : they are repositories of their own
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+
+		// Path relative to the root of the working tree
+		rel, err := filepath.Rel(r.WorkTree, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		// Check the ignore rules, inheriting the state of the parent directory
+		ignored := false
+		if matcher != nil {
+			if ignoredDirs[parentDir(rel)] {
+				ignored = true
+			} else if rule := matcher.MatchSelf(rel, d.IsDir()); rule != nil && !rule.negate {
+				ignored = true
+			}
+			if ignored && d.IsDir() {
+				ignoredDirs[rel] = true
+			}
+		}
+		return fn(rel, d, ignored)
+	})
+}
+
+// WorkTreeFiles returns the paths (relative to the working tree root) of every file below dir ("" for the root) that is not ignored by matcher. A nil matcher returns every file.
+func (r *Repository) WorkTreeFiles(dir string, matcher *IgnoreMatcher) ([]string, error) {
+	files := []string{}
+	err := r.WalkWorkTree(dir, matcher, func(path string, d fs.DirEntry, ignored bool) error {
+
+		// Don't descend into ignored directories
+		if ignored && d.IsDir() {
+			return filepath.SkipDir
+		}
+
+		// Skip ignored files and directories, only add files
+		if ignored || d.IsDir() {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files, err
+}
+
+// WorkTreeMode returns the git mode of a working tree file described by an Lstat result : ModeSymlink, ModeExec or ModeFile.
+func WorkTreeMode(info os.FileInfo) uint32 {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return constants.ModeSymlink
+	case info.Mode().Perm()&0o111 != 0:
+		return constants.ModeExec
+	default:
+		return constants.ModeFile
+	}
+}
+
+// ResolveFileMode picks the mode to record for a working tree file whose previously recorded mode was prevMode (0 if none). When the executable bit can't be trusted (core.filemode = false), regular files keep the mode they had, and new ones are not executable.
+func ResolveFileMode(workTreeMode, prevMode uint32, trusted bool) uint32 {
+	if trusted || workTreeMode == constants.ModeSymlink {
+		return workTreeMode
+	}
+	if prevMode == constants.ModeFile || prevMode == constants.ModeExec {
+		return prevMode
+	}
+	return constants.ModeFile
+}
+
+// FileModeTrusted reports whether the executable bit of working tree files is meaningful, i.e. core.filemode is not false.
+func (r *Repository) FileModeTrusted() bool {
+	val, err := r.GetConfig("core.filemode")
+	return err != nil || val != "false"
+}
+
+// ReadWorkTreeFile returns the content of a working tree file (relative to the working tree root) as it would be stored in a blob, along with its Lstat result. Symbolic links are not followed : their content is the link target.
+func (r *Repository) ReadWorkTreeFile(path string) ([]byte, os.FileInfo, error) {
+	fullPath := r.WorkPath(path)
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Symbolic link : blob is the target path
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []byte(filepath.ToSlash(target)), info, nil
+	}
+
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, info, nil
+}
+
+// WriteWorkTreeFile writes blob content to a working tree path (relative to the working tree root) according to its mode : a symbolic link for ModeSymlink, an executable file for ModeExec, a regular file otherwise. Parent directories are created as needed, and whatever was at the path (except a non empty directory) is replaced.
+func (r *Repository) WriteWorkTreeFile(path string, mode uint32, content []byte) error {
+	fullPath := r.WorkPath(path)
+
+	// Make required directories if not present
+	if err := os.MkdirAll(filepath.Dir(fullPath), constants.DefaultDirPerm); err != nil {
+		return err
+	}
+
+	// Replace symbolic links, files changing type and directories emptied of their files, instead of writing through them
+	if info, err := os.Lstat(fullPath); err == nil && (info.Mode()&os.ModeSymlink != 0 || mode == constants.ModeSymlink || info.IsDir()) {
+		if err := os.Remove(fullPath); err != nil {
+			return err
+		}
+	}
+
+	switch mode {
+	case constants.ModeSymlink:
+		return os.Symlink(filepath.FromSlash(string(content)), fullPath)
+
+	case constants.ModeExec:
+		if err := os.WriteFile(fullPath, content, constants.DefaultExecPerm); err != nil {
+			return err
+		}
+		// WriteFile keeps the permissions of an existing file
+		return os.Chmod(fullPath, constants.DefaultExecPerm)
+
+	default:
+		if err := os.WriteFile(fullPath, content, constants.DefaultFilePerm); err != nil {
+			return err
+		}
+		return os.Chmod(fullPath, constants.DefaultFilePerm)
+	}
+}
@@ -2,82 +2,94 @@ package porcelain
 
 import (
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
-	"slices"
-	"syscall"
+	"strings"
 
 	"github.com/brickster241/GitEngine/plumbing"
 	"github.com/brickster241/GitEngine/utils"
 	"github.com/brickster241/GitEngine/utils/types"
 )
 
-// addOrUpdatePath adds or updates the index entry for the given path.
-func addOrUpdatePath(path string, indexMap map[string]types.IndexEntry, workingSet map[string]bool, trackWorkingSet bool) {
+// addOrUpdatePath adds or updates the index entry for the given path (relative to the working tree root). The executable bit is only recorded when fileModeTrusted is set (core.filemode).
+func addOrUpdatePath(repo *plumbing.Repository, path string, indexMap map[string]types.IndexEntry, fileModeTrusted bool) {
 
 	// Clean and normalize the path
 	cleanPath := filepath.ToSlash(filepath.Clean(path))
-	if trackWorkingSet {
-		workingSet[cleanPath] = true
-	}
-	// Get file info
-	info, err := os.Stat(cleanPath)
+
+	// Get file info, without following symbolic links
+	info, err := os.Lstat(repo.WorkPath(cleanPath))
 	if err != nil {
 		return
 	}
-	stat := info.Sys().(*syscall.Stat_t)
 
-	// Check if already tracked
+	// Check if already tracked, and unchanged (content and mode) since it was staged
 	existing, tracked := indexMap[cleanPath]
-
-	if tracked {
-		unchanged :=
-			existing.Dev == uint32(stat.Dev) &&
-				existing.Ino == uint32(stat.Ino) &&
-				existing.FileSize == uint32(info.Size()) &&
-				existing.Mtime == uint32(stat.Mtimespec.Sec) &&
-				existing.MtimeNs == uint32(stat.Mtimespec.Nsec) &&
-				existing.Ctime == uint32(stat.Ctimespec.Sec) &&
-				existing.CtimeNs == uint32(stat.Ctimespec.Nsec)
-
-		if unchanged {
-			return
-		}
+	if tracked && existing.Stage() == 0 && plumbing.IndexEntryMatchesStat(existing, info) && plumbing.ResolveFileMode(plumbing.WorkTreeMode(info), existing.Mode, fileModeTrusted) == existing.Mode {
+		return
 	}
 
-	// Read the file content
-	data, err := os.ReadFile(cleanPath)
+	// Read the file content (the target for symbolic links)
+	data, _, err := repo.ReadWorkTreeFile(cleanPath)
 	if err != nil {
 		fmt.Println("Error reading file:", err)
 		return
 	}
 
 	// Compute new hash and create new index entry
-	hash, err := plumbing.WriteObject(types.BlobObject, data)
+	hash, err := repo.WriteObject(types.BlobObject, data)
 	if err != nil {
 		fmt.Println("Error hashing file object:", err)
 		return
 	}
 
 	// Create new index entry
-	entry, err := plumbing.GetIndexEntryFromStat(cleanPath, hash)
+	entry, err := repo.GetIndexEntryFromStat(cleanPath, hash)
 	if err != nil {
 		fmt.Println("Error creating index entry:", err)
 		return
 	}
+	entry.Mode = plumbing.ResolveFileMode(entry.Mode, existing.Mode, fileModeTrusted)
 
 	// Update the index map
 	indexMap[cleanPath] = entry
 }
 
+// addDirectory adds every file below dir (relative to the working tree root, "" for the root) that is not ignored by matcher (nil adds everything), refreshes tracked files even if they are ignored, and stages deletions of tracked files that no longer exist there.
+func addDirectory(repo *plumbing.Repository, dir string, indexMap map[string]types.IndexEntry, matcher *plumbing.IgnoreMatcher, fileModeTrusted bool) {
+
+	// Add or update every file found in the working tree
+	files, err := repo.WorkTreeFiles(dir, matcher)
+	if err != nil {
+		fmt.Println("Error walking working tree:", err)
+		return
+	}
+	for _, path := range files {
+		addOrUpdatePath(repo, path, indexMap, fileModeTrusted)
+	}
+
+	// Handle tracked files below dir : refresh them if they still exist, otherwise remove them from the index
+	prefix := dir + "/"
+	for path := range indexMap {
+		if dir != "" && !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		if _, err := os.Lstat(repo.WorkPath(path)); err == nil {
+			addOrUpdatePath(repo, path, indexMap, fileModeTrusted)
+		} else {
+			delete(indexMap, path)
+		}
+	}
+}
+
 // Invoked from main.go. AddFiles handles the 'gegit add' command to add files to the index. It only calls this function if first argument is add.
-func AddFiles(args []string) {
+func AddFiles(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("add",
 		"Adds contents of new or changed files to the index. The \"index\" (also known as the \"staging area\") is what you use to prepare the contents of the next commit.",
-		"usage: gegit add <file>... | .")
+		"usage: gegit add [-f] <file>... | .")
+	force := fls.Bool("f", false, "Allow adding otherwise ignored files.")
 
 	// Parse flags from args
 	fls.Parse(args[1:])
@@ -87,12 +99,30 @@ func AddFiles(args []string) {
 
 	if len(pos) == 0 {
 		// No files specified
-		fmt.Println("usage: gegit add <file>... | .")
+		fmt.Println("usage: gegit add [-f] <file>... | .")
 		os.Exit(1)
 	}
 
-	entries, err := plumbing.LoadIndex()
+	// Load the ignore rules, unless adding is forced
+	var matcher *plumbing.IgnoreMatcher
+	if !*force {
+		var err error
+		if matcher, err = repo.NewIgnoreMatcher(); err != nil {
+			fmt.Println("Error loading ignore rules:", err)
+			os.Exit(1)
+		}
+	}
+
+	// Hold index.lock from reading the index until it is written back
+	lock, err := repo.LockIndex()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+
+	entries, err := repo.LoadIndex()
 	if err != nil {
+		lock.Rollback()
 		fmt.Println("Error loading index:", err)
 		os.Exit(1)
 	}
@@ -100,61 +130,61 @@ func AddFiles(args []string) {
 	// Create a map for quick lookup of existing entries
 	indexMap := plumbing.IndexToMap(entries)
 
-	// Keep track of files in the working directory if '.' is specified
-	workingSet := map[string]bool{}
-	isAddAll := slices.Contains(pos, ".")
+	// Whether the executable bit of files can be trusted (core.filemode)
+	fileModeTrusted := repo.FileModeTrusted()
 
-	// Handle the case where '.' is provided as an argument
-	if isAddAll {
-		_ = filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				fmt.Println("Error accessing path:", err)
-				return nil
-			}
-			// Skip the root directory itself
-			if path == "." {
-				return nil
-			}
-
-			// Skip the .git directory
-			if d.IsDir() && d.Name() == ".git" {
-				return filepath.SkipDir
-			}
+	// Paths named explicitly which are ignored, and not already tracked
+	ignoredPaths := []string{}
 
-			// Skip directories, only add files
-			if d.IsDir() {
-				return nil
-			}
-
-			// Add or update the file in the index
-			addOrUpdatePath(path, indexMap, workingSet, true)
-			return nil
-		})
-	} else {
-		// Handle specific files
-		for _, path := range args[1:] {
-			addOrUpdatePath(path, indexMap, workingSet, false)
+	// Handle each path, relative to the current directory. Directories ('.' included) are added recursively.
+	for _, arg := range pos {
+		rel, err := repo.RepoPath(arg)
+		if err != nil {
+			lock.Rollback()
+			fmt.Println("fatal:", err)
+			os.Exit(128)
 		}
-	}
 
-	if isAddAll {
-		// Handle deletions: remove entries not in working set, only use in add .
-		for path := range indexMap {
-			if !workingSet[path] {
-				delete(indexMap, path)
+		info, err := os.Lstat(repo.WorkPath(rel))
+		_, tracked := indexMap[rel]
+		switch {
+		case err == nil && rel != "" && !tracked && matcher != nil && matcher.IsIgnored(rel, info.IsDir()):
+			// Ignored paths need -f
+			ignoredPaths = append(ignoredPaths, rel)
+
+		case err == nil && info.IsDir():
+			addDirectory(repo, rel, indexMap, matcher, fileModeTrusted)
+
+		case err == nil:
+			addOrUpdatePath(repo, rel, indexMap, fileModeTrusted)
+
+		default:
+			// Path is gone from the working tree : stage its deletion if it is tracked
+			if !tracked {
+				lock.Rollback()
+				fmt.Printf("fatal: pathspec '%s' did not match any files\n", arg)
+				os.Exit(128)
 			}
+			delete(indexMap, rel)
 		}
 	}
 
-	// Convert the index map back to slice of IndexEntry.
-	indexEntries := make([]types.IndexEntry, 0, len(indexMap))
-	for _, entry := range indexMap {
-		indexEntries = append(indexEntries, entry)
-	}
+	// Convert the index map back to slice of IndexEntry, added paths are no longer unmerged.
+	indexEntries := plumbing.IndexFromMap(indexMap, entries)
 
 	// Write to Index file
-	if err = plumbing.WriteIndex(indexEntries); err != nil {
+	if err = repo.WriteIndex(lock, indexEntries); err != nil {
 		fmt.Println("Error writing to .git/index file:", err)
 		os.Exit(1)
 	}
+
+	// Report ignored paths which were not added
+	if len(ignoredPaths) > 0 {
+		fmt.Println("The following paths are ignored by one of your .gitignore files:")
+		for _, path := range ignoredPaths {
+			fmt.Println(path)
+		}
+		fmt.Println("hint: Use -f if you really want to add them.")
+		os.Exit(1)
+	}
 }
@@ -3,10 +3,9 @@ package porcelain
 import (
 	"encoding/hex"
 	"fmt"
-	"io/fs"
 	"os"
-	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/brickster241/GitEngine/plumbing"
 	"github.com/brickster241/GitEngine/utils"
@@ -14,7 +13,7 @@ import (
 )
 
 // Invoked from main.go. BranchOps handles the 'gegit branch' command to list, create, rename or delete branch refs.
-func BranchOps(args []string) {
+func BranchOps(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("branch",
@@ -39,40 +38,24 @@ func BranchOps(args []string) {
 		switch len(pos) {
 		// No extra arguments : List all branches
 		case 0:
+			// Branches are the refs under refs/heads, loose or packed
 			branchList := []string{}
-			if err := filepath.WalkDir(".git/refs/heads", func(path string, d fs.DirEntry, err error) error {
-				if err != nil {
-					fmt.Println("Error accessing path:", err)
-					return nil
-				}
-				// Skip the root directory itself
-				if path == ".git/refs/heads" {
-					return nil
-				}
-
-				// Skip directories, only add files
-				if d.IsDir() {
-					return nil
-				}
-
-				// It is a file, so add the remaining relative path to a list
-				rel, err := filepath.Rel(".git/refs/heads", path)
-				if err != nil {
-					return err
-				}
-				branchList = append(branchList, rel)
-
-				return nil
-			}); err != nil {
+			refs, err := repo.ListRefs()
+			if err != nil {
 				fmt.Println("Error fetching branch list:", err)
 				os.Exit(1)
 			}
+			for name := range refs {
+				if branch, ok := strings.CutPrefix(name, "refs/heads/"); ok {
+					branchList = append(branchList, branch)
+				}
+			}
 
 			// Sort the slice of branches
 			sort.Strings(branchList)
 
 			// Get current HEAD Info
-			headInfo, err := plumbing.ReadHEADInfo()
+			headInfo, err := repo.ReadHEADInfo()
 			if err != nil {
 				fmt.Println("Error fetching HEAD Info:", err)
 				os.Exit(1)
@@ -92,6 +75,9 @@ func BranchOps(args []string) {
 			for _, branch := range branchList {
 				if branch == headInfo.Branch {
 					fmt.Printf("* %s%s%s\n", constants.GreenColor, branch, constants.ResetColor)
+				} else if target, isSymbolic := repo.ReadSymbolicRef("refs/heads/" + branch); isSymbolic {
+					// A symbolic branch is shown with the branch it points to
+					fmt.Printf("  %s -> %s\n", branch, strings.TrimPrefix(target, "refs/heads/"))
 				} else {
 					fmt.Printf("  %s\n", branch)
 				}
@@ -100,14 +86,14 @@ func BranchOps(args []string) {
 		// Exactly one extra argument : Create a new branch -> gegit branch <branch_name>, pointing to HEAD but don't switch it.
 		case 1:
 			// Check whether the branch actually already exists
-			_, exists := plumbing.ReadBranchRef(pos[0])
+			_, exists := repo.ReadBranchRef(pos[0])
 			if exists {
 				fmt.Printf("Error: Branch named '%s' already exists\n", pos[0])
 				os.Exit(1)
 			}
 
 			// Get current HEAD SHA by reading .git/HEAD
-			headInfo, err := plumbing.ReadHEADInfo()
+			headInfo, err := repo.ReadHEADInfo()
 			if err != nil {
 				fmt.Println("Error fetching HEAD Info:", err)
 				os.Exit(1)
@@ -120,7 +106,7 @@ func BranchOps(args []string) {
 			}
 
 			// Create Branch Ref
-			if err := plumbing.CreateBranchRef(pos[0], headInfo.SHA); err != nil {
+			if err := repo.CreateBranchRef(pos[0], headInfo.SHA, "branch: Created from HEAD"); err != nil {
 				fmt.Println("Error creating branch:", err)
 				os.Exit(1)
 			}
@@ -137,7 +123,7 @@ func BranchOps(args []string) {
 		if *d {
 
 			// Check if the HEAD is symbolic and branch_name is the current branch
-			headInfo, err := plumbing.ReadHEADInfo()
+			headInfo, err := repo.ReadHEADInfo()
 			if err != nil {
 				fmt.Printf("Error: could not fetch HEAD -> %s\n", err)
 				os.Exit(1)
@@ -145,7 +131,7 @@ func BranchOps(args []string) {
 
 			for _, curr := range pos {
 				// Check whether the branch actually already exists
-				_, exists := plumbing.ReadBranchRef(curr)
+				_, exists := repo.ReadBranchRef(curr)
 				if !exists {
 					fmt.Printf("Error: Branch named '%s' doesn't exist\n", curr)
 					os.Exit(1)
@@ -156,10 +142,9 @@ func BranchOps(args []string) {
 					os.Exit(1)
 				}
 
-				// Remove .git/refs/heads/<branch_name> file
-				cleanPath := filepath.Join(".git", "refs", "heads", curr)
-				if err := os.Remove(cleanPath); err != nil && !os.IsNotExist(err) {
-					fmt.Printf("Error: could not delete %s -> %s\n", cleanPath, err)
+				// Remove .git/refs/heads/<branch_name> file, its entry in .git/packed-refs and its reflog
+				if err := repo.DeleteRef("refs/heads/" + curr); err != nil {
+					fmt.Printf("Error: could not delete branch '%s' -> %s\n", curr, err)
 					os.Exit(1)
 				}
 			}
@@ -177,41 +162,42 @@ func BranchOps(args []string) {
 			new_branch := pos[1]
 
 			// Check whether the old branch actually exists
-			_, exists := plumbing.ReadBranchRef(old_branch)
+			sha, exists := repo.ReadBranchRef(old_branch)
 			if !exists {
 				fmt.Printf("Error: Branch named '%s' doesn't exist\n", old_branch)
 				os.Exit(1)
 			}
 
 			// Check whether the renamed branch already exists
-			_, exists = plumbing.ReadBranchRef(new_branch)
+			_, exists = repo.ReadBranchRef(new_branch)
 			if exists {
 				fmt.Printf("Error: Renamed Branch '%s' already exists\n", new_branch)
 				os.Exit(1)
 			}
 
-			// Rename .git/refs/heads/<old_branch> to .gits/refs/heads/<new_branch>
-			oldPath := filepath.Clean(filepath.Join(".git", "refs", "heads", old_branch))
-			newPath := filepath.Clean(filepath.Join(".git", "refs", "heads", new_branch))
-			headPath := filepath.Join(".git", "HEAD")
-			headContent := "ref: " + filepath.Join("refs", "heads", new_branch) + "\n"
-
-			if err := os.Rename(oldPath, newPath); err != nil {
+			// Rename .git/refs/heads/<old_branch> (loose or packed) to .gits/refs/heads/<new_branch>
+			// The reflog follows the branch, and records the rename
+			renameMessage := fmt.Sprintf("Branch: renamed refs/heads/%s to refs/heads/%s", old_branch, new_branch)
+			if err := repo.RenameRef("refs/heads/"+old_branch, "refs/heads/"+new_branch, renameMessage); err != nil {
 				fmt.Printf("Error: Could not rename Branch '%s' to %s -> %s\n", old_branch, new_branch, err)
 				os.Exit(1)
 			}
 
 			// If old branch is the current branch, then update .git/HEAD if it is symbolic
-			headInfo, err := plumbing.ReadHEADInfo()
+			headInfo, err := repo.ReadHEADInfo()
 			if err != nil {
 				fmt.Printf("Error: could not fetch HEAD -> %s\n", err)
 				os.Exit(1)
 			}
 
-			// Write to .git/HEAD with ref: refs/heads/<new_branch>\n
+			// Point .git/HEAD to refs/heads/<new_branch>, the rename itself is logged below
 			if !headInfo.Detached && headInfo.Branch == old_branch {
-				if err := os.WriteFile(headPath, []byte(headContent), constants.DefaultFilePerm); err != nil {
-					fmt.Printf("Error writing to file '%s': %s\n", headPath, err)
+				if err := repo.WriteSymbolicRef("HEAD", "refs/heads/"+new_branch, ""); err != nil {
+					fmt.Println("Error updating .git/HEAD:", err)
+					os.Exit(1)
+				}
+				if err := repo.AppendReflog("HEAD", sha, sha, renameMessage); err != nil {
+					fmt.Printf("Error: Could not update the reflog of HEAD -> %s\n", err)
 					os.Exit(1)
 				}
 			}
@@ -230,21 +216,26 @@ func BranchOps(args []string) {
 			new_branch := pos[1]
 
 			// Check whether the old branch exists
-			sha, exists := plumbing.ReadBranchRef(old_branch)
+			sha, exists := repo.ReadBranchRef(old_branch)
 			if !exists {
 				fmt.Printf("Error: Branch named '%s' doesn't exist\n", old_branch)
 				os.Exit(1)
 			}
 
 			// Check whether the new branch already exists
-			_, exists = plumbing.ReadBranchRef(new_branch)
+			_, exists = repo.ReadBranchRef(new_branch)
 			if exists {
 				fmt.Printf("Error: Branch '%s' already exists\n", new_branch)
 				os.Exit(1)
 			}
 
-			// Create new branch pointing to same SHA
-			if err := plumbing.CreateBranchRef(new_branch, sha); err != nil {
+			// Create new branch pointing to same SHA, with a copy of the reflog
+			if err := repo.CopyReflog("refs/heads/"+old_branch, "refs/heads/"+new_branch); err != nil {
+				fmt.Printf("Error: Could not copy the reflog of '%s' -> %s\n", old_branch, err)
+				os.Exit(1)
+			}
+			copyMessage := fmt.Sprintf("Branch: copied refs/heads/%s to refs/heads/%s", old_branch, new_branch)
+			if err := repo.CreateBranchRef(new_branch, sha, copyMessage); err != nil {
 				fmt.Printf("Error: Could not create branch '%s' -> %s\n", new_branch, err)
 				os.Exit(1)
 			}
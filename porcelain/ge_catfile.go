@@ -11,7 +11,7 @@ import (
 )
 
 // Invoked from main.go. CatFileObject handles the 'gegit cat-file' command to display type, size or content for a specific repo object.
-func CatFileRepoObject(args []string) {
+func CatFileRepoObject(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("cat-file",
@@ -33,13 +33,20 @@ func CatFileRepoObject(args []string) {
 		os.Exit(1)
 	}
 
-	// Check whether it can be resolved to Commitish or Treeish object
-	sha, err := plumbing.ResolveCommitish(pos[0])
-	if err != nil {
-		// Try tree-ish
-		sha, err = plumbing.ResolveTreeish(pos[0])
+	// Tags and full SHAs name objects as they are, without peeling annotated tags
+	var sha [20]byte
+	if tagSHA, isTag := repo.ReadTagRef(pos[0]); isTag {
+		sha = tagSHA
+	} else if _, _, err := repo.ReadObject(pos[0]); err != nil {
+
+		// Check whether it can be resolved to Commitish or Treeish object
+		sha, err = repo.ResolveCommitish(pos[0])
 		if err != nil {
-			fmt.Println("fatal: Not a valid object name:", pos[0])
+			// Try tree-ish
+			sha, err = repo.ResolveTreeish(pos[0])
+			if err != nil {
+				fmt.Println("fatal: Not a valid object name:", pos[0])
+			}
 		}
 	}
 
@@ -50,7 +57,7 @@ func CatFileRepoObject(args []string) {
 	} else {
 		shaHex = pos[0]
 	}
-	objType, content, err := plumbing.ReadObject(shaHex)
+	objType, content, err := repo.ReadObject(shaHex)
 	if err != nil {
 		fmt.Println("Error reading object:", err)
 		os.Exit(1)
@@ -65,15 +72,24 @@ func CatFileRepoObject(args []string) {
 		fmt.Println(objType)
 	} else if *pp {
 		// Pretty print
-		if objType != types.TreeObject {
-			fmt.Println(string(content))
-		} else {
+		switch objType {
+		case types.TreeObject:
 			// ReadTree (single-level)
-			entries, _ := plumbing.ReadTreeCurrentLevel(shaHex)
+			entries, _ := repo.ReadTreeCurrentLevel(shaHex)
 			for _, e := range entries {
 				fmt.Printf("%06o %s %x\t%s\n",
 					e.Mode, e.Type, e.SHA, e.Name)
 			}
+		case types.TagObject:
+			// Headers, then the message which already ends with a newline
+			tag, err := plumbing.ParseTag(content)
+			if err != nil {
+				fmt.Println("Error reading tag:", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(plumbing.EncodeTag(tag)))
+		default:
+			fmt.Println(string(content))
 		}
 	}
 }
@@ -0,0 +1,109 @@
+package porcelain
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+)
+
+// Invoked from main.go. CheckIgnore handles the 'gegit check-ignore' command to debug gitignore / exclude files.
+func CheckIgnore(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("check-ignore",
+		"For each pathname given via the command-line, check whether the file is excluded by .gitignore (or other input files to the exclude mechanism) and output the path if it is excluded.",
+		"gegit check-ignore [-q] [-v] [-n] [--no-index] <pathname>...")
+	quiet := fls.Bool("q", false, "Don't output anything, just set exit status. This is only valid with a single pathname.")
+	verbose := fls.Bool("v", false, "Instead of printing the paths that are excluded, for each path that matches an exclude pattern, print the exclude pattern together with the path.")
+	nonMatching := fls.Bool("n", false, "Show given paths which don't match any pattern. This only makes sense when -v is enabled.")
+	noIndex := fls.Bool("no-index", false, "Don't look in the index when undertaking the checks.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	if len(pos) == 0 {
+		fmt.Println("fatal: no path specified")
+		os.Exit(128)
+	}
+	if *quiet && (len(pos) > 1 || *verbose) {
+		fmt.Println("fatal: --quiet is only valid with a single pathname, and cannot be combined with --verbose")
+		os.Exit(128)
+	}
+	if *nonMatching && !*verbose {
+		fmt.Println("fatal: --non-matching is only valid with --verbose")
+		os.Exit(128)
+	}
+
+	// Load the ignore rules
+	matcher, err := repo.NewIgnoreMatcher()
+	if err != nil {
+		fmt.Println("Error loading ignore rules:", err)
+		os.Exit(1)
+	}
+
+	// Tracked files are never reported, unless --no-index is given
+	indexMap := map[string]bool{}
+	if !*noIndex {
+		entries, err := repo.LoadIndex()
+		if err != nil {
+			fmt.Println("Error loading index:", err)
+			os.Exit(1)
+		}
+		for _, ie := range entries {
+			indexMap[ie.Filename] = true
+		}
+	}
+
+	matched := 0
+	for _, arg := range pos {
+		rel, err := repo.RepoPath(arg)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
+
+		// A trailing slash, or an existing directory, is checked as a directory
+		isDir := strings.HasSuffix(arg, "/")
+		if info, err := os.Stat(repo.WorkPath(rel)); err == nil && info.IsDir() {
+			isDir = true
+		}
+
+		// Find the deciding rule. Without -v, negated rules mean the path is not ignored.
+		var rule *plumbing.IgnoreRule
+		if rel != "" && !indexMap[rel] {
+			var ignored bool
+			rule, ignored = matcher.Match(rel, isDir)
+			if !ignored && !*verbose {
+				rule = nil
+			}
+		}
+
+		if rule != nil {
+			matched++
+		}
+		if *quiet {
+			continue
+		}
+
+		// <source>:<linenum>:<pattern> <TAB> <pathname> in verbose mode
+		switch {
+		case rule != nil && *verbose:
+			fmt.Printf("%s:%d:%s\t%s\n", rule.Source, rule.Line, rule.Pattern, arg)
+		case rule != nil:
+			fmt.Println(arg)
+		case *nonMatching:
+			fmt.Printf("::\t%s\n", arg)
+		}
+	}
+
+	// Exit status is 0 if at least one path matched, 1 otherwise
+	if matched == 0 {
+		os.Exit(1)
+	}
+}
@@ -4,21 +4,22 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/brickster241/GitEngine/plumbing"
 	"github.com/brickster241/GitEngine/utils"
 	"github.com/brickster241/GitEngine/utils/constants"
-	"github.com/brickster241/GitEngine/utils/types"
 )
 
 // Invoked from main.go. CheckoutCommit handles 'gegit checkout' command to switch branches or restore working tree files.
-func CheckoutCommit(args []string) {
+func CheckoutCommit(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("checkout",
 		"Switch branches, with git checkout <branch> or Restore a different version of a file, for example with git checkout <commit> <filename> or git checkout <filename>.",
-		"gegit checkout [-b <new-branch>] <commit-ish> [-- <path>]")
+		"gegit checkout [-b <new-branch>] <commit-ish> | [<commit-ish>] -- <path>...")
 	b := fls.String("b", "", "Create a new branch named <new-branch>, start it at <start-point> (defaults to the current commit), and check out the new branch.")
 
 	// Parse flags from args
@@ -27,17 +28,27 @@ func CheckoutCommit(args []string) {
 	// Positional arguments (non-flag)
 	pos := fls.Args()
 
-	// Store content which will be written in .git/HEAD
-	var headContent string
+	// Everything after "--" is a path. The flag parser swallows a leading "--", so check the raw arguments as well.
+	hasDashDash := slices.Contains(args[1:], "--")
+	revs, paths := pos, []string{}
+	if idx := slices.Index(pos, "--"); idx != -1 {
+		revs, paths = pos[:idx], pos[idx+1:]
+	} else if hasDashDash {
+		revs, paths = []string{}, pos
+	}
+
+	// Branch HEAD will point to, empty when detached
+	var headRef string
 
 	switch {
-	case *b != "":
+	case *b != "" && !hasDashDash:
+		requireMergedIndex(repo)
 		var startPoint string
 		// If branch is not empty, then exactly there should be one non-flag argument for startPoint commitish.
 		if len(pos) == 0 {
 			startPoint = "HEAD"
 		} else if len(pos) != 1 {
-			fmt.Println("usage: gegit checkout [-b <new-branch>] <commit-ish> [-- <path>]")
+			fmt.Println("usage: gegit checkout [-b <new-branch>] <commit-ish> | [<commit-ish>] -- <path>...")
 			os.Exit(1)
 		} else {
 			// Default startPoint is HEAD
@@ -45,44 +56,56 @@ func CheckoutCommit(args []string) {
 		}
 
 		// Resolve startPoint commitish
-		commitSHA, err := plumbing.ResolveCommitish(startPoint)
+		commitSHA, err := repo.ResolveCommitish(startPoint)
 		if err != nil {
 			fmt.Printf("Error resolving commit-ish '%s': %s", startPoint, err)
 			os.Exit(1)
 		}
 
 		// Create Branch with specified branchName and commitSHA
-		if err := plumbing.CreateBranchRef(*b, commitSHA); err != nil {
+		if err := repo.CreateBranchRef(*b, commitSHA, "branch: Created from "+startPoint); err != nil {
 			fmt.Println("Error creating branch:", err)
 			os.Exit(1)
 		}
 
 		// Get TreeSHA from the commitSHA
-		commit, err := plumbing.ReadCommit(commitSHA)
+		commit, err := repo.ReadCommit(commitSHA)
 		if err != nil {
 			fmt.Println("Error reading commit SHA:", err)
 			os.Exit(1)
 		}
 
 		// Update WorkTree, HEAD and Index to TreeSHA. Branch Name is *b
-		if err := plumbing.CheckoutToTreeSHA(commit.TreeSHA, "ref: "+filepath.Join("refs", "heads", *b)+"\n"); err != nil {
+		if err := repo.CheckoutToTreeSHA(commit.TreeSHA, "refs/heads/"+*b, commitSHA, checkoutMessage(repo, *b)); err != nil {
 			fmt.Println("Error Checking out to Tree SHA:", err)
 			os.Exit(1)
 		}
 
-	case len(pos) == 1:
-		// Extract commitish string, keep track whether head should be detached or not.
+	case !hasDashDash && len(pos) == 1:
+		requireMergedIndex(repo)
+		// Extract commitish string, keep track whether head should be detached or not. "-" and @{-<n>} name a previously checked out branch.
 		commitIsh := pos[0]
 		var commitSHA [20]byte
+		if commitIsh == "-" {
+			commitIsh = "@{-1}"
+		}
+		if n, ok := previousBranchSelector(commitIsh); ok {
+			previous, err := repo.PreviousBranch(n)
+			if err != nil {
+				fmt.Println("error:", err)
+				os.Exit(1)
+			}
+			commitIsh = previous
+		}
 
 		// Check whether commitIsh is an existing branch Name
-		branchSHA, exists := plumbing.ReadBranchRef(commitIsh)
+		branchSHA, exists := repo.ReadBranchRef(commitIsh)
 		if exists {
 			// commitIsh is a valid branch name
 			commitSHA = branchSHA
 		} else {
 			// Check if it is a valid commitIsh, HEAD wil be detached.
-			SHA, err := plumbing.ResolveCommitish(commitIsh)
+			SHA, err := repo.ResolveCommitish(commitIsh)
 			if err != nil {
 				fmt.Println("Error resolving commitIsh:", err)
 				os.Exit(1)
@@ -91,131 +114,232 @@ func CheckoutCommit(args []string) {
 		}
 
 		// Get TreeSHA from the commitSHA
-		commit, err := plumbing.ReadCommit(commitSHA)
+		commit, err := repo.ReadCommit(commitSHA)
 		if err != nil {
 			fmt.Println("Error reading commit SHA:", err)
 			os.Exit(1)
 		}
 
-		// If branch exists, use HEAD not detached content
+		// If branch exists, HEAD points to it, else HEAD is detached at the commit
 		if exists {
-			headContent = "ref: " + filepath.Join("refs", "heads", commitIsh) + "\n"
-		} else {
-			// commitIsh is a valid HEX SHA string
-			headContent = hex.EncodeToString(commitSHA[:]) + "\n"
+			headRef = "refs/heads/" + commitIsh
 		}
 
 		// Update WorkTree, HEAD and Index to TreeSHA.
-		if err := plumbing.CheckoutToTreeSHA(commit.TreeSHA, headContent); err != nil {
+		if err := repo.CheckoutToTreeSHA(commit.TreeSHA, headRef, commitSHA, checkoutMessage(repo, commitIsh)); err != nil {
 			fmt.Println("Error Checking out to Tree SHA:", err)
 			os.Exit(1)
 		}
 
-	case len(pos) >= 2:
-		// Checkout paths from commitish
-		commitIsh := pos[0]
-		var commitSHA [20]byte
-		filePaths := pos[1:]
+	case hasDashDash && len(revs) == 0:
+		// gegit checkout -- <path>... : restore paths from the index
+		checkoutPathsFromIndex(repo, paths)
 
-		// Check whether commitIsh is an existing branch Name
-		branchSHA, exists := plumbing.ReadBranchRef(commitIsh)
-		if exists {
-			// commitIsh is a valid branch name
-			commitSHA = branchSHA
-		} else {
-			// Check if it is a valid commitIsh, HEAD wil be detached.
-			SHA, err := plumbing.ResolveCommitish(commitIsh)
-			if err != nil {
-				fmt.Println("Error resolving commitIsh:", err)
-				os.Exit(1)
-			}
-			commitSHA = SHA
+	case hasDashDash && len(revs) == 1:
+		// gegit checkout <commit-ish> -- <path>... : restore paths from a commit
+		checkoutPathsFromCommit(repo, revs[0], paths)
+
+	case !hasDashDash && len(pos) >= 2:
+		// gegit checkout <commit-ish> <path>...
+		checkoutPathsFromCommit(repo, pos[0], pos[1:])
+
+	default:
+		fmt.Println("usage: gegit checkout [-b <new-branch>] <commit-ish> | [<commit-ish>] -- <path>...")
+		os.Exit(1)
+	}
+}
+
+// checkoutMessage returns the reflog message of a checkout to target : "checkout: moving from <branch or commit> to <target>".
+func checkoutMessage(repo *plumbing.Repository, target string) string {
+	from := "HEAD"
+	if head, err := repo.ReadHEADInfo(); err == nil {
+		from = head.Branch
+		if head.Detached {
+			from = hex.EncodeToString(head.SHA[:])
 		}
+	}
+	return fmt.Sprintf("checkout: moving from %s to %s", from, target)
+}
 
-		// Get TreeSHA from the commitSHA
-		commit, err := plumbing.ReadCommit(commitSHA)
+// previousBranchSelector parses "@{-<n>}", returning n.
+func previousBranchSelector(rev string) (int, bool) {
+	spec, ok := strings.CutPrefix(rev, "@{-")
+	if !ok || !strings.HasSuffix(spec, "}") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(spec, "}"))
+	return n, err == nil && n > 0
+}
+
+// requireMergedIndex exits when the index has unmerged paths, which switching branches would lose.
+func requireMergedIndex(repo *plumbing.Repository) {
+	entries, err := repo.LoadIndex()
+	if err != nil {
+		fmt.Println("Error loading .git/index:", err)
+		os.Exit(1)
+	}
+	unmerged, _ := plumbing.UnmergedPaths(entries)
+	if len(unmerged) == 0 {
+		return
+	}
+	fmt.Println("error: you need to resolve your current index first")
+	for _, path := range unmerged {
+		fmt.Printf("%s: needs merge\n", path)
+	}
+	os.Exit(1)
+}
+
+// checkoutPathsFromCommit restores the given paths (relative to the current directory) in both the index and the working tree from the tree of commitIsh.
+func checkoutPathsFromCommit(repo *plumbing.Repository, commitIsh string, filePaths []string) {
+	var commitSHA [20]byte
+
+	// Check whether commitIsh is an existing branch Name
+	branchSHA, exists := repo.ReadBranchRef(commitIsh)
+	if exists {
+		// commitIsh is a valid branch name
+		commitSHA = branchSHA
+	} else {
+		// Check if it is a valid commitIsh
+		SHA, err := repo.ResolveCommitish(commitIsh)
 		if err != nil {
-			fmt.Println("Error reading commit SHA:", err)
+			fmt.Println("Error resolving commitIsh:", err)
 			os.Exit(1)
 		}
+		commitSHA = SHA
+	}
+
+	// Get TreeSHA from the commitSHA
+	commit, err := repo.ReadCommit(commitSHA)
+	if err != nil {
+		fmt.Println("Error reading commit SHA:", err)
+		os.Exit(1)
+	}
+
+	// Get All Tree Entries by Flatten Tree
+	treeEntries, err := repo.FlattenTree(commit.TreeSHA)
+	if err != nil {
+		fmt.Println("Error fetching commit Tree entries:", err)
+		os.Exit(1)
+	}
+
+	// Hold index.lock from reading the index until it is written back
+	lock, err := repo.LockIndex()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
 
-		// Get All Tree Entries by Flatten Tree
-		treeEntries, err := plumbing.FlattenTree(commit.TreeSHA)
+	// Get current Index Entries
+	indexEntries, err := repo.LoadIndex()
+	if err != nil {
+		lock.Rollback()
+		fmt.Println("Error loading .git/index:", err)
+		os.Exit(1)
+	}
+	// Generate a path to IndexEntries map
+	indexEntryMap := plumbing.IndexToMap(indexEntries)
+
+	// Iterate through each path in the list, and check whether the path exist in treeEntries and indexEntryMap.
+	for _, fPath := range filePaths {
+		cleanPath, err := repo.RepoPath(fPath)
 		if err != nil {
-			fmt.Println("Error fetching commit Tree entries:", err)
-			os.Exit(1)
+			lock.Rollback()
+			fmt.Println("fatal:", err)
+			os.Exit(128)
 		}
 
-		// Get current Index Entries
-		indexEntries, err := plumbing.LoadIndex()
-		if err != nil {
-			fmt.Println("Error loading .git/index:", err)
-			os.Exit(1)
+		// If cleanPath not present in the tree, remove from Index and remove from worktree(if exists)
+		te, ok := treeEntries[cleanPath]
+		if !ok {
+			// Delete from Index , Worktree (if exists)
+			delete(indexEntryMap, cleanPath)
+			if err := os.Remove(repo.WorkPath(cleanPath)); err != nil && !os.IsNotExist(err) {
+				lock.Rollback()
+				fmt.Printf("Error deleting %s from WorkTree: %s\n", cleanPath, err)
+				os.Exit(1)
+			}
+			continue
 		}
-		// Generate a path to IndexEntries map
-		indexEntryMap := plumbing.IndexToMap(indexEntries)
 
-		// Iterate through each path in the list, and check whether the path exist in treeEntries and indexEntryMap.
-		for _, fPath := range filePaths {
-			cleanPath := filepath.ToSlash(filepath.Clean(fPath))
+		// Write to path with updated blob content. A submodule only gets its commit updated in the index.
+		if te.Mode != constants.ModeGitlink {
+			if err := writeBlobToWorkTree(repo, cleanPath, te.Mode, te.SHA); err != nil {
+				lock.Rollback()
+				fmt.Println("Error", err)
+				os.Exit(1)
+			}
+		}
 
-			// If cleanPath not present in the tree, remove from Index and remove from worktree(if exists)
-			te, ok := treeEntries[cleanPath]
-			if !ok {
-				// Delete from Index , Worktree (if exists)
-				delete(indexEntryMap, cleanPath)
-				if err := os.Remove(cleanPath); err != nil && !os.IsNotExist(err) {
-					fmt.Printf("Error deleting %s from WorkTree: %s\n", cleanPath, err)
-					os.Exit(1)
-				}
-			} else {
-				// Write to path with updated blob content.
-				shaHex := hex.EncodeToString(te.SHA[:])
-				_, content, err := plumbing.ReadObject(shaHex)
-				if err != nil {
-					fmt.Printf("Error reading blob for file '%s':%s\n", cleanPath, err)
-					os.Exit(1)
-				}
+		// Update Index Entry if exists else create one, resolving it if it was unmerged.
+		ie := indexEntryMap[cleanPath]
+		ie.SHA1 = te.SHA
+		ie.Mode = te.Mode
+		ie.Filename = te.Name
+		ie.SetStage(0)
+		indexEntryMap[cleanPath] = ie
+	}
+
+	// Iterate through the entries and extract []IndexEntry.
+	updatedIndexEntries := plumbing.IndexFromMap(indexEntryMap, indexEntries)
 
-				// Make parent directories if not present. Then write to file with updated content.
-				if err := os.MkdirAll(filepath.Dir(cleanPath), constants.DefaultDirPerm); err != nil {
-					fmt.Println("Error creating Directories:", err)
+	// Write the Index based on these new []IndexEntry slice. Will automatically sort based on Filename.
+	if err := repo.WriteIndex(lock, updatedIndexEntries); err != nil {
+		fmt.Printf("couldn't update .git/index: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// checkoutPathsFromIndex overwrites the given paths (relative to the current directory) in the working tree with their staged contents. The index is left untouched.
+func checkoutPathsFromIndex(repo *plumbing.Repository, filePaths []string) {
+
+	// Get current Index Entries
+	indexEntries, err := repo.LoadIndex()
+	if err != nil {
+		fmt.Println("Error loading .git/index:", err)
+		os.Exit(1)
+	}
+	indexEntryMap := plumbing.IndexToMap(indexEntries)
+
+	for _, fPath := range filePaths {
+		cleanPath, err := repo.RepoPath(fPath)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
+
+		// A directory restores every staged file below it
+		matched := false
+		for path, ie := range indexEntryMap {
+			if path == cleanPath || cleanPath == "" || strings.HasPrefix(path, cleanPath+"/") {
+				if ie.Stage() != 0 {
+					fmt.Printf("error: path '%s' is unmerged\n", path)
 					os.Exit(1)
 				}
-				if err := os.WriteFile(cleanPath, content, constants.DefaultFilePerm); err != nil {
-					fmt.Printf("Error writing to file '%s': %s\n", cleanPath, err)
+				if err := writeBlobToWorkTree(repo, path, ie.Mode, ie.SHA1); err != nil {
+					fmt.Println("Error", err)
 					os.Exit(1)
 				}
-
-				// Update Index Entry if exists else create one.
-				if ie, ok := indexEntryMap[cleanPath]; ok {
-					ie.SHA1 = te.SHA
-					ie.Mode = te.Mode
-					ie.Filename = te.Name
-				} else {
-					indexEntryMap[cleanPath] = types.IndexEntry{
-						SHA1:     te.SHA,
-						Filename: te.Name,
-						Mode:     te.Mode,
-					}
-				}
+				matched = true
 			}
 		}
-
-		// Iterate through the entries and extract []IndexEntry.
-		updatedIndexEntries := make([]types.IndexEntry, 0, len(indexEntryMap))
-		for _, ie := range indexEntryMap {
-			updatedIndexEntries = append(updatedIndexEntries, ie)
-		}
-
-		// Write the Index based on these new []IndexEntry slice. Will automatically sort based on Filename.
-		if err := plumbing.WriteIndex(updatedIndexEntries); err != nil {
-			fmt.Printf("couldn't update .git/index: %s\n", err)
+		if !matched {
+			fmt.Printf("error: pathspec '%s' did not match any file(s) known to git\n", fPath)
 			os.Exit(1)
 		}
+	}
+}
 
-	default:
-		fmt.Println("usage: gegit checkout [-b <new-branch>] <commit-ish> [-- <path>]")
-		os.Exit(1)
+// writeBlobToWorkTree writes the content of a blob to a working tree path according to its mode, creating parent directories as needed.
+func writeBlobToWorkTree(repo *plumbing.Repository, path string, mode uint32, sha [20]byte) error {
+	shaHex := hex.EncodeToString(sha[:])
+	_, content, err := repo.ReadObject(shaHex)
+	if err != nil {
+		return fmt.Errorf("reading blob for file '%s': %s", path, err)
+	}
+
+	// Write to file (or symbolic link) with updated content.
+	if err := repo.WriteWorkTreeFile(path, mode, content); err != nil {
+		return fmt.Errorf("writing to file '%s': %s", path, err)
 	}
+	return nil
 }
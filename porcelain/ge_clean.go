@@ -0,0 +1,192 @@
+package porcelain
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+)
+
+// errKeepPath stops a walk as soon as a path which must be kept is found.
+var errKeepPath = errors.New("found path to keep")
+
+// Invoked from main.go. CleanWorkTree handles the 'gegit clean' command to remove untracked files from the working tree.
+func CleanWorkTree(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("clean",
+		"Cleans the working tree by recursively removing files that are not under version control, starting from the current directory. Only files unknown to Git are removed, and files ignored by .gitignore are kept unless -x or -X is given.",
+		"gegit clean [-n] [-f] [-d] [-x | -X] [<path>...]")
+	dryRun := fls.Bool("n", false, "Don't actually remove anything, just show what would be done.")
+	force := fls.Bool("f", false, "Required to delete files unless clean.requireForce is set to false.")
+	dirs := fls.Bool("d", false, "Recurse into untracked directories and remove them as a whole.")
+	withIgnored := fls.Bool("x", false, "Don't use the standard ignore rules, also remove ignored files.")
+	onlyIgnored := fls.Bool("X", false, "Remove only files ignored by Git.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	if *withIgnored && *onlyIgnored {
+		fmt.Println("fatal: -x and -X cannot be used together")
+		os.Exit(128)
+	}
+
+	// Refuse to delete anything without -f, unless clean.requireForce is false
+	if !*dryRun && !*force {
+		if requireForce, err := repo.GetConfig("clean.requireForce"); err != nil || requireForce != "false" {
+			fmt.Println("fatal: clean.requireForce defaults to true and neither -n nor -f given; refusing to clean")
+			os.Exit(128)
+		}
+	}
+
+	// Load the ignore rules
+	matcher, err := repo.NewIgnoreMatcher()
+	if err != nil {
+		fmt.Println("Error loading ignore rules:", err)
+		os.Exit(1)
+	}
+
+	// Tracked files, and every directory containing one
+	entries, err := repo.LoadIndex()
+	if err != nil {
+		fmt.Println("Error loading index:", err)
+		os.Exit(1)
+	}
+	tracked := map[string]bool{}
+	trackedDirs := map[string]bool{}
+	for _, ie := range entries {
+		tracked[ie.Filename] = true
+		for dir := filepath.ToSlash(filepath.Dir(ie.Filename)); dir != "."; dir = filepath.ToSlash(filepath.Dir(dir)) {
+			trackedDirs[dir] = true
+		}
+	}
+
+	// Whether an untracked path should be removed, depending on its ignored state
+	selected := func(ignored bool) bool {
+		switch {
+		case *withIgnored:
+			return true
+		case *onlyIgnored:
+			return ignored
+		default:
+			return !ignored
+		}
+	}
+
+	// Default to the current directory
+	if len(pos) == 0 {
+		pos = []string{"."}
+	}
+
+	// Collect paths to remove, directories end with "/"
+	toRemove := map[string]bool{}
+	for _, arg := range pos {
+		rel, err := repo.RepoPath(arg)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
+
+		// A single file
+		info, err := os.Lstat(repo.WorkPath(rel))
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			if !tracked[rel] && selected(matcher.IsIgnored(rel, false)) {
+				toRemove[rel] = true
+			}
+			continue
+		}
+
+		_ = repo.WalkWorkTree(rel, matcher, func(path string, d fs.DirEntry, ignored bool) error {
+			if !d.IsDir() {
+				if !tracked[path] && selected(ignored) {
+					toRemove[path] = true
+				}
+				return nil
+			}
+
+			// Directories containing tracked files are always descended into
+			if trackedDirs[path] {
+				return nil
+			}
+
+			// Untracked directories are only touched with -d, and nested repositories never
+			if !*dirs {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(repo.WorkPath(path), ".git")); err == nil {
+				return filepath.SkipDir
+			}
+
+			switch {
+			case ignored && selected(true):
+				// Ignored directory removed as a whole
+				toRemove[path+"/"] = true
+				return filepath.SkipDir
+			case ignored:
+				return filepath.SkipDir
+			case allSelected(repo, matcher, path, selected, *onlyIgnored):
+				// Untracked directory removed as a whole, unless some files inside need to be kept
+				toRemove[path+"/"] = true
+				return filepath.SkipDir
+			default:
+				return nil
+			}
+		})
+	}
+
+	// Remove (or report) each path in order
+	paths := make([]string, 0, len(toRemove))
+	for path := range toRemove {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// Paths are reported relative to the current directory
+	cwd, _ := os.Getwd()
+	for _, path := range paths {
+		display := path
+		if rel, err := filepath.Rel(cwd, repo.WorkPath(path)); err == nil {
+			display = filepath.ToSlash(rel)
+			if strings.HasSuffix(path, "/") {
+				display += "/"
+			}
+		}
+
+		if *dryRun {
+			fmt.Printf("Would remove %s\n", display)
+			continue
+		}
+		fmt.Printf("Removing %s\n", display)
+		if err := os.RemoveAll(repo.WorkPath(path)); err != nil {
+			fmt.Printf("warning: failed to remove %s: %s\n", path, err)
+		}
+	}
+}
+
+// allSelected reports whether every file below dir would be removed. With requireFiles, directories without any file are kept.
+func allSelected(repo *plumbing.Repository, matcher *plumbing.IgnoreMatcher, dir string, selected func(ignored bool) bool, requireFiles bool) bool {
+	files := 0
+	err := repo.WalkWorkTree(dir, matcher, func(path string, d fs.DirEntry, ignored bool) error {
+		if d.IsDir() {
+			return nil
+		}
+		if !selected(ignored) {
+			return errKeepPath
+		}
+		files++
+		return nil
+	})
+	return err == nil && (files > 0 || !requireFiles)
+}
@@ -4,15 +4,17 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/brickster241/GitEngine/plumbing"
 	"github.com/brickster241/GitEngine/utils"
+	"github.com/brickster241/GitEngine/utils/types"
 )
 
 // Invoked from main.go. CommitChanges handles the 'gegit commit' command to commit changes to the repository.
 // It creates a new commit containing the current contents of the index and the given log message describing the changes. The new commit is a direct child of HEAD, usually the tip of the current branch, and the branch is updated to point to it
-func CommitChanges(args []string) {
+func CommitChanges(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("commit",
@@ -27,34 +29,74 @@ func CommitChanges(args []string) {
 	pos := fls.Args()
 
 	// Check if there are any args left
-	if *message == "" || len(pos) != 0 {
+	if len(pos) != 0 {
 		fmt.Println("usage: gegit commit -m <message>")
 		os.Exit(1)
 	}
 
+	// Without a message, a merge in progress uses the one it prepared
+	if *message == "" {
+		if _, err := os.Stat(repo.GitPath("MERGE_HEAD")); err != nil {
+			fmt.Println("usage: gegit commit -m <message>")
+			os.Exit(1)
+		}
+		mergeMessage, err := repo.ReadMergeMessage()
+		if err != nil {
+			fmt.Println("Error reading .git/MERGE_MSG:", err)
+			os.Exit(1)
+		}
+		*message = mergeMessage
+	}
+
+	commitIndex(repo, *message, "")
+}
+
+// commitIndex creates a commit from the index with the given message on top of HEAD, and moves HEAD (or its branch) to it. When a merge is in progress, the merged commits are added as parents and the merge is concluded. The move is recorded in the reflogs with reflogMessage, or "commit: <subject>" when empty.
+func commitIndex(repo *plumbing.Repository, message string, reflogMessage string) {
+
+	// Hold index.lock from reading the index until the commit is recorded, the cache-tree being written back last
+	lock, err := repo.LockIndex()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+
 	// Load the index
-	entries, err := plumbing.LoadIndex()
+	index, err := repo.ReadIndexFile()
 	if err != nil {
+		lock.Rollback()
 		fmt.Println("Error loading index:", err)
 		os.Exit(1)
-	} else if len(entries) == 0 {
+	}
+	entries := index.Entries
+	if len(entries) == 0 {
+		lock.Rollback()
 		fmt.Println("Error: Nothing to commmit")
 		os.Exit(1)
 	}
 
-	// Build in-memory tree structure
-	root := plumbing.BuildTreeFromIndex(entries)
+	// Unmerged paths must be resolved first
+	if slices.ContainsFunc(entries, func(ie types.IndexEntry) bool { return ie.Stage() != 0 }) {
+		lock.Rollback()
+		fmt.Println("error: Committing is not possible because you have unmerged files.")
+		fmt.Println("hint: Fix them up in the work tree, and then use 'gegit add/rm <file>'")
+		fmt.Println("hint: as appropriate to mark resolution and make a commit.")
+		fmt.Println("fatal: Exiting because of an unresolved conflict.")
+		os.Exit(128)
+	}
 
-	// Write tree Objects (recursive)
-	treeSHA, err := plumbing.WriteTree(root)
+	// Write tree Objects, reusing the unchanged directories of the cache-tree
+	treeSHA, updated, err := repo.WriteIndexTree(index)
 	if err != nil {
+		lock.Rollback()
 		fmt.Println("Error writing tree object:", err)
 		os.Exit(1)
 	}
 
 	// Read HEAD (for a parent commit, if any)
-	headInfo, err := plumbing.ReadHEADInfo()
+	headInfo, err := repo.ReadHEADInfo()
 	if err != nil {
+		lock.Rollback()
 		fmt.Println("Error reading .git/HEAD:", err)
 		os.Exit(1)
 	}
@@ -66,50 +108,91 @@ func CommitChanges(args []string) {
 		parentsSHA = append(parentsSHA, headInfo.SHA)
 	}
 
-	// Check if there are no changes between Head tree and current index tree
-	if len(parentsSHA) > 0 {
-		headCommit, err := plumbing.ReadCommit(parentsSHA[0])
+	// Commits being merged are the other parents
+	mergeHeads, err := repo.ReadMergeHeads()
+	if err != nil {
+		lock.Rollback()
+		fmt.Println("Error reading .git/MERGE_HEAD:", err)
+		os.Exit(1)
+	}
+	parentsSHA = append(parentsSHA, mergeHeads...)
+
+	// Check if there are no changes between Head tree and current index tree. A merge commit is always created.
+	if len(parentsSHA) == 1 {
+		headCommit, err := repo.ReadCommit(parentsSHA[0])
 		if err == nil && headCommit.TreeSHA == treeSHA {
+			lock.Rollback()
 			fmt.Println("nothing to commit, working tree clean")
 			os.Exit(0)
 		} else if err != nil {
+			lock.Rollback()
 			fmt.Println("Error reading HEAD commit:", err)
 			os.Exit(1)
 		}
 	}
 
 	// Author, Committer Info
-	author, err := getAuthorInfo()
+	author, err := getAuthorInfo(repo)
 	if err != nil {
+		lock.Rollback()
 		fmt.Println("Error fetching author info from .git/config:", err)
 		os.Exit(1)
 	}
 
 	// Write commit object
-	commitSHA, err := plumbing.WriteCommit(treeSHA, parentsSHA, author, *message)
+	commitSHA, err := repo.WriteCommit(treeSHA, parentsSHA, author, message)
 	if err != nil {
+		lock.Rollback()
 		fmt.Println("Error writing commit object:", err)
 		os.Exit(1)
 	}
 
+	// Reflog message, telling first and merge commits apart
+	if reflogMessage == "" {
+		switch {
+		case len(parentsSHA) == 0:
+			reflogMessage = "commit (initial): " + commitSubject(message)
+		case len(mergeHeads) > 0:
+			reflogMessage = "commit (merge): " + commitSubject(message)
+		default:
+			reflogMessage = "commit: " + commitSubject(message)
+		}
+	}
+
 	// Update HEAD reference
 	if headInfo.Detached {
-		if err := plumbing.UpdateHEADDetached(commitSHA); err != nil {
+		if err := repo.UpdateHEADDetached(commitSHA, headInfo.SHA, reflogMessage); err != nil {
+			lock.Rollback()
 			fmt.Println("Error updating .git/HEAD:", err)
 			os.Exit(1)
 		}
 	} else {
-		if err := plumbing.UpdateBranchRefWithSHA(headInfo.Branch, commitSHA); err != nil {
+		if err := repo.UpdateBranchRefWithSHA(headInfo.Branch, commitSHA, headInfo.SHA, reflogMessage); err != nil {
+			lock.Rollback()
 			fmt.Println("Error updating .git/HEAD:", err)
 			os.Exit(1)
 		}
 	}
 
+	// Record the new trees in the cache-tree, releasing index.lock
+	if !updated {
+		lock.Rollback()
+	} else if err := repo.WriteIndexFile(lock, index); err != nil {
+		fmt.Printf("couldn't update .git/index: %s\n", err)
+		os.Exit(1)
+	}
+
+	// The merge is concluded
+	if err := repo.ClearMergeState(); err != nil {
+		fmt.Println("Error removing merge state:", err)
+		os.Exit(1)
+	}
+
 	// hex value of Commit SHA, print it on the console.
 	commitHex := hex.EncodeToString(commitSHA[:])
 
 	fmt.Printf("[%s] %s\n",
 		commitHex[:6],
-		strings.Split(*message, "\n")[0],
+		strings.Split(message, "\n")[0],
 	)
 }
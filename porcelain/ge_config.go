@@ -3,16 +3,14 @@ package porcelain
 import (
 	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
 
+	"github.com/brickster241/GitEngine/plumbing"
 	"github.com/brickster241/GitEngine/utils"
 	"github.com/brickster241/GitEngine/utils/types"
-	"gopkg.in/ini.v1"
 )
 
 // Invoked from main.go. GetOrSetConfig handles 'gegit config' command which is stored at .git/config.
-func GetOrSetConfig(args []string) {
+func GetOrSetConfig(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("config",
@@ -38,15 +36,16 @@ func GetOrSetConfig(args []string) {
 			os.Exit(1)
 		}
 
-		if err := setConfig(pos[1], pos[2]); err != nil {
+		if err := repo.SetConfig(pos[1], pos[2]); err != nil {
 			fmt.Println("Error setting Config:", err)
+			os.Exit(1)
 		}
 	case "get": // Get config value for specific key
 		if len(pos) != 2 {
 			fmt.Println("usage: gegit config get <key>")
 			os.Exit(1)
 		}
-		val, err := getConfig(pos[1])
+		val, err := repo.GetConfig(pos[1])
 		if err != nil {
 			fmt.Println("Error getting Config:", err)
 			os.Exit(1)
@@ -61,68 +60,17 @@ func GetOrSetConfig(args []string) {
 
 }
 
-// Get Value for a specific Config key.
-func getConfig(key string) (string, error) {
-
-	// .git/config file Path
-	cfgPath := filepath.Join(".git", "config")
-
-	// Load the config file
-	cfg, err := ini.Load(cfgPath)
-	if err != nil {
-		return "", err
-	}
-
-	parts := strings.SplitN(key, ".", 2)
-	if len(parts) != 2 {
-		return "", fmt.Errorf("invalid config key: %s", key)
-	}
-
-	// Check val for specific key
-	section, name := parts[0], parts[1]
-	val := cfg.Section(section).Key(name).String()
-	if val == "" {
-		return "", fmt.Errorf("config key not found: %s", key)
-	}
-
-	return val, nil
-}
-
-// Set Value for a specific Config key.
-func setConfig(key, value string) error {
-
-	// .git/config file Path
-	cfgPath := filepath.Join(".git", "config")
-
-	// Load the config file
-	cfg, err := ini.Load(cfgPath)
-	if err != nil {
-		return err
-	}
-
-	parts := strings.SplitN(key, ".", 2)
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid config key: %s", key)
-	}
-
-	// Check val for specific key
-	section, name := parts[0], parts[1]
-	cfg.Section(section).Key(name).SetValue(value)
-
-	return cfg.SaveTo(cfgPath)
-}
-
 // getAuthorInfo fetches the Author information present in .git/config
-func getAuthorInfo() (types.Author, error) {
+func getAuthorInfo(repo *plumbing.Repository) (types.Author, error) {
 
 	// Get user.name
-	name, err := getConfig("user.name")
+	name, err := repo.GetConfig("user.name")
 	if err != nil {
 		return types.Author{}, err
 	}
 
 	// Get user.email
-	email, err := getConfig("user.email")
+	email, err := repo.GetConfig("user.email")
 	if err != nil {
 		return types.Author{}, err
 	}
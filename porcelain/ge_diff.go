@@ -0,0 +1,313 @@
+package porcelain
+
+import (
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/diff"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// diffFile is one side of a file comparison. Working tree files carry their content, the others are read from the object store when needed.
+type diffFile struct {
+	sha     [20]byte
+	mode    uint32
+	content []byte
+	loaded  bool
+}
+
+// "-U5" is rewritten to "-U=5" for the flag parser
+var unifiedShortRegex = regexp.MustCompile(`^-U(\d+)$`)
+
+// Invoked from main.go. ShowDiff handles the 'gegit diff' command to show changes between the working tree and the index, the index and a commit, or two commits.
+func ShowDiff(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("diff",
+		"Show changes between the working tree and the index, changes between the index and a commit (--cached), changes between a commit and the working tree, or changes between two commits.",
+		"gegit diff [--cached] [-U <n>] [--diff-algorithm=<algorithm>] [<commit> [<commit>]] [-- <path>...]")
+	cached := fls.Bool("cached", false, "View the changes you staged for the next commit relative to the named <commit> (HEAD by default).")
+	staged := fls.Bool("staged", false, "Same as --cached.")
+	context := diff.DefaultContext
+	fls.IntVar(&context, "U", diff.DefaultContext, "Generate diffs with <n> lines of context.")
+	fls.IntVar(&context, "unified", diff.DefaultContext, "Same as -U.")
+	algoName := fls.String("diff-algorithm", "myers", "Choose a diff algorithm : myers, patience or histogram.")
+	patience := fls.Bool("patience", false, "Generate a diff using the patience diff algorithm.")
+	histogram := fls.Bool("histogram", false, "Generate a diff using the histogram diff algorithm.")
+
+	// Parse flags from args
+	flagArgs := slices.Clone(args[1:])
+	for i, arg := range flagArgs {
+		if arg == "--" {
+			break
+		}
+		flagArgs[i] = unifiedShortRegex.ReplaceAllString(arg, "-U=$1")
+	}
+	fls.Parse(flagArgs)
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	// Everything after "--" is a path. The flag parser swallows a leading "--", so check the raw arguments as well.
+	revs, paths := pos, []string{}
+	if idx := slices.Index(pos, "--"); idx != -1 {
+		revs, paths = pos[:idx], pos[idx+1:]
+	} else if slices.Contains(args[1:], "--") {
+		revs, paths = []string{}, pos
+	}
+
+	// "A..B" is the same as "A B"
+	if len(revs) == 1 && strings.Contains(revs[0], "..") {
+		from, to, _ := strings.Cut(revs[0], "..")
+		revs = []string{cmp.Or(from, "HEAD"), cmp.Or(to, "HEAD")}
+	}
+
+	// Choose the algorithm
+	algo, err := diff.ParseAlgorithm(*algoName)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+	if *patience {
+		algo = diff.Patience
+	}
+	if *histogram {
+		algo = diff.Histogram
+	}
+
+	// Paths relative to the root of the working tree
+	repoPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		rel, err := repo.RepoPath(p)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
+		repoPaths = append(repoPaths, rel)
+	}
+
+	// Both sides of the comparison
+	var oldSide, newSide map[string]*diffFile
+	switch {
+	case (*cached || *staged) && len(revs) <= 1:
+		// gegit diff --cached [<commit>] : commit (HEAD by default) <-> index
+		rev := "HEAD"
+		if len(revs) == 1 {
+			rev = revs[0]
+		}
+		oldSide = diffTreeSide(repo, rev, true)
+		newSide = diffIndexSide(repo)
+
+	case *cached || *staged || len(revs) > 2:
+		fmt.Println("usage: gegit diff [--cached] [-U <n>] [--diff-algorithm=<algorithm>] [<commit> [<commit>]] [-- <path>...]")
+		os.Exit(1)
+
+	case len(revs) == 0:
+		// gegit diff : index <-> working tree
+		oldSide = diffIndexSide(repo)
+		newSide = diffWorkTreeSide(repo, oldSide, oldSide)
+
+	case len(revs) == 1:
+		// gegit diff <commit> : commit <-> working tree, for tracked files
+		oldSide = diffTreeSide(repo, revs[0], false)
+		newSide = diffWorkTreeSide(repo, diffIndexSide(repo), oldSide)
+
+	default:
+		// gegit diff <commit> <commit>
+		oldSide = diffTreeSide(repo, revs[0], false)
+		newSide = diffTreeSide(repo, revs[1], false)
+	}
+
+	// Every path present on either side, in order
+	allPaths := []string{}
+	for path := range oldSide {
+		allPaths = append(allPaths, path)
+	}
+	for path := range newSide {
+		if _, ok := oldSide[path]; !ok {
+			allPaths = append(allPaths, path)
+		}
+	}
+	sort.Strings(allPaths)
+
+	for _, path := range allPaths {
+		if len(repoPaths) > 0 && !slices.ContainsFunc(repoPaths, func(p string) bool {
+			return p == "" || path == p || strings.HasPrefix(path, p+"/")
+		}) {
+			continue
+		}
+		printFileDiff(repo, path, oldSide[path], newSide[path], context, algo)
+	}
+}
+
+// diffTreeSide returns the blobs of the tree of a commit-ish. With allowUnborn, HEAD without any commit gives an empty side.
+func diffTreeSide(repo *plumbing.Repository, rev string, allowUnborn bool) map[string]*diffFile {
+	side := map[string]*diffFile{}
+
+	if allowUnborn && rev == "HEAD" {
+		if head, err := repo.ReadHEADInfo(); err == nil && head.SHA == [20]byte{} {
+			return side
+		}
+	}
+
+	commitSHA, err := repo.ResolveCommitish(rev)
+	if err != nil {
+		fmt.Printf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.\n", rev)
+		os.Exit(128)
+	}
+	commit, err := repo.ReadCommit(commitSHA)
+	if err != nil {
+		fmt.Println("Error reading commit:", err)
+		os.Exit(1)
+	}
+	entries, err := repo.FlattenTree(commit.TreeSHA)
+	if err != nil {
+		fmt.Println("Error reading tree:", err)
+		os.Exit(1)
+	}
+	for path, te := range entries {
+		if te.Type == types.BlobObject {
+			side[path] = &diffFile{sha: te.SHA, mode: te.Mode}
+		}
+	}
+	return side
+}
+
+// diffIndexSide returns the staged files, submodules left out like in diffTreeSide.
+func diffIndexSide(repo *plumbing.Repository) map[string]*diffFile {
+	entries, err := repo.LoadIndex()
+	if err != nil {
+		fmt.Println("Error loading index:", err)
+		os.Exit(1)
+	}
+	side := map[string]*diffFile{}
+	for _, ie := range entries {
+		if ie.Mode != constants.ModeGitlink {
+			side[ie.Filename] = &diffFile{sha: ie.SHA1, mode: ie.Mode}
+		}
+	}
+	return side
+}
+
+// diffWorkTreeSide returns the working tree files for the paths of tracked and also (if they exist) the paths of other. The index is used to resolve modes when core.filemode is false.
+func diffWorkTreeSide(repo *plumbing.Repository, tracked, other map[string]*diffFile) map[string]*diffFile {
+	fileModeTrusted := repo.FileModeTrusted()
+	side := map[string]*diffFile{}
+
+	for _, paths := range []map[string]*diffFile{tracked, other} {
+		for path := range paths {
+			if _, done := side[path]; done {
+				continue
+			}
+			content, info, err := repo.ReadWorkTreeFile(path)
+			if err != nil {
+				continue
+			}
+			sha, err := plumbing.HashObject(types.BlobObject, content)
+			if err != nil {
+				fmt.Println("Error Hashing File:", err)
+				os.Exit(1)
+			}
+			prevMode := uint32(0)
+			if ie, ok := tracked[path]; ok {
+				prevMode = ie.mode
+			}
+			side[path] = &diffFile{
+				sha:     sha,
+				mode:    plumbing.ResolveFileMode(plumbing.WorkTreeMode(info), prevMode, fileModeTrusted),
+				content: content,
+				loaded:  true,
+			}
+		}
+	}
+	return side
+}
+
+// load returns the content of a diff side, reading the blob if needed.
+func (f *diffFile) load(repo *plumbing.Repository) []byte {
+	if !f.loaded {
+		_, content, err := repo.ReadObject(hex.EncodeToString(f.sha[:]))
+		if err != nil {
+			fmt.Println("Error reading blob:", err)
+			os.Exit(1)
+		}
+		f.content, f.loaded = content, true
+	}
+	return f.content
+}
+
+// printFileDiff prints the git-style diff of one path. A nil side means the file doesn't exist there.
+func printFileDiff(repo *plumbing.Repository, path string, oldFile, newFile *diffFile, context int, algo diff.Algorithm) {
+
+	// Unchanged
+	if oldFile != nil && newFile != nil && oldFile.sha == newFile.sha && oldFile.mode == newFile.mode {
+		return
+	}
+
+	// A change between a symbolic link and a file is shown as a deletion followed by a creation
+	if oldFile != nil && newFile != nil && (oldFile.mode == constants.ModeSymlink) != (newFile.mode == constants.ModeSymlink) {
+		printFileDiff(repo, path, oldFile, nil, context, algo)
+		printFileDiff(repo, path, nil, newFile, context, algo)
+		return
+	}
+
+	fmt.Printf("diff --git a/%s b/%s\n", path, path)
+
+	oldName, newName := "a/"+path, "b/"+path
+	var oldContent, newContent []byte
+	oldHex, newHex := strings.Repeat("0", 7), strings.Repeat("0", 7)
+
+	switch {
+	case oldFile == nil:
+		fmt.Printf("new file mode %06o\n", newFile.mode)
+		oldName = "/dev/null"
+	case newFile == nil:
+		fmt.Printf("deleted file mode %06o\n", oldFile.mode)
+		newName = "/dev/null"
+	case oldFile.mode != newFile.mode:
+		fmt.Printf("old mode %06o\n", oldFile.mode)
+		fmt.Printf("new mode %06o\n", newFile.mode)
+	}
+	if oldFile != nil {
+		oldHex = hex.EncodeToString(oldFile.sha[:])[:7]
+		oldContent = oldFile.load(repo)
+	}
+	if newFile != nil {
+		newHex = hex.EncodeToString(newFile.sha[:])[:7]
+		newContent = newFile.load(repo)
+	}
+
+	// Mode change only
+	if oldFile != nil && newFile != nil && oldFile.sha == newFile.sha {
+		return
+	}
+
+	// "index <old>..<new>", with the mode when it didn't change
+	if oldFile != nil && newFile != nil && oldFile.mode == newFile.mode {
+		fmt.Printf("index %s..%s %06o\n", oldHex, newHex, oldFile.mode)
+	} else {
+		fmt.Printf("index %s..%s\n", oldHex, newHex)
+	}
+
+	if diff.IsBinary(oldContent) || diff.IsBinary(newContent) {
+		fmt.Printf("Binary files %s and %s differ\n", oldName, newName)
+		return
+	}
+
+	// File headers are only printed when there are hunks (not for empty files)
+	hunks := diff.Unified(oldContent, newContent, context, algo)
+	if hunks == "" {
+		return
+	}
+	fmt.Printf("--- %s\n+++ %s\n", oldName, newName)
+	fmt.Print(hunks)
+}
@@ -0,0 +1,104 @@
+package porcelain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+)
+
+// Invoked from main.go. CheckRepository handles the 'gegit fsck' command to verify the connectivity and validity of the repository data.
+func CheckRepository(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("fsck",
+		"Verifies the connectivity and validity of the data in the repository : every object is rehashed and checked, HEAD, refs, reflogs and the index must point to existing objects, and unreachable objects are reported. Exits with a non-zero status when an error is found. With --index, checks the index file only : its checksum, its entries and the objects they point to, and its cache-tree.",
+		"gegit fsck [--unreachable] [--no-dangling] | --index [--repair]")
+	unreachable := fls.Bool("unreachable", false, "Print the objects which exist but aren't reachable from any ref, reflog or the index.")
+	noDangling := fls.Bool("no-dangling", false, "Don't print dangling objects, unreachable objects which no other object points to.")
+	index := fls.Bool("index", false, "Check the index file only.")
+	repair := fls.Bool("repair", false, "When the index is corrupt, rebuild it from the tree of HEAD. Changes staged since are lost, the working tree is left untouched.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	if len(pos) != 0 || (*repair && !*index) {
+		fmt.Println("usage: gegit fsck [--unreachable] [--no-dangling] | --index [--repair]")
+		os.Exit(1)
+	}
+
+	if !*index {
+		checkAll(repo, *unreachable, !*noDangling)
+		return
+	}
+
+	// Report every problem found, an unreadable index being one
+	problems, err := repo.CheckIndex()
+	if err != nil {
+		problems = []string{err.Error()}
+	}
+	for _, problem := range problems {
+		fmt.Println("error:", problem)
+	}
+	if len(problems) == 0 {
+		return
+	}
+
+	if !*repair {
+		fmt.Println("hint: use 'gegit fsck --index --repair' to rebuild the index from HEAD")
+		os.Exit(1)
+	}
+
+	// Rebuild the index from HEAD (empty on an unborn branch)
+	treeSHA, hasCommits, err := repo.ReadHEADTreeSHA()
+	if err != nil {
+		fmt.Println("Error reading HEAD tree:", err)
+		os.Exit(1)
+	}
+	lock, err := repo.LockIndex()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+	if err := repo.ResetIndexToTree(lock, treeSHA); err != nil {
+		fmt.Println("Error rebuilding index:", err)
+		os.Exit(1)
+	}
+	if hasCommits {
+		fmt.Printf("Rebuilt the index from HEAD's tree %s\n", hex.EncodeToString(treeSHA[:]))
+	} else {
+		fmt.Println("Emptied the index, HEAD has no commits yet")
+	}
+}
+
+// checkAll runs the full repository check and prints its problems, then the unreachable or dangling objects asked for. Exits with 1 when an error was found.
+func checkAll(repo *plumbing.Repository, unreachable bool, dangling bool) {
+	result, err := repo.Fsck()
+	if err != nil {
+		fmt.Println("Error checking repository:", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, problem := range result.Problems {
+		fmt.Println(problem.Text)
+		failed = failed || problem.Error
+	}
+	if unreachable {
+		for _, obj := range result.Unreachable {
+			fmt.Printf("unreachable %s %s\n", obj.Type, hex.EncodeToString(obj.SHA[:]))
+		}
+	} else if dangling {
+		for _, obj := range result.Dangling {
+			fmt.Printf("dangling %s %s\n", obj.Type, hex.EncodeToString(obj.SHA[:]))
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,49 @@
+package porcelain
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+)
+
+// Invoked from main.go. GarbageCollect handles the 'gegit gc' command to pack all reachable objects, drop redundant loose objects and prune old unreachable ones.
+func GarbageCollect(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("gc",
+		"Runs a number of housekeeping tasks within the current repository, such as compressing all reachable objects into a single delta-compressed pack, removing the loose objects (and old packs) it replaces, and pruning unreachable loose objects older than gc.pruneExpire (2 weeks ago by default).",
+		"gegit gc [-aggressive] [--prune <time>]")
+	aggressive := fls.Bool("aggressive", false, "More aggressively optimize the repository at the expense of taking much more time.")
+	pruneExpire := fls.String("prune", "", "Prune unreachable loose objects older than <time>, instead of gc.pruneExpire (\"never\" keeps them all).")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	if len(pos) != 0 {
+		fmt.Println("usage: gegit gc [-aggressive] [--prune <time>]")
+		os.Exit(1)
+	}
+
+	// Aggressive mode looks much further back for delta bases
+	window := plumbing.DefaultPackWindow
+	if *aggressive {
+		window = 250
+	}
+
+	// Equivalent of repack -a -d
+	if err := repack(repo, true, true, window, plumbing.DefaultPackDepth, *pruneExpire); err != nil {
+		fmt.Println("Error running gc:", err)
+		os.Exit(1)
+	}
+
+	// Equivalent of prune --expire <gc.pruneExpire>
+	if err := prune(repo, *pruneExpire, false, false); err != nil {
+		fmt.Println("Error running gc:", err)
+		os.Exit(1)
+	}
+}
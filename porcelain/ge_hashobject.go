@@ -12,7 +12,7 @@ import (
 )
 
 // Invoked from main.go. Computes the object ID value for an object with specified type with the contents of the named file (which can be outside of the work tree), and optionally writes the resulting object into the object database.
-func HashAndWriteObject(args []string) {
+func HashAndWriteObject(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("hash-object",
@@ -49,7 +49,7 @@ func HashAndWriteObject(args []string) {
 
 	if *write {
 		// Compute hash and also write in the object database
-		sha, err = plumbing.WriteObject(types.ObjectType(*objType), data)
+		sha, err = repo.WriteObject(types.ObjectType(*objType), data)
 		if err != nil {
 			fmt.Println("Error hashing file:", err)
 			os.Exit(1)
@@ -0,0 +1,304 @@
+package porcelain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// Invoked from main.go. ShowLog handles the 'gegit log' command to show the commit logs.
+func ShowLog(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("log",
+		"Shows the commit logs. List commits that are reachable by following the parent links from the given commit(s) (HEAD by default), most recent first.",
+		"gegit log [-n <number>] [--oneline] [--format=<format>] [--author=<pattern>] [--since=<date>] [--until=<date>] [--first-parent] [<revision>...] [-- <path>...]")
+	maxCount := -1
+	fls.IntVar(&maxCount, "n", -1, "Limit the number of commits to output.")
+	fls.IntVar(&maxCount, "max-count", -1, "Limit the number of commits to output.")
+	oneline := fls.Bool("oneline", false, "Show each commit on a single line : the abbreviated commit SHA and the title line.")
+	format := fls.String("format", "", "Pretty-print each commit using placeholders : %H (commit hash), %h (abbreviated hash), %an (author name), %ae (author email), %ad (author date), %s (subject), %b (body), %n (newline), %% (a raw %).")
+	author := fls.String("author", "", "Limit the commits output to ones with author header lines that match the specified pattern (regular expression).")
+	since := fls.String("since", "", "Show commits more recent than a specific date.")
+	after := fls.String("after", "", "Same as --since.")
+	until := fls.String("until", "", "Show commits older than a specific date.")
+	before := fls.String("before", "", "Same as --until.")
+	firstParent := fls.Bool("first-parent", false, "When finding commits to include, follow only the first parent commit upon seeing a merge commit.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	// Everything after "--" is a path. The flag parser swallows a leading "--", so check the raw arguments as well.
+	revs, paths := pos, []string{}
+	if idx := slices.Index(pos, "--"); idx != -1 {
+		revs, paths = pos[:idx], pos[idx+1:]
+	} else if slices.Contains(args[1:], "--") {
+		revs, paths = []string{}, pos
+	}
+
+	// Compile the author pattern
+	var authorRegex *regexp.Regexp
+	if *author != "" {
+		var err error
+		if authorRegex, err = regexp.Compile(*author); err != nil {
+			fmt.Printf("fatal: invalid --author pattern '%s': %s\n", *author, err)
+			os.Exit(128)
+		}
+	}
+
+	// Parse the date limits, --after / --before are aliases of --since / --until
+	now := time.Now()
+	var sinceTime, untilTime time.Time
+	for _, limit := range []struct {
+		value  string
+		result *time.Time
+	}{{*since, &sinceTime}, {*after, &sinceTime}, {*until, &untilTime}, {*before, &untilTime}} {
+		if limit.value == "" {
+			continue
+		}
+		t, err := utils.ParseDate(limit.value, now)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
+		*limit.result = t
+	}
+
+	// Paths relative to the root of the working tree
+	repoPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		rel, err := repo.RepoPath(p)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
+		repoPaths = append(repoPaths, rel)
+	}
+
+	// Starting points, HEAD by default
+	if len(revs) == 0 {
+		head, err := repo.ReadHEADInfo()
+		if err != nil {
+			fmt.Println("Error reading .git/HEAD:", err)
+			os.Exit(1)
+		}
+		if head.SHA == [20]byte{} {
+			fmt.Printf("fatal: your current branch '%s' does not have any commits yet\n", strings.TrimPrefix(head.Branch, "refs/heads/"))
+			os.Exit(128)
+		}
+		revs = []string{"HEAD"}
+	}
+	roots := make([][20]byte, 0, len(revs))
+	for _, rev := range revs {
+		sha, err := repo.ResolveCommitish(rev)
+		if err != nil {
+			fmt.Printf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.\n", rev)
+			os.Exit(128)
+		}
+		roots = append(roots, sha)
+	}
+
+	// Walk the history, most recent first
+	shown := 0
+	err := repo.WalkCommits(roots, func(sha [20]byte, commit *types.CommitNode) ([][20]byte, error) {
+		if maxCount >= 0 && shown >= maxCount {
+			return nil, plumbing.ErrStopWalk
+		}
+
+		parents := commit.ParentsSHA
+		if *firstParent && len(parents) > 1 {
+			parents = parents[:1]
+		}
+
+		// Path limiting : skip commits which don't touch the paths, following only the parent they match
+		if len(repoPaths) > 0 {
+			show, follow, err := commitTouchesPaths(repo, commit, parents, repoPaths)
+			if err != nil {
+				return nil, err
+			}
+			parents = follow
+			if !show {
+				return parents, nil
+			}
+		}
+
+		// Author and date filters
+		when := commit.Committer.When
+		if authorRegex != nil && !authorRegex.MatchString(fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email)) {
+			return parents, nil
+		}
+		if !sinceTime.IsZero() && when.Before(sinceTime) {
+			return parents, nil
+		}
+		if !untilTime.IsZero() && when.After(untilTime) {
+			return parents, nil
+		}
+
+		// Print the commit in the requested format
+		switch {
+		case *format != "":
+			fmt.Println(formatCommit(strings.TrimPrefix(strings.TrimPrefix(*format, "format:"), "tformat:"), sha, commit))
+		case *oneline:
+			shaHex := hex.EncodeToString(sha[:])
+			fmt.Printf("%s%s%s %s\n", constants.YellowColor, shaHex[:7], constants.ResetColor, commitSubject(commit.Message))
+		default:
+			if shown > 0 {
+				fmt.Println()
+			}
+			printCommitMedium(sha, commit)
+		}
+		shown++
+		return parents, nil
+	})
+	if err != nil {
+		fmt.Println("Error walking commits:", err)
+		os.Exit(1)
+	}
+}
+
+// commitTouchesPaths decides whether a commit is shown when limiting to paths, and which parents to walk next. Like git's default history simplification, a commit identical to one of its parents for those paths is hidden and only that parent is followed.
+func commitTouchesPaths(repo *plumbing.Repository, commit *types.CommitNode, parents [][20]byte, paths []string) (bool, [][20]byte, error) {
+
+	// Root commit : shown if it contains any of the paths
+	if len(parents) == 0 {
+		for _, path := range paths {
+			_, exists, err := repo.TreeEntryAtPath(commit.TreeSHA, path)
+			if err != nil || exists {
+				return exists, nil, err
+			}
+		}
+		return false, nil, nil
+	}
+
+	for _, parentSHA := range parents {
+		parent, err := repo.ReadCommit(parentSHA)
+		if err != nil {
+			return false, nil, err
+		}
+		same, err := treesSameForPaths(repo, parent.TreeSHA, commit.TreeSHA, paths)
+		if err != nil {
+			return false, nil, err
+		}
+		if same {
+			return false, [][20]byte{parentSHA}, nil
+		}
+	}
+	return true, parents, nil
+}
+
+// treesSameForPaths reports whether two trees have identical entries (content and mode) at every given path.
+func treesSameForPaths(repo *plumbing.Repository, treeA, treeB [20]byte, paths []string) (bool, error) {
+	for _, path := range paths {
+		a, existsA, err := repo.TreeEntryAtPath(treeA, path)
+		if err != nil {
+			return false, err
+		}
+		b, existsB, err := repo.TreeEntryAtPath(treeB, path)
+		if err != nil {
+			return false, err
+		}
+		if existsA != existsB || a.SHA != b.SHA || a.Mode != b.Mode {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// printCommitMedium prints a commit in git's default log format : hash, parents of merges, author, date and the indented message.
+func printCommitMedium(sha [20]byte, commit *types.CommitNode) {
+	fmt.Printf("%scommit %s%s\n", constants.YellowColor, hex.EncodeToString(sha[:]), constants.ResetColor)
+
+	// Abbreviated parents of merge commits
+	if len(commit.ParentsSHA) > 1 {
+		parents := make([]string, 0, len(commit.ParentsSHA))
+		for _, p := range commit.ParentsSHA {
+			parents = append(parents, hex.EncodeToString(p[:])[:7])
+		}
+		fmt.Printf("Merge: %s\n", strings.Join(parents, " "))
+	}
+
+	fmt.Printf("Author: %s <%s>\n", commit.Author.Name, commit.Author.Email)
+	fmt.Printf("Date:   %s\n\n", commit.Author.When.Format(constants.GitDateLayout))
+
+	// Message indented by 4 spaces
+	for _, line := range strings.Split(strings.TrimRight(commit.Message, "\n"), "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+}
+
+// formatCommit expands the placeholders of a --format string for one commit.
+func formatCommit(format string, sha [20]byte, commit *types.CommitNode) string {
+	shaHex := hex.EncodeToString(sha[:])
+	var sb strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			sb.WriteByte(format[i])
+			continue
+		}
+
+		// Two-letter placeholders first
+		rest := format[i+1:]
+		switch {
+		case strings.HasPrefix(rest, "an"):
+			sb.WriteString(commit.Author.Name)
+			i += 2
+		case strings.HasPrefix(rest, "ae"):
+			sb.WriteString(commit.Author.Email)
+			i += 2
+		case strings.HasPrefix(rest, "ad"):
+			sb.WriteString(commit.Author.When.Format(constants.GitDateLayout))
+			i += 2
+		case rest[0] == 'H':
+			sb.WriteString(shaHex)
+			i++
+		case rest[0] == 'h':
+			sb.WriteString(shaHex[:7])
+			i++
+		case rest[0] == 's':
+			sb.WriteString(commitSubject(commit.Message))
+			i++
+		case rest[0] == 'b':
+			sb.WriteString(commitBody(commit.Message))
+			i++
+		case rest[0] == 'n':
+			sb.WriteByte('\n')
+			i++
+		case rest[0] == '%':
+			sb.WriteByte('%')
+			i++
+		default:
+			// Unknown placeholder is printed as is
+			sb.WriteByte('%')
+		}
+	}
+	return sb.String()
+}
+
+// commitSubject returns the title of a commit message : its first paragraph, joined on a single line.
+func commitSubject(message string) string {
+	paragraph, _, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n\n")
+	return strings.Join(strings.Split(strings.TrimRight(paragraph, "\n"), "\n"), " ")
+}
+
+// commitBody returns everything after the title paragraph of a commit message, ending with a newline if not empty.
+func commitBody(message string) string {
+	_, body, found := strings.Cut(strings.TrimLeft(message, "\n"), "\n\n")
+	body = strings.Trim(body, "\n")
+	if !found || body == "" {
+		return ""
+	}
+	return body + "\n"
+}
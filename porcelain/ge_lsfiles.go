@@ -0,0 +1,164 @@
+package porcelain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// Invoked from main.go. ListFiles handles the 'gegit ls-files' command to show information about files in the index and the working tree.
+func ListFiles(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("ls-files",
+		"Shows the files in the index and/or the working tree, below the current directory or matching the given paths. Several options can be combined, files are then listed once per matching option.",
+		"gegit ls-files [-c | --cached] [-s | --stage] [-u | --unmerged] [-m | --modified] [-d | --deleted] [-o | --others] [--exclude-standard] [<path>...]")
+	cached, stage, unmerged, modified, deleted, others := false, false, false, false, false, false
+	fls.BoolVar(&cached, "c", false, "Show all files cached in Git's index, i.e. all tracked files. This is the default when no other option is given.")
+	fls.BoolVar(&cached, "cached", false, "Same as -c.")
+	fls.BoolVar(&stage, "s", false, "Show staged contents' mode bits, object name and stage number in the output.")
+	fls.BoolVar(&stage, "stage", false, "Same as -s.")
+	fls.BoolVar(&unmerged, "u", false, "Show information about unmerged files in the output, but do not show any other tracked files (forces --stage).")
+	fls.BoolVar(&unmerged, "unmerged", false, "Same as -u.")
+	fls.BoolVar(&modified, "m", false, "Show files with an unstaged modification (including deleted files).")
+	fls.BoolVar(&modified, "modified", false, "Same as -m.")
+	fls.BoolVar(&deleted, "d", false, "Show files with an unstaged deletion.")
+	fls.BoolVar(&deleted, "deleted", false, "Same as -d.")
+	fls.BoolVar(&others, "o", false, "Show other (i.e. untracked) files in the output.")
+	fls.BoolVar(&others, "others", false, "Same as -o.")
+	excludeStandard := fls.Bool("exclude-standard", false, "Add the standard Git exclusions (.gitignore, .git/info/exclude) when listing other files.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	// --unmerged implies --stage, and the index is listed when nothing else is asked for
+	if unmerged {
+		stage = true
+	}
+	if !stage && !modified && !deleted && !others {
+		cached = true
+	}
+
+	// Paths relative to the root of the working tree, the current directory by default
+	if len(pos) == 0 {
+		pos = []string{"."}
+	}
+	pathspecs := make([]string, 0, len(pos))
+	for _, arg := range pos {
+		rel, err := repo.RepoPath(arg)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
+		pathspecs = append(pathspecs, rel)
+	}
+	matches := func(path string) bool {
+		for _, spec := range pathspecs {
+			if spec == "" || path == spec || strings.HasPrefix(path, spec+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	entries, err := repo.LoadIndex()
+	if err != nil {
+		fmt.Println("Error loading index:", err)
+		os.Exit(1)
+	}
+	indexMap := plumbing.IndexToMap(entries)
+
+	// Paths are shown relative to the current directory
+	cwd, _ := os.Getwd()
+	display := func(path string) string {
+		if rel, err := filepath.Rel(cwd, repo.WorkPath(path)); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return path
+	}
+
+	// Untracked files come first
+	if others {
+		var matcher *plumbing.IgnoreMatcher
+		if *excludeStandard {
+			if matcher, err = repo.NewIgnoreMatcher(); err != nil {
+				fmt.Println("Error loading ignore rules:", err)
+				os.Exit(1)
+			}
+		}
+		files, err := repo.WorkTreeFiles("", matcher)
+		if err != nil {
+			fmt.Println("Error walking working tree:", err)
+			os.Exit(1)
+		}
+		for _, path := range files {
+			if _, tracked := indexMap[path]; !tracked && matches(path) {
+				fmt.Println(display(path))
+			}
+		}
+	}
+
+	if !cached && !stage && !modified && !deleted {
+		return
+	}
+
+	// Then every index entry, once per option it matches
+	fileModeTrusted := repo.FileModeTrusted()
+	show := func(ie types.IndexEntry) {
+		if stage {
+			fmt.Printf("%06o %s %d\t%s\n", ie.Mode, hex.EncodeToString(ie.SHA1[:]), ie.Stage(), display(ie.Filename))
+		} else {
+			fmt.Println(display(ie.Filename))
+		}
+	}
+	for _, ie := range entries {
+		if !matches(ie.Filename) {
+			continue
+		}
+		if (cached || stage) && (!unmerged || ie.Stage() != 0) {
+			show(ie)
+		}
+		if !deleted && !modified {
+			continue
+		}
+		_, statErr := os.Lstat(repo.WorkPath(ie.Filename))
+		if statErr != nil && deleted {
+			show(ie)
+		}
+		if modified && (statErr != nil || workTreeModified(repo, ie, fileModeTrusted)) {
+			show(ie)
+		}
+	}
+}
+
+// workTreeModified reports whether the working tree file of an index entry differs from it, in content or mode. Unmerged entries always do.
+func workTreeModified(repo *plumbing.Repository, ie types.IndexEntry, fileModeTrusted bool) bool {
+	if ie.Stage() != 0 {
+		return true
+	}
+	info, err := os.Lstat(repo.WorkPath(ie.Filename))
+	if err != nil {
+		return true
+	}
+	if plumbing.ResolveFileMode(plumbing.WorkTreeMode(info), ie.Mode, fileModeTrusted) != ie.Mode {
+		return true
+	}
+	if plumbing.IndexEntryMatchesStat(ie, info) {
+		return false
+	}
+	content, _, err := repo.ReadWorkTreeFile(ie.Filename)
+	if err != nil {
+		return true
+	}
+	sha, err := plumbing.HashObject(types.BlobObject, content)
+	return err != nil || sha != ie.SHA1
+}
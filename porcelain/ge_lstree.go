@@ -12,7 +12,7 @@ import (
 )
 
 // Invoked from main.go. LSTree handles the 'gegit ls-tree' command to list the contents of a tree object. It only calls this function if first argument is "ls-tree".
-func LSTree(args []string) {
+func LSTree(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("ls-tree",
@@ -35,14 +35,14 @@ func LSTree(args []string) {
 	}
 
 	// Resolve Treeish object
-	treeSHA, err := plumbing.ResolveTreeish(pos[0])
+	treeSHA, err := repo.ResolveTreeish(pos[0])
 	if err != nil {
 		fmt.Printf("Error resolving tree object %s:%s\n", pos[0], err)
 		os.Exit(1)
 	}
 
 	// Get All Entries (recursive) for this treeSHA.
-	treeEntries, err := plumbing.FlattenTree(treeSHA)
+	treeEntries, err := repo.FlattenTree(treeSHA)
 	if err != nil {
 		fmt.Printf("Error flattening tree object %s: %s\n", pos[0], err)
 		os.Exit(1)
@@ -0,0 +1,476 @@
+package porcelain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// Invoked from main.go. MergeBranch handles the 'gegit merge' command to join the history of another commit into the current branch.
+func MergeBranch(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("merge",
+		"Incorporates changes from the named commit (since the time its history diverged from the current branch) into the current branch. The branch is fast-forwarded when it is an ancestor of the commit, otherwise the changes of both sides are merged and recorded in a new commit with two parents. Conflicts are left in the working tree and the index, to be resolved before running 'gegit merge --continue'.",
+		"gegit merge [--no-ff | --ff-only] [-m <message>] <commit> | --continue | --abort")
+	message := fls.String("m", "", "The commit message to be used for the merge commit (in case one is created).")
+	noFF := fls.Bool("no-ff", false, "Create a merge commit even when the merge resolves as a fast-forward.")
+	ffOnly := fls.Bool("ff-only", false, "Refuse to merge unless the current HEAD is already up to date or the merge can be resolved as a fast-forward.")
+	cont := fls.Bool("continue", false, "Conclude a merge stopped on conflicts, once they are resolved and added to the index.")
+	abort := fls.Bool("abort", false, "Abort the current conflict resolution process, and restore the pre-merge state of the index and the working tree.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	switch {
+	case *cont && !*abort && len(pos) == 0:
+		continueMerge(repo)
+	case *abort && !*cont && len(pos) == 0:
+		abortMerge(repo)
+	case !*cont && !*abort && !(*noFF && *ffOnly) && len(pos) == 1:
+		mergeCommit(repo, pos[0], *message, *noFF, *ffOnly)
+	default:
+		fmt.Println("usage: gegit merge [--no-ff | --ff-only] [-m <message>] <commit> | --continue | --abort")
+		os.Exit(1)
+	}
+}
+
+// mergeCommit merges the commit named by rev into HEAD.
+func mergeCommit(repo *plumbing.Repository, rev, message string, noFF, ffOnly bool) {
+
+	// A merge stopped on conflicts must be concluded first
+	if _, err := os.Stat(repo.GitPath("MERGE_HEAD")); err == nil {
+		entries, err := repo.LoadIndex()
+		if err == nil && slices.ContainsFunc(entries, func(ie types.IndexEntry) bool { return ie.Stage() != 0 }) {
+			fmt.Println("error: Merging is not possible because you have unmerged files.")
+			fmt.Println("hint: Fix them up in the work tree, and then use 'gegit add/rm <file>'")
+			fmt.Println("hint: as appropriate to mark resolution and make a commit.")
+			fmt.Println("fatal: Exiting because of an unresolved conflict.")
+		} else {
+			fmt.Println("fatal: You have not concluded your merge (MERGE_HEAD exists).")
+			fmt.Println("Please, commit your changes before you merge.")
+		}
+		os.Exit(128)
+	}
+
+	// Both sides of the merge
+	head, err := repo.ReadHEADInfo()
+	if err != nil {
+		fmt.Println("Error reading .git/HEAD:", err)
+		os.Exit(1)
+	}
+	theirsSHA, err := repo.ResolveCommitish(rev)
+	if err != nil {
+		fmt.Printf("merge: %s - not something we can merge\n", rev)
+		os.Exit(1)
+	}
+	theirs, err := repo.ReadCommit(theirsSHA)
+	if err != nil {
+		fmt.Println("Error reading commit:", err)
+		os.Exit(1)
+	}
+
+	// An unborn branch simply starts at the merged commit
+	if head.SHA == [20]byte{} {
+		result := mergeTrees(repo, [20]byte{}, [20]byte{}, theirs.TreeSHA, rev)
+		checkLocalChanges(repo, map[string]types.TreeEntry{}, result)
+		applyMergeResult(repo, map[string]types.TreeEntry{}, result)
+		moveHEAD(repo, head, theirsSHA, fmt.Sprintf("merge %s: Fast-forward", rev))
+		return
+	}
+	ours, err := repo.ReadCommit(head.SHA)
+	if err != nil {
+		fmt.Println("Error reading HEAD commit:", err)
+		os.Exit(1)
+	}
+	oursFiles, err := repo.TreeFiles(ours.TreeSHA)
+	if err != nil {
+		fmt.Println("Error reading tree:", err)
+		os.Exit(1)
+	}
+
+	// Find the common ancestor
+	baseTree, bases, err := repo.MergeBaseTree(head.SHA, theirsSHA)
+	if err != nil {
+		fmt.Println("Error finding merge base:", err)
+		os.Exit(1)
+	}
+	switch {
+	case len(bases) == 0:
+		fmt.Println("fatal: refusing to merge unrelated histories")
+		os.Exit(128)
+	case slices.Contains(bases, theirsSHA):
+		fmt.Println("Already up to date.")
+		return
+	}
+	fastForward := slices.Contains(bases, head.SHA) && !noFF
+	if ffOnly && !fastForward {
+		fmt.Println("fatal: Not possible to fast-forward, aborting.")
+		os.Exit(128)
+	}
+
+	// Merge the trees, and make sure no local change is lost by updating the index and the working tree
+	result := mergeTrees(repo, baseTree, ours.TreeSHA, theirs.TreeSHA, rev)
+	checkLocalChanges(repo, oursFiles, result)
+	if err := repo.UpdatePseudoRef("ORIG_HEAD", head.SHA); err != nil {
+		fmt.Println("Error updating .git/ORIG_HEAD:", err)
+		os.Exit(1)
+	}
+	applyMergeResult(repo, oursFiles, result)
+
+	// Fast-forward : the branch moves to the merged commit
+	if fastForward {
+		fmt.Printf("Updating %s..%s\n", hex.EncodeToString(head.SHA[:])[:7], hex.EncodeToString(theirsSHA[:])[:7])
+		fmt.Println("Fast-forward")
+		moveHEAD(repo, head, theirsSHA, fmt.Sprintf("merge %s: Fast-forward", rev))
+		return
+	}
+
+	// Report what happened to each path
+	conflictsByPath := map[string]types.MergeConflict{}
+	for _, c := range result.Conflicts {
+		conflictsByPath[c.Path] = c
+	}
+	reported := slices.Clone(result.AutoMerged)
+	for path := range conflictsByPath {
+		if !slices.Contains(reported, path) {
+			reported = append(reported, path)
+		}
+	}
+	sort.Strings(reported)
+	for _, path := range reported {
+		c, conflicted := conflictsByPath[path]
+		if conflicted && c.Kind == "binary" {
+			fmt.Printf("warning: Cannot merge binary files: %s (HEAD vs. %s)\n", path, rev)
+		}
+		if slices.Contains(result.AutoMerged, path) {
+			fmt.Printf("Auto-merging %s\n", path)
+		}
+		switch {
+		case !conflicted:
+		case c.Kind == "modify/delete":
+			fmt.Printf("CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.\n", path, c.DeletedBy, c.KeptBy, c.KeptBy, path)
+		case c.Kind == "binary":
+			fmt.Printf("CONFLICT (content): Merge conflict in %s\n", path)
+		case c.Kind == "file/directory":
+			fmt.Printf("CONFLICT (file/directory): directory in the way of %s from %s; moving it to %s instead.\n", c.MovedFrom, c.KeptBy, path)
+		default:
+			fmt.Printf("CONFLICT (%s): Merge conflict in %s\n", c.Kind, path)
+		}
+	}
+
+	// Default commit message
+	if message == "" {
+		message = defaultMergeMessage(repo, rev, head)
+	}
+
+	// Conflicts : stop and let the user resolve them
+	if len(result.Conflicts) > 0 {
+		var sb strings.Builder
+		sb.WriteString(message + "\n\n# Conflicts:\n")
+		for _, c := range result.Conflicts {
+			sb.WriteString("#\t" + c.Path + "\n")
+		}
+		if err := repo.WriteMergeState([][20]byte{theirsSHA}, sb.String(), noFF); err != nil {
+			fmt.Println("Error writing merge state:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Automatic merge failed; fix conflicts and then commit the result.")
+		os.Exit(1)
+	}
+
+	// Clean merge : record it right away in a commit with both parents
+	if err := repo.WriteMergeState([][20]byte{theirsSHA}, message+"\n", noFF); err != nil {
+		fmt.Println("Error writing merge state:", err)
+		os.Exit(1)
+	}
+	commitIndex(repo, message, fmt.Sprintf("merge %s: Merge made by the 'recursive' strategy.", rev))
+	fmt.Println("Merge made by the 'recursive' strategy.")
+}
+
+// mergeTrees runs the three-way merge of the trees, labelling the sides HEAD and rev.
+func mergeTrees(repo *plumbing.Repository, baseTree, oursTree, theirsTree [20]byte, rev string) *types.MergeResult {
+	result, err := repo.MergeTrees(baseTree, oursTree, theirsTree, "HEAD", rev)
+	if err != nil {
+		fmt.Println("Error merging trees:", err)
+		os.Exit(1)
+	}
+	return result
+}
+
+// defaultMergeMessage returns git's default merge commit message : "Merge branch 'x'" (or "Merge commit 'x'"), followed by " into <branch>" unless merging into master or main.
+func defaultMergeMessage(repo *plumbing.Repository, rev string, head *types.HeadInfo) string {
+	message := fmt.Sprintf("Merge commit '%s'", rev)
+	if _, isBranch := repo.ReadBranchRef(rev); isBranch {
+		message = fmt.Sprintf("Merge branch '%s'", rev)
+	}
+	if !head.Detached && head.Branch != "master" && head.Branch != "main" {
+		message += " into " + head.Branch
+	}
+	return message
+}
+
+// moveHEAD points HEAD, or the branch it is on, at a commit, recording the move with message in the reflogs. Fails if HEAD moved since it was read.
+func moveHEAD(repo *plumbing.Repository, head *types.HeadInfo, sha [20]byte, message string) {
+	var err error
+	if head.Detached {
+		err = repo.UpdateHEADDetached(sha, head.SHA, message)
+	} else {
+		err = repo.UpdateBranchRefWithSHA(head.Branch, sha, head.SHA, message)
+	}
+	if err != nil {
+		fmt.Println("Error updating .git/HEAD:", err)
+		os.Exit(1)
+	}
+}
+
+// checkLocalChanges aborts the merge when it would lose local changes : staged changes (they would end up in the merge commit), modified files the merge writes, and untracked files it would overwrite.
+func checkLocalChanges(repo *plumbing.Repository, oursFiles map[string]types.TreeEntry, result *types.MergeResult) {
+	entries, err := repo.LoadIndex()
+	if err != nil {
+		fmt.Println("Error loading index:", err)
+		os.Exit(1)
+	}
+	indexMap := plumbing.IndexToMap(entries)
+	fileModeTrusted := repo.FileModeTrusted()
+
+	// Staged changes, anywhere
+	dirty := map[string]bool{}
+	for path, ie := range indexMap {
+		te, inHead := oursFiles[path]
+		if !inHead || ie.Stage() != 0 || ie.SHA1 != te.SHA || ie.Mode != te.Mode {
+			dirty[path] = true
+		}
+	}
+	for path := range oursFiles {
+		if _, inIndex := indexMap[path]; !inIndex {
+			dirty[path] = true
+		}
+	}
+
+	// Working tree changes, to the paths the merge writes or removes. Submodules are never written, their working tree is another repository.
+	untracked := []string{}
+	for path, te := range oursFiles {
+		if merged, ok := result.Files[path]; te.Mode == constants.ModeGitlink || (ok && merged.SHA == te.SHA && merged.Mode == te.Mode) {
+			continue
+		}
+		content, info, err := repo.ReadWorkTreeFile(path)
+		if err != nil {
+			// Deleted locally
+			dirty[path] = true
+			continue
+		}
+		sha, err := plumbing.HashObject(types.BlobObject, content)
+		if err != nil || sha != te.SHA || plumbing.ResolveFileMode(plumbing.WorkTreeMode(info), te.Mode, fileModeTrusted) != te.Mode {
+			dirty[path] = true
+		}
+	}
+	for path, te := range result.Files {
+		if _, inHead := oursFiles[path]; inHead || te.Mode == constants.ModeGitlink {
+			continue
+		}
+		if _, err := os.Lstat(repo.WorkPath(path)); err == nil && !dirty[path] {
+			untracked = append(untracked, path)
+		}
+	}
+
+	if len(dirty) > 0 {
+		paths := make([]string, 0, len(dirty))
+		for path := range dirty {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		fmt.Println("error: Your local changes to the following files would be overwritten by merge:")
+		for _, path := range paths {
+			fmt.Printf("\t%s\n", path)
+		}
+		fmt.Println("Please commit your changes or stash them before you merge.")
+		fmt.Println("Aborting")
+		os.Exit(1)
+	}
+	if len(untracked) > 0 {
+		sort.Strings(untracked)
+		fmt.Println("error: The following untracked working tree files would be overwritten by merge:")
+		for _, path := range untracked {
+			fmt.Printf("\t%s\n", path)
+		}
+		fmt.Println("Please move or remove them before you merge.")
+		fmt.Println("Aborting")
+		os.Exit(1)
+	}
+}
+
+// applyMergeResult updates the working tree and the index from the files of HEAD to the result of a merge.
+func applyMergeResult(repo *plumbing.Repository, oursFiles map[string]types.TreeEntry, result *types.MergeResult) {
+
+	// Hold index.lock from reading the index until it is written back
+	lock, err := repo.LockIndex()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+	entries, err := repo.LoadIndex()
+	if err != nil {
+		lock.Rollback()
+		fmt.Println("Error loading index:", err)
+		os.Exit(1)
+	}
+	indexMap := plumbing.IndexToMap(entries)
+
+	// Remove the files which are gone, write the ones which changed, leaving submodules alone
+	for path, te := range oursFiles {
+		if _, ok := result.Files[path]; !ok && te.Mode != constants.ModeGitlink {
+			if err := os.Remove(repo.WorkPath(path)); err != nil && !os.IsNotExist(err) {
+				lock.Rollback()
+				fmt.Printf("Error deleting %s from WorkTree: %s\n", path, err)
+				os.Exit(1)
+			}
+		}
+	}
+	written := map[string]bool{}
+	for path, te := range result.Files {
+		if old, ok := oursFiles[path]; te.Mode != constants.ModeGitlink && (!ok || old.SHA != te.SHA || old.Mode != te.Mode) {
+			if err := writeBlobToWorkTree(repo, path, te.Mode, te.SHA); err != nil {
+				lock.Rollback()
+				fmt.Println("Error", err)
+				os.Exit(1)
+			}
+			written[path] = true
+		}
+	}
+
+	// Merged entries keep (or get fresh) stat data, so that they are not rehashed
+	mergedEntries := make([]types.IndexEntry, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		if e.Stage() == 0 {
+			if old, ok := indexMap[e.Filename]; ok && !written[e.Filename] && old.SHA1 == e.SHA1 && old.Mode == e.Mode {
+				e = old
+			} else if fresh, err := repo.GetIndexEntryFromStat(e.Filename, e.SHA1); err == nil && e.Mode != constants.ModeGitlink {
+				fresh.Mode = e.Mode
+				e = fresh
+			}
+		}
+		mergedEntries = append(mergedEntries, e)
+	}
+	if err := repo.WriteIndex(lock, mergedEntries); err != nil {
+		fmt.Printf("couldn't update .git/index: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// continueMerge concludes a merge stopped on conflicts, once they are resolved.
+func continueMerge(repo *plumbing.Repository) {
+	if _, err := os.Stat(repo.GitPath("MERGE_HEAD")); err != nil {
+		fmt.Println("fatal: There is no merge in progress (MERGE_HEAD missing).")
+		os.Exit(128)
+	}
+	message, err := repo.ReadMergeMessage()
+	if err != nil {
+		fmt.Println("Error reading .git/MERGE_MSG:", err)
+		os.Exit(1)
+	}
+	commitIndex(repo, message, "")
+}
+
+// abortMerge gives up a merge stopped on conflicts : the paths it touched are restored from HEAD in the index and the working tree, other local changes are kept.
+func abortMerge(repo *plumbing.Repository) {
+	if _, err := os.Stat(repo.GitPath("MERGE_HEAD")); err != nil {
+		fmt.Println("fatal: There is no merge to abort (MERGE_HEAD missing).")
+		os.Exit(128)
+	}
+
+	// Files of HEAD
+	headTree, _, err := repo.ReadHEADTreeSHA()
+	if err != nil {
+		fmt.Println("Error reading HEAD tree:", err)
+		os.Exit(1)
+	}
+	headFiles, err := repo.TreeFiles(headTree)
+	if err != nil {
+		fmt.Println("Error reading tree:", err)
+		os.Exit(1)
+	}
+
+	// Hold index.lock from reading the index until it is written back
+	lock, err := repo.LockIndex()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+	entries, err := repo.LoadIndex()
+	if err != nil {
+		lock.Rollback()
+		fmt.Println("Error loading index:", err)
+		os.Exit(1)
+	}
+
+	// Paths whose index entry differs from HEAD are restored
+	restore := map[string]bool{}
+	unchanged := map[string]types.IndexEntry{}
+	for _, ie := range entries {
+		te, inHead := headFiles[ie.Filename]
+		if ie.Stage() == 0 && inHead && ie.SHA1 == te.SHA && ie.Mode == te.Mode {
+			unchanged[ie.Filename] = ie
+		} else if ie.Mode != constants.ModeGitlink {
+			restore[ie.Filename] = true
+		}
+	}
+	for path := range headFiles {
+		if _, ok := unchanged[path]; !ok {
+			restore[path] = true
+		}
+	}
+
+	// Removals first, so that a file can take the place of a directory left empty
+	for path := range restore {
+		if _, inHead := headFiles[path]; !inHead {
+			if err := os.Remove(repo.WorkPath(path)); err != nil && !os.IsNotExist(err) {
+				lock.Rollback()
+				fmt.Printf("Error deleting %s from WorkTree: %s\n", path, err)
+				os.Exit(1)
+			}
+		}
+	}
+	for path := range restore {
+		if te, inHead := headFiles[path]; inHead && te.Mode != constants.ModeGitlink {
+			if err := writeBlobToWorkTree(repo, path, te.Mode, te.SHA); err != nil {
+				lock.Rollback()
+				fmt.Println("Error", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Index back to HEAD
+	headEntries := make([]types.IndexEntry, 0, len(headFiles))
+	for path, te := range headFiles {
+		ie, ok := unchanged[path]
+		if !ok {
+			if ie, err = repo.GetIndexEntryFromStat(path, te.SHA); err != nil {
+				ie = types.IndexEntry{Filename: path}
+			}
+			ie.SHA1, ie.Mode = te.SHA, te.Mode
+		}
+		headEntries = append(headEntries, ie)
+	}
+	if err := repo.WriteIndex(lock, headEntries); err != nil {
+		fmt.Printf("couldn't update .git/index: %s\n", err)
+		os.Exit(1)
+	}
+
+	if err := repo.ClearMergeState(); err != nil {
+		fmt.Println("Error removing merge state:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,146 @@
+package porcelain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+)
+
+// Invoked from main.go. MergeBaseOps handles the 'gegit merge-base' command to find the best common ancestors of commits.
+func MergeBaseOps(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("merge-base",
+		"Finds the best common ancestor(s) between two commits to use in a three-way merge. One common ancestor is better than another common ancestor if the latter is an ancestor of the former.",
+		"gegit merge-base [-a | --all] <commit> <commit>... | [-a | --all] --octopus <commit>... | --is-ancestor <commit> <commit> | --fork-point <ref> [<commit>]")
+	all := false
+	fls.BoolVar(&all, "a", false, "Output all merge bases for the commits, instead of just one.")
+	fls.BoolVar(&all, "all", false, "Same as -a.")
+	octopus := fls.Bool("octopus", false, "Compute the best common ancestors of all supplied commits, in preparation for an n-way merge.")
+	isAncestor := fls.Bool("is-ancestor", false, "Check if the first <commit> is an ancestor of the second <commit>, and exit with status 0 if true, or with status 1 if not.")
+	forkPoint := fls.Bool("fork-point", false, "Find the point at which a branch (or any history that leads to <commit>) forked from another branch (or any reference) <ref>, using the reflog of <ref>.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	modes := 0
+	for _, mode := range []bool{*octopus, *isAncestor, *forkPoint} {
+		if mode {
+			modes++
+		}
+	}
+
+	switch {
+	case modes > 1:
+		fmt.Println("usage: gegit merge-base [-a | --all] <commit> <commit>... | [-a | --all] --octopus <commit>... | --is-ancestor <commit> <commit> | --fork-point <ref> [<commit>]")
+		os.Exit(1)
+
+	case *isAncestor:
+		// gegit merge-base --is-ancestor <commit> <commit> : the answer is the exit status
+		if len(pos) != 2 || all {
+			fmt.Println("usage: gegit merge-base --is-ancestor <commit> <commit>")
+			os.Exit(1)
+		}
+		commits := resolveMergeBaseCommits(repo, pos)
+		ok, err := repo.IsAncestor(commits[0], commits[1])
+		if err != nil {
+			fmt.Println("Error walking commits:", err)
+			os.Exit(1)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+
+	case *forkPoint:
+		// gegit merge-base --fork-point <ref> [<commit>]
+		if len(pos) < 1 || len(pos) > 2 || all {
+			fmt.Println("usage: gegit merge-base --fork-point <ref> [<commit>]")
+			os.Exit(1)
+		}
+		refName, ok := fullRefName(repo, pos[0])
+		if !ok {
+			fmt.Printf("fatal: Not a valid object name: '%s'\n", pos[0])
+			os.Exit(128)
+		}
+		commitIsh := "HEAD"
+		if len(pos) == 2 {
+			commitIsh = pos[1]
+		}
+		commit := resolveMergeBaseCommits(repo, []string{commitIsh})[0]
+		sha, found, err := repo.ForkPoint(refName, commit)
+		if err != nil {
+			fmt.Println("Error finding fork point:", err)
+			os.Exit(1)
+		}
+		if !found {
+			os.Exit(1)
+		}
+		fmt.Println(hex.EncodeToString(sha[:]))
+
+	default:
+		// gegit merge-base [--all] [--octopus] <commit>...
+		if len(pos) < 1 || (len(pos) < 2 && !*octopus) {
+			fmt.Println("usage: gegit merge-base [-a | --all] <commit> <commit>... | [-a | --all] --octopus <commit>...")
+			os.Exit(1)
+		}
+		commits := resolveMergeBaseCommits(repo, pos)
+
+		var bases [][20]byte
+		var err error
+		if *octopus {
+			bases, err = repo.OctopusMergeBases(commits)
+		} else {
+			bases, err = repo.MergeBases(commits[0], commits[1:]...)
+		}
+		if err != nil {
+			fmt.Println("Error finding merge base:", err)
+			os.Exit(1)
+		}
+
+		// No common ancestor
+		if len(bases) == 0 {
+			os.Exit(1)
+		}
+		if !all {
+			bases = bases[:1]
+		}
+		for _, sha := range bases {
+			fmt.Println(hex.EncodeToString(sha[:]))
+		}
+	}
+}
+
+// resolveMergeBaseCommits resolves every commit-ish, exiting on the first invalid one.
+func resolveMergeBaseCommits(repo *plumbing.Repository, commitIshes []string) [][20]byte {
+	commits := make([][20]byte, 0, len(commitIshes))
+	for _, commitIsh := range commitIshes {
+		sha, err := repo.ResolveCommitish(commitIsh)
+		if err != nil {
+			fmt.Printf("fatal: Not a valid object name %s\n", commitIsh)
+			os.Exit(128)
+		}
+		commits = append(commits, sha)
+	}
+	return commits
+}
+
+// fullRefName expands a short ref name (master) to the full name of an existing ref (refs/heads/master), trying the same places as git.
+func fullRefName(repo *plumbing.Repository, name string) (string, bool) {
+	candidates := []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name, "refs/remotes/" + name}
+	if strings.HasPrefix(name, "refs/") {
+		candidates = candidates[:1]
+	}
+	for _, candidate := range candidates {
+		if _, ok := repo.ReadRef(candidate); ok {
+			return candidate, true
+		}
+	}
+	return "", false
+}
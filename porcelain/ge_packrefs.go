@@ -0,0 +1,36 @@
+package porcelain
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+)
+
+// Invoked from main.go. PackRefs handles the 'gegit pack-refs' command to store refs in the single .git/packed-refs file instead of one file each.
+func PackRefs(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("pack-refs",
+		"Packs refs into .git/packed-refs, so that they don't each need a file under .git/refs. By default tags and refs already packed are packed, with --all every ref is. The loose files are removed once packed.",
+		"gegit pack-refs [--all] [--no-prune]")
+	all := fls.Bool("all", false, "Pack all refs, branches included, not only tags and refs already packed.")
+	noPrune := fls.Bool("no-prune", false, "Do not remove the loose refs after packing them.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	if len(pos) != 0 {
+		fmt.Println("usage: gegit pack-refs [--all] [--no-prune]")
+		os.Exit(1)
+	}
+
+	if err := repo.PackRefs(*all, !*noPrune); err != nil {
+		fmt.Println("Error packing refs:", err)
+		os.Exit(1)
+	}
+}
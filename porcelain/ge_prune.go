@@ -0,0 +1,118 @@
+package porcelain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+)
+
+// Invoked from main.go. PruneObjects handles the 'gegit prune' command to remove unreachable loose objects older than a grace period.
+func PruneObjects(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("prune",
+		"Removes the loose objects which are unreachable from any ref, HEAD, reflog or the index, once they are older than the grace period (gc.pruneExpire, 2 weeks ago by default). Packed objects are not touched.",
+		"gegit prune [-n | --dry-run] [-v | --verbose] [--expire <time>]")
+	var dryRun, verbose bool
+	fls.BoolVar(&dryRun, "n", false, "Do not remove anything, just report what would be removed.")
+	fls.BoolVar(&dryRun, "dry-run", false, "Do not remove anything, just report what would be removed.")
+	fls.BoolVar(&verbose, "v", false, "Report all removed objects.")
+	fls.BoolVar(&verbose, "verbose", false, "Report all removed objects.")
+	expire := fls.String("expire", "", "Only expire loose objects older than <time> (e.g. \"now\", \"2.weeks.ago\", \"never\").")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	if len(pos) != 0 {
+		fmt.Println("usage: gegit prune [-n | --dry-run] [-v | --verbose] [--expire <time>]")
+		os.Exit(1)
+	}
+
+	if err := prune(repo, *expire, dryRun, verbose || dryRun); err != nil {
+		fmt.Println("Error pruning objects:", err)
+		os.Exit(1)
+	}
+}
+
+// prune removes the unreachable loose objects last modified before expire ("" for gc.pruneExpire), unless a more recent unreachable object points to them, printing "<sha> <type>" for each when verbose.
+func prune(repo *plumbing.Repository, expire string, dryRun, verbose bool) error {
+
+	// Pruning is only possible for the on-disk object layout
+	objectStore, ok := repo.Objects.(*plumbing.LooseObjectStore)
+	if !ok {
+		return fmt.Errorf("object store does not support pruning")
+	}
+
+	expireTime, err := expiryTime(repo, expire, "gc.pruneExpire", plumbing.DefaultPruneExpire)
+	if err != nil {
+		return err
+	}
+
+	// Everything reachable is kept, whatever its age
+	roots, err := reachabilityRoots(repo)
+	if err != nil {
+		return err
+	}
+	objects, err := repo.ReachableObjects(roots)
+	if err != nil {
+		return err
+	}
+	keep := map[[20]byte]bool{}
+	for _, obj := range objects {
+		keep[obj.SHA] = true
+	}
+
+	// Like git, recent unreachable objects are roots too : whatever they point to is kept, however old, so they stay whole
+	recent, err := objectStore.RecentLooseObjects(keep, expireTime)
+	if err != nil {
+		return err
+	}
+	recentObjects, err := repo.ReachableObjectsSkipMissing(recent)
+	if err != nil {
+		return err
+	}
+	for _, obj := range recentObjects {
+		keep[obj.SHA] = true
+	}
+
+	pruned, err := objectStore.PruneLooseObjects(keep, expireTime, dryRun)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		for _, obj := range pruned {
+			objType := string(obj.Type)
+			if objType == "" {
+				objType = "unknown"
+			}
+			fmt.Printf("%s %s\n", hex.EncodeToString(obj.SHA[:]), objType)
+		}
+	}
+	return nil
+}
+
+// expiryTime resolves an expiry date : the given value, else the configured one (key), else fallback. "never" expires nothing.
+func expiryTime(repo *plumbing.Repository, value, key, fallback string) (time.Time, error) {
+	if value == "" {
+		value = fallback
+		if val, err := repo.GetConfig(key); err == nil && val != "" {
+			value = val
+		}
+	}
+	if value == "never" {
+		return time.Time{}, nil
+	}
+
+	expireTime, err := utils.ParseDate(value, time.Now())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry date '%s'", value)
+	}
+	return expireTime, nil
+}
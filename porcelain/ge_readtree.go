@@ -6,11 +6,12 @@ import (
 
 	"github.com/brickster241/GitEngine/plumbing"
 	"github.com/brickster241/GitEngine/utils"
+	"github.com/brickster241/GitEngine/utils/constants"
 	"github.com/brickster241/GitEngine/utils/types"
 )
 
 // Invoked from main.go. ReadTreeToIndex handles the 'gegit read-tree' command to read a treeish object and write it to the current index.
-func ReadTreeToIndex(args []string) {
+func ReadTreeToIndex(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("read-tree",
@@ -30,14 +31,14 @@ func ReadTreeToIndex(args []string) {
 	}
 
 	// Get the resolved treeSHA
-	treeSHA, err := plumbing.ResolveTreeish(pos[0])
+	treeSHA, err := repo.ResolveTreeish(pos[0])
 	if err != nil {
 		fmt.Printf("Error resolving tree-ish object %s: %s\n", pos[0], err)
 		os.Exit(1)
 	}
 
 	// Get Tree Entries and convert them to []IndexEntry
-	treeEntries, err := plumbing.FlattenTree(treeSHA)
+	treeEntries, err := repo.FlattenTree(treeSHA)
 	if err != nil {
 		fmt.Println("Error fetching Tree contents:", err)
 		os.Exit(1)
@@ -46,7 +47,7 @@ func ReadTreeToIndex(args []string) {
 
 	// Iterate through the entries and convert them to []IndexEntry, with default values for everything else. Only blobs will be used.
 	for _, te := range treeEntries {
-		if te.Type == types.BlobObject {
+		if te.Type == types.BlobObject || te.Mode == constants.ModeGitlink {
 			treeIndexEntries = append(treeIndexEntries, types.IndexEntry{
 				Filename: te.Name,
 				SHA1:     te.SHA,
@@ -56,7 +57,12 @@ func ReadTreeToIndex(args []string) {
 	}
 
 	// Write the Index based on these new []IndexEntry slice. Will automatically sort based on Filename.
-	if err := plumbing.WriteIndex(treeIndexEntries); err != nil {
+	lock, err := repo.LockIndex()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+	if err := repo.WriteIndex(lock, treeIndexEntries); err != nil {
 		fmt.Println("Error updating Index:", err)
 		os.Exit(1)
 	}
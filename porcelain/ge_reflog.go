@@ -0,0 +1,215 @@
+package porcelain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+	"github.com/brickster241/GitEngine/utils/constants"
+)
+
+// Invoked from main.go. ReflogOps handles the 'gegit reflog' command to show, expire or delete the entries of reflogs, the history of where HEAD and branches pointed.
+func ReflogOps(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("reflog",
+		"Manage reflog information. Reflogs record when the tips of branches and HEAD were updated. \"show\" (the default) lists the entries of a reflog, newest first, \"expire\" prunes old entries and \"delete\" removes single entries.",
+		"gegit reflog [show [<ref>] | expire [--expire=<time>] [--expire-unreachable=<time>] [-n | --dry-run] (--all | <ref>...) | delete [-n | --dry-run] <ref>@{<n>}...]")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	subcommand := "show"
+	if len(pos) > 0 && (pos[0] == "show" || pos[0] == "expire" || pos[0] == "delete") {
+		subcommand, pos = pos[0], pos[1:]
+	}
+
+	switch subcommand {
+	case "show":
+		if len(pos) > 1 {
+			fmt.Println("usage: gegit reflog show [<ref>]")
+			os.Exit(1)
+		}
+		ref := "HEAD"
+		if len(pos) == 1 {
+			ref = pos[0]
+		}
+		showReflog(repo, ref)
+	case "expire":
+		expireReflogs(repo, pos)
+	case "delete":
+		deleteReflogEntries(repo, pos)
+	}
+}
+
+// showReflog prints the entries of the reflog of ref, newest first : "<short sha> <ref>@{<n>}: <message>".
+func showReflog(repo *plumbing.Repository, ref string) {
+	refName, err := repo.ReflogRefName(ref)
+	if err != nil {
+		fmt.Println("Error reading .git/HEAD:", err)
+		os.Exit(1)
+	}
+	entries, err := repo.ReadReflog(refName)
+	if err != nil {
+		fmt.Println("Error reading reflog:", err)
+		os.Exit(1)
+	}
+
+	name := strings.TrimPrefix(refName, "refs/heads/")
+	for i := len(entries) - 1; i >= 0; i-- {
+		shaHex := hex.EncodeToString(entries[i].New[:])
+		fmt.Printf("%s%s%s %s@{%d}: %s\n", constants.YellowColor, shaHex[:7], constants.ResetColor, name, len(entries)-1-i, entries[i].Message)
+	}
+}
+
+// expireReflogs handles 'gegit reflog expire' : entries older than --expire (gc.reflogExpire, 90 days) are dropped, and so are those older than --expire-unreachable (gc.reflogExpireUnreachable, 30 days) which the tip of the ref can't reach.
+func expireReflogs(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("reflog expire",
+		"Prunes older reflog entries.",
+		"gegit reflog expire [--expire=<time>] [--expire-unreachable=<time>] [-n | --dry-run] (--all | <ref>...)")
+	expire := fls.String("expire", "", "Prune entries older than the specified time.")
+	expireUnreachable := fls.String("expire-unreachable", "", "Prune entries older than the specified time that are not reachable from the current tip of the ref.")
+	all := fls.Bool("all", false, "Process the reflogs of all references.")
+	var dryRun bool
+	fls.BoolVar(&dryRun, "n", false, "Do not actually prune any entries, just show what would have been pruned.")
+	fls.BoolVar(&dryRun, "dry-run", false, "Do not actually prune any entries, just show what would have been pruned.")
+
+	// Parse flags from args
+	fls.Parse(args)
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	if *all == (len(pos) != 0) {
+		fmt.Println("usage: gegit reflog expire [--expire=<time>] [--expire-unreachable=<time>] [-n | --dry-run] (--all | <ref>...)")
+		os.Exit(1)
+	}
+
+	expireTime, err := expiryTime(repo, *expire, "gc.reflogExpire", plumbing.DefaultReflogExpire)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+	expireUnreachableTime, err := expiryTime(repo, *expireUnreachable, "gc.reflogExpireUnreachable", plumbing.DefaultReflogExpireUnreachable)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+
+	// Reflogs to process, by full ref name
+	refNames := []string{}
+	if *all {
+		if refNames, err = repo.ReflogNames(); err != nil {
+			fmt.Println("Error listing reflogs:", err)
+			os.Exit(1)
+		}
+	}
+	for _, ref := range pos {
+		refName, err := repo.ReflogRefName(ref)
+		if err != nil {
+			fmt.Println("Error reading .git/HEAD:", err)
+			os.Exit(1)
+		}
+		refNames = append(refNames, refName)
+	}
+
+	for _, refName := range refNames {
+		dropped, err := repo.ExpireReflog(refName, expireTime, expireUnreachableTime, dryRun)
+		if err != nil {
+			fmt.Printf("Error expiring the reflog of %s: %s\n", refName, err)
+			os.Exit(1)
+		}
+		if dryRun && dropped > 0 {
+			fmt.Printf("Would prune %d entries of %s\n", dropped, refName)
+		}
+	}
+}
+
+// deleteReflogEntries handles 'gegit reflog delete <ref>@{<n>}...' : the given entries are removed from their reflogs.
+func deleteReflogEntries(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("reflog delete",
+		"Deletes single entries from the reflog.",
+		"gegit reflog delete [-n | --dry-run] <ref>@{<n>}...")
+	var dryRun bool
+	fls.BoolVar(&dryRun, "n", false, "Do not actually delete any entries, just show what would have been deleted.")
+	fls.BoolVar(&dryRun, "dry-run", false, "Do not actually delete any entries, just show what would have been deleted.")
+
+	// Parse flags from args
+	fls.Parse(args)
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	if len(pos) == 0 {
+		fmt.Println("fatal: no reflog specified to delete")
+		os.Exit(128)
+	}
+
+	// Entries to delete, by reflog, numbered from the newest one
+	refNames := []string{}
+	selected := map[string]map[int]bool{}
+	for _, arg := range pos {
+		at := strings.Index(arg, "@{")
+		if at == -1 || !strings.HasSuffix(arg, "}") {
+			fmt.Printf("fatal: not a reflog: %s\n", arg)
+			os.Exit(128)
+		}
+		n, err := strconv.Atoi(arg[at+2 : len(arg)-1])
+		if err != nil || n < 0 {
+			fmt.Printf("fatal: not a reflog: %s\n", arg)
+			os.Exit(128)
+		}
+		refName, err := repo.ReflogRefName(arg[:at])
+		if err != nil {
+			fmt.Println("Error reading .git/HEAD:", err)
+			os.Exit(1)
+		}
+		if selected[refName] == nil {
+			selected[refName] = map[int]bool{}
+			refNames = append(refNames, refName)
+		}
+		selected[refName][n] = true
+	}
+
+	for _, refName := range refNames {
+		entries, err := repo.ReadReflog(refName)
+		if err != nil {
+			fmt.Println("Error reading reflog:", err)
+			os.Exit(1)
+		}
+		for n := range selected[refName] {
+			if n >= len(entries) {
+				fmt.Printf("error: reflog of '%s' has no entry %d\n", refName, n)
+				os.Exit(1)
+			}
+		}
+
+		kept := entries[:0]
+		for i, entry := range entries {
+			n := len(entries) - 1 - i
+			if !selected[refName][n] {
+				kept = append(kept, entry)
+			} else if dryRun {
+				fmt.Printf("would delete %s@{%d}: %s\n", strings.TrimPrefix(refName, "refs/heads/"), n, entry.Message)
+			}
+		}
+		if dryRun {
+			continue
+		}
+		if err := repo.WriteReflog(refName, kept); err != nil {
+			fmt.Println("Error writing reflog:", err)
+			os.Exit(1)
+		}
+	}
+}
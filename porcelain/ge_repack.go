@@ -0,0 +1,240 @@
+package porcelain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+	"github.com/brickster241/GitEngine/utils/constants"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// Invoked from main.go. RepackObjects handles the 'gegit repack' command to combine objects into a delta-compressed packfile.
+func RepackObjects(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("repack",
+		"Combines all objects that do not currently reside in a \"pack\" into a pack. With -a, all reachable objects are packed into a single pack, which can be used to reorganize existing packs.",
+		"gegit repack [-a] [-d] [-window <n>] [-depth <n>]")
+	a := fls.Bool("a", false, "Pack everything reachable into a single pack, instead of only the loose objects.")
+	d := fls.Bool("d", false, "After packing, remove redundant packs and loose objects that are now packed.")
+	window := fls.Int("window", plumbing.DefaultPackWindow, "Number of objects to consider as delta bases for each object.")
+	depth := fls.Int("depth", plumbing.DefaultPackDepth, "Maximum delta chain length.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	if len(pos) != 0 || *window < 0 || *depth < 0 {
+		fmt.Println("usage: gegit repack [-a] [-d] [-window <n>] [-depth <n>]")
+		os.Exit(1)
+	}
+
+	if err := repack(repo, *a, *d, *window, *depth, ""); err != nil {
+		fmt.Println("Error repacking objects:", err)
+		os.Exit(1)
+	}
+}
+
+// repack packs reachable objects (all of them, or only the ones not packed yet) and optionally removes what became redundant. Unreachable objects of the packs removed are kept as loose objects when they may not be pruned yet, according to expire ("" for gc.pruneExpire).
+func repack(repo *plumbing.Repository, all, removeRedundant bool, window, depth int, expire string) error {
+
+	// Packing is only possible for the on-disk object layout
+	objectStore, ok := repo.Objects.(*plumbing.LooseObjectStore)
+	if !ok {
+		return fmt.Errorf("object store does not support packing")
+	}
+
+	// Collect roots : every ref, HEAD and the index
+	roots, err := reachabilityRoots(repo)
+	if err != nil {
+		return err
+	}
+
+	// Walk the object graph from the roots
+	objects, err := repo.ReachableObjects(roots)
+	if err != nil {
+		return err
+	}
+
+	// Without -a, only loose objects are packed
+	if !all {
+		loose := []types.ObjectInfo{}
+		for _, obj := range objects {
+			if !objectStore.HasPacked(obj.SHA) {
+				loose = append(loose, obj)
+			}
+		}
+		objects = loose
+	}
+
+	if len(objects) == 0 {
+		fmt.Println("Nothing new to pack.")
+		return nil
+	}
+
+	// Existing packs, which become redundant after a full repack
+	oldPacks, err := objectStore.PackNames()
+	if err != nil {
+		return err
+	}
+
+	packSHA, err := objectStore.WritePack(objects, window, depth)
+	if err != nil {
+		return err
+	}
+	packName := hex.EncodeToString(packSHA[:])
+	fmt.Printf("Packed %d objects into pack-%s.pack\n", len(objects), packName)
+
+	if !removeRedundant {
+		return nil
+	}
+
+	// Remove old packs (only after -a, they may still hold objects otherwise), once their unreachable objects which prune would keep are loose
+	if all {
+		if err := loosenUnreachable(repo, objectStore, oldPacks, packName, objects, expire); err != nil {
+			return err
+		}
+		for _, name := range oldPacks {
+			if name == packName {
+				continue
+			}
+			if err := objectStore.RemovePack(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Remove loose objects which are now packed
+	removed, err := objectStore.RemovePackedLooseObjects()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d redundant loose objects\n", removed)
+	return nil
+}
+
+// loosenUnreachable writes the unreachable objects of the packs about to be removed (all but keepPack) as loose objects dated like their pack, when prune would keep them : the ones of packs modified since expire, and the ones they or recent loose objects point to. Like git repack -A, they can then expire like any loose object.
+func loosenUnreachable(repo *plumbing.Repository, objectStore *plumbing.LooseObjectStore, packs []string, keepPack string, reachable []types.ObjectInfo, expire string) error {
+	expireTime, err := expiryTime(repo, expire, "gc.pruneExpire", plumbing.DefaultPruneExpire)
+	if err != nil {
+		return err
+	}
+	keep := map[[20]byte]bool{}
+	for _, obj := range reachable {
+		keep[obj.SHA] = true
+	}
+
+	// Unreachable packed objects, dated like the most recent pack holding them
+	unreachable := map[[20]byte]time.Time{}
+	for _, name := range packs {
+		if name == keepPack {
+			continue
+		}
+		shas, mtime, err := objectStore.PackObjects(name)
+		if err != nil {
+			return err
+		}
+		for _, sha := range shas {
+			if when, seen := unreachable[sha]; !keep[sha] && (!seen || mtime.After(when)) {
+				unreachable[sha] = mtime
+			}
+		}
+	}
+	if len(unreachable) == 0 {
+		return nil
+	}
+
+	// Recent objects, packed or loose, are kept along with everything they point to, however old
+	recent, err := objectStore.RecentLooseObjects(keep, expireTime)
+	if err != nil {
+		return err
+	}
+	for sha, mtime := range unreachable {
+		if !mtime.Before(expireTime) {
+			recent = append(recent, sha)
+		}
+	}
+	protected, err := repo.ReachableObjectsSkipMissing(recent)
+	if err != nil {
+		return err
+	}
+
+	loosened := 0
+	for _, obj := range protected {
+		if mtime, ok := unreachable[obj.SHA]; ok {
+			if err := objectStore.LoosenObject(obj.SHA, mtime); err != nil {
+				return err
+			}
+			loosened++
+		}
+	}
+	if loosened > 0 {
+		fmt.Printf("Loosened %d unreachable objects\n", loosened)
+	}
+	return nil
+}
+
+// reachabilityRoots returns the SHAs every reachability walk starts from : all refs, HEAD, the objects recorded in reflogs and the blobs and cache-tree trees of the index.
+func reachabilityRoots(repo *plumbing.Repository) ([][20]byte, error) {
+	roots := [][20]byte{}
+
+	// All refs
+	refs, err := repo.ListRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, sha := range refs {
+		roots = append(roots, sha)
+	}
+
+	// HEAD (may be detached)
+	headInfo, err := repo.ReadHEADInfo()
+	if err != nil {
+		return nil, err
+	}
+	if headInfo.SHA != [20]byte{} {
+		roots = append(roots, headInfo.SHA)
+	}
+
+	// Reflog entries, skipping objects which are already gone
+	reflogs, err := repo.ReflogNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range reflogs {
+		entries, err := repo.ReadReflog(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			for _, sha := range [][20]byte{entry.Old, entry.New} {
+				if sha != ([20]byte{}) && repo.Objects.Has(sha) {
+					roots = append(roots, sha)
+				}
+			}
+		}
+	}
+
+	// Index entries, and the trees still valid in its cache-tree
+	index, err := repo.ReadIndexFile()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range index.Entries {
+		if e.Mode != constants.ModeGitlink {
+			roots = append(roots, e.SHA1)
+		}
+	}
+	for _, sha := range plumbing.ValidCacheTrees(index.CacheTree) {
+		if repo.Objects.Has(sha) {
+			roots = append(roots, sha)
+		}
+	}
+	return roots, nil
+}
@@ -3,7 +3,6 @@ package porcelain
 import (
 	"encoding/hex"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
@@ -15,7 +14,7 @@ import (
 )
 
 // Invoked from main.go. ShowStatus handles the 'gegit status' command to show the working tree status.
-func ShowStatus(args []string) {
+func ShowStatus(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("status",
@@ -35,12 +34,16 @@ func ShowStatus(args []string) {
 	}
 
 	// Get HeadTree Map
-	headTreeSHA, ok, err := plumbing.ReadHEADTreeSHA()
+	headTreeSHA, ok, err := repo.ReadHEADTreeSHA()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
 	headTreeEntryMap := map[string]types.TreeEntry{}
 
 	// Use FlattenTree to get all tree entries, and filter blobs.
 	if ok {
-		headAll, _ := plumbing.FlattenTree(headTreeSHA)
+		headAll, _ := repo.FlattenTree(headTreeSHA)
 		for path, te := range headAll {
 			if te.Type == types.BlobObject {
 				headTreeEntryMap[path] = te
@@ -49,51 +52,68 @@ func ShowStatus(args []string) {
 	}
 
 	// Load the index
-	entries, err := plumbing.LoadIndex()
+	entries, err := repo.LoadIndex()
 	if err != nil {
 		fmt.Println("Error loading index:", err)
 		return
 	}
 
-	// Create a map for quick lookup of existing entries
+	// Create a map for quick lookup of existing entries. Submodules are not compared, their working tree is another repository.
 	indexMap := plumbing.IndexToMap(entries)
+	for path, ie := range indexMap {
+		if ie.Mode == constants.ModeGitlink {
+			delete(indexMap, path)
+		}
+	}
 
-	// Create path -> hash Map for workTree
-	workTreeMap := map[string][20]byte{}
+	// Unmerged paths are reported apart, from the stages they have
+	unmergedPaths, unmergedStages := plumbing.UnmergedPaths(entries)
 
-	// Walk the working directory to find all files
-	_ = filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			fmt.Println("Error accessing path:", err)
-			return nil
-		}
+	// Load the ignore rules
+	matcher, err := repo.NewIgnoreMatcher()
+	if err != nil {
+		fmt.Println("Error loading ignore rules:", err)
+		return
+	}
 
-		// Skip the root directory itself
-		if path == "." {
-			return nil
-		}
+	// Walk the working directory to find all files which are not ignored
+	files, err := repo.WorkTreeFiles("", matcher)
+	if err != nil {
+		fmt.Println("Error walking working tree:", err)
+		return
+	}
 
-		// Skip the .gegit directory
-		if d.IsDir() && d.Name() == ".git" {
-			return filepath.SkipDir
+	// Tracked files are always compared, even when they match an ignore rule
+	notIgnored := map[string]bool{}
+	for _, path := range files {
+		notIgnored[path] = true
+	}
+	for path := range indexMap {
+		if _, err := os.Lstat(repo.WorkPath(path)); err == nil && !notIgnored[path] {
+			files = append(files, path)
 		}
+	}
 
-		// Skip directories, only add files
-		if d.IsDir() {
-			return nil
-		}
+	// Whether the executable bit of files can be trusted (core.filemode)
+	fileModeTrusted := repo.FileModeTrusted()
 
-		// Clean and normalize the path
-		cleanPath := filepath.ToSlash(filepath.Clean(path))
-		data, _ := os.ReadFile(cleanPath)
+	// Create path -> hash and path -> mode Maps for workTree
+	workTreeMap := map[string][20]byte{}
+	workTreeModes := map[string]uint32{}
+	for _, path := range files {
+		data, info, err := repo.ReadWorkTreeFile(path)
+		if err != nil {
+			fmt.Println("Error reading file:", err)
+			continue
+		}
 		sha, err := plumbing.HashObject(types.BlobObject, data)
 		if err == nil {
-			workTreeMap[cleanPath] = sha
+			workTreeMap[path] = sha
+			workTreeModes[path] = plumbing.ResolveFileMode(plumbing.WorkTreeMode(info), indexMap[path].Mode, fileModeTrusted)
 		} else {
 			fmt.Println("Error Hashing File:", err)
 		}
-		return nil
-	})
+	}
 
 	staged := map[string]types.StatusType{}
 	unstaged := map[string]types.StatusType{}
@@ -101,24 +121,30 @@ func ShowStatus(args []string) {
 
 	// Changes to be committed (HEAD <-> INDEX)
 	for path, idxEntry := range indexMap {
+		if idxEntry.Stage() != 0 {
+			continue
+		}
 		headTreeEntry, exists := headTreeEntryMap[path]
 		if !exists {
 			// Does not exist in HEAD, will be added as a new file
 			staged[path] = types.AddedStatus
-		} else if headTreeEntry.SHA != idxEntry.SHA1 {
-			// Exists in HEAD, but has a different SHA, that means it was modified
+		} else if headTreeEntry.SHA != idxEntry.SHA1 || headTreeEntry.Mode != idxEntry.Mode {
+			// Exists in HEAD, but has a different SHA or mode, that means it was modified
 			staged[path] = types.ModifiedStatus
 		}
 	}
 
 	// Changes not staged (INDEX <-> WORKTREE)
 	for path, idxEntry := range indexMap {
+		if idxEntry.Stage() != 0 {
+			continue
+		}
 		workTreeSHA, exists := workTreeMap[path]
 		if !exists {
 			// Does not exist in workTree, but present in index so deletion has not been added yet.
 			unstaged[path] = types.DeletedStatus
-		} else if workTreeSHA != idxEntry.SHA1 {
-			// Changes exist in worktree, but not in index even though file exists. So, modifications have not been added yet.
+		} else if workTreeSHA != idxEntry.SHA1 || workTreeModes[path] != idxEntry.Mode {
+			// Changes (content or mode) exist in worktree, but not in index even though file exists. So, modifications have not been added yet.
 			unstaged[path] = types.ModifiedStatus
 		}
 	}
@@ -140,7 +166,11 @@ func ShowStatus(args []string) {
 	}
 
 	// First Line : On branch <branchName> or HEAD detached at <sha>
-	head, _ := plumbing.ReadHEADInfo()
+	head, err := repo.ReadHEADInfo()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
 
 	if head.SHA != [20]byte{} && head.Branch != "" {
 		if head.Detached {
@@ -151,11 +181,23 @@ func ShowStatus(args []string) {
 		}
 	}
 
+	// Mention a merge in progress
+	if mergeHeads, _ := repo.ReadMergeHeads(); len(mergeHeads) > 0 {
+		if len(unmergedPaths) > 0 {
+			fmt.Println("You have unmerged paths.")
+			fmt.Println("\t(fix conflicts and run \"gegit commit\")")
+			fmt.Println("\t(use \"gegit merge --abort\" to abort the merge)")
+		} else {
+			fmt.Println("All conflicts fixed but you are still merging.")
+			fmt.Println("\t(use \"gegit commit\" to conclude merge)")
+		}
+	}
+
 	// Also mention if any commits are not present
 	if headTreeSHA == [20]byte{} {
 		fmt.Println("No commits yet")
 	}
-	if len(staged)+len(unstaged)+len(untracked) == 0 {
+	if len(staged)+len(unmergedPaths)+len(unstaged)+len(untracked) == 0 {
 		fmt.Println("Nothing to commit, working tree clean")
 		return
 	}
@@ -176,6 +218,16 @@ func ShowStatus(args []string) {
 		}
 	}
 
+	// Unmerged paths - Section
+	if len(unmergedPaths) > 0 {
+		fmt.Printf("\n%sUnmerged paths:%s\n", constants.BoldColor, constants.ResetColor)
+		fmt.Println("\t(use \"gegit add <file>...\" to mark resolution)")
+
+		for _, path := range unmergedPaths {
+			printStatusLine(constants.RedColor, fmt.Sprintf("%-17s", unmergedLabel(unmergedStages[path])), path)
+		}
+	}
+
 	// Changes not staged for commit - Section
 	if len(unstaged) > 0 {
 		fmt.Printf("\n%sChanges not staged for commit:%s\n", constants.BoldColor, constants.ResetColor)
@@ -206,3 +258,27 @@ func ShowStatus(args []string) {
 func printStatusLine(color, label, path string) {
 	fmt.Printf("\t%s%-12s%s %s\n", color, label, path, constants.ResetColor)
 }
+
+// unmergedLabel describes how an unmerged path conflicts, from the stages it has in the index : 1 (common ancestor), 2 (ours) and 3 (theirs).
+func unmergedLabel(stages []int) string {
+	mask := 0
+	for _, stage := range stages {
+		mask |= 1 << (stage - 1)
+	}
+	switch mask {
+	case 0b001:
+		return "both deleted:"
+	case 0b010:
+		return "added by us:"
+	case 0b011:
+		return "deleted by them:"
+	case 0b100:
+		return "added by them:"
+	case 0b101:
+		return "deleted by us:"
+	case 0b110:
+		return "both added:"
+	default:
+		return "both modified:"
+	}
+}
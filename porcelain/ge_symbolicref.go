@@ -0,0 +1,106 @@
+package porcelain
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+)
+
+// Invoked from main.go. SymbolicRef handles the 'gegit symbolic-ref' command to read, update or delete symbolic refs.
+func SymbolicRef(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("symbolic-ref",
+		"With one argument, prints the ref the symbolic ref <name> points to, following further symbolic refs. With two arguments, points <name> at <ref> (HEAD can only point to a branch). With -d, deletes the symbolic ref itself.",
+		"gegit symbolic-ref [-q] [--short] [--no-recurse] <name> | [-m <reason>] <name> <ref> | -d [-q] <name>")
+	quiet := fls.Bool("q", false, "Don't print an error when <name> is not a symbolic ref, only exit with 1.")
+	short := fls.Bool("short", false, "Print the ref shortened, e.g. master for refs/heads/master.")
+	noRecurse := fls.Bool("no-recurse", false, "Print the ref <name> points to, even when it is symbolic itself.")
+	message := fls.String("m", "", "Reason of the update, recorded in the reflog of <name>.")
+	del := fls.Bool("d", false, "Delete the symbolic ref <name>.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	switch {
+	case *del:
+		if len(pos) != 1 {
+			fmt.Println("usage: gegit symbolic-ref -d [-q] <name>")
+			os.Exit(1)
+		}
+		deleteSymbolicRef(repo, pos[0], *quiet)
+
+	case len(pos) == 1:
+		printSymbolicRef(repo, pos[0], *quiet, *short, *noRecurse)
+
+	case len(pos) == 2:
+		if err := repo.WriteSymbolicRef(pos[0], pos[1], *message); err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
+
+	default:
+		fmt.Println("usage: gegit symbolic-ref [-q] [--short] [--no-recurse] <name> | [-m <reason>] <name> <ref> | -d [-q] <name>")
+		os.Exit(1)
+	}
+}
+
+// printSymbolicRef prints the ref name points to : the last one of the chain of symbolic refs, or the first one with noRecurse.
+func printSymbolicRef(repo *plumbing.Repository, name string, quiet, short, noRecurse bool) {
+	target, isSymbolic := repo.ReadSymbolicRef(name)
+	if !isSymbolic {
+		if !quiet {
+			fmt.Printf("fatal: ref %s is not a symbolic ref\n", name)
+			os.Exit(128)
+		}
+		os.Exit(1)
+	}
+
+	if !noRecurse {
+		resolved, err := repo.ResolveSymbolicRef(name)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
+		target = resolved
+	}
+	if short {
+		target = shortRefName(target)
+	}
+	fmt.Println(target)
+}
+
+// deleteSymbolicRef deletes the symbolic ref name, refusing to delete HEAD.
+func deleteSymbolicRef(repo *plumbing.Repository, name string, quiet bool) {
+	if name == "HEAD" {
+		fmt.Printf("fatal: deleting '%s' is not allowed\n", name)
+		os.Exit(128)
+	}
+	if _, isSymbolic := repo.ReadSymbolicRef(name); !isSymbolic {
+		if !quiet {
+			fmt.Printf("fatal: Cannot delete %s, not a symbolic ref\n", name)
+			os.Exit(128)
+		}
+		os.Exit(1)
+	}
+	if err := repo.DeleteSymbolicRef(name); err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+}
+
+// shortRefName shortens the full name of a ref the way git prints it : refs/heads/master as master, refs/remotes/origin/main as origin/main.
+func shortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+		if short, ok := strings.CutPrefix(name, prefix); ok {
+			return short
+		}
+	}
+	return name
+}
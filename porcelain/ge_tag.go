@@ -0,0 +1,212 @@
+package porcelain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+)
+
+// "-n<num>", the number of message lines to show when listing tags
+var tagLinesFlagRegex = regexp.MustCompile(`^-n(\d+)$`)
+
+// Invoked from main.go. TagOps handles the 'gegit tag' command to list, create or delete tags.
+func TagOps(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("tag",
+		"List, create or delete tags. A lightweight tag is a ref under refs/tags pointing to an object, an annotated tag (-a, or -m) points to a tag object recording the tagger, the date and a message.",
+		"gegit tag [-n[<num>]] [-l [<pattern>...]] | [-a] [-m <msg>] <tagname> [<object>] | -d <tagname>...")
+	list := fls.Bool("l", false, "List tags, only the ones matching one of the patterns if given.")
+	annotate := fls.Bool("a", false, "Make an unsigned, annotated tag object.")
+	message := fls.String("m", "", "Use the given tag message, which implies -a.")
+	del := fls.Bool("d", false, "Delete existing tags with the given names.")
+	lines := fls.Int("n", 0, "Print the first <num> lines of the message of each tag (1 if <num> is omitted). Implies -l.")
+
+	// "-n" is rewritten to "-n=1" and "-n5" to "-n=5" for the flag parser
+	flagArgs := slices.Clone(args[1:])
+	for i, arg := range flagArgs {
+		if arg == "-n" {
+			flagArgs[i] = "-n=1"
+		} else {
+			flagArgs[i] = tagLinesFlagRegex.ReplaceAllString(arg, "-n=$1")
+		}
+	}
+
+	// Parse flags from args, which may also follow the tag name as in "gegit tag v1 -m <msg>"
+	pos := []string{}
+	for rest := flagArgs; ; {
+		fls.Parse(rest)
+		if rest = fls.Args(); len(rest) == 0 {
+			break
+		}
+
+		// Positional arguments (non-flag)
+		pos, rest = append(pos, rest[0]), rest[1:]
+	}
+
+	switch {
+	case *del:
+		if len(pos) == 0 || *list || *annotate || *message != "" {
+			fmt.Println("usage: gegit tag -d <tagname>...")
+			os.Exit(1)
+		}
+		deleteTags(repo, pos)
+
+	case *list || *lines > 0 || (len(pos) == 0 && !*annotate && *message == ""):
+		if *annotate || *message != "" {
+			fmt.Println("usage: gegit tag [-n[<num>]] [-l [<pattern>...]]")
+			os.Exit(1)
+		}
+		listTags(repo, pos, *lines)
+
+	default:
+		if len(pos) == 0 || len(pos) > 2 {
+			fmt.Println("usage: gegit tag [-a] [-m <msg>] <tagname> [<object>]")
+			os.Exit(1)
+		}
+		target := "HEAD"
+		if len(pos) == 2 {
+			target = pos[1]
+		}
+		createTag(repo, pos[0], target, *annotate || *message != "", *message)
+	}
+}
+
+// listTags prints the names of the tags matching one of the patterns (all of them without patterns), followed by the first lines of their message when lines > 0.
+func listTags(repo *plumbing.Repository, patterns []string, lines int) {
+	names, err := repo.ListTags()
+	if err != nil {
+		fmt.Println("Error listing tags:", err)
+		os.Exit(1)
+	}
+
+	for _, name := range names {
+		if !matchesAnyPattern(name, patterns) {
+			continue
+		}
+		if lines == 0 {
+			fmt.Println(name)
+			continue
+		}
+
+		// Message lines, indented below the first one
+		messageLines := tagMessageLines(repo, name, lines)
+		if len(messageLines) == 0 {
+			fmt.Println(name)
+			continue
+		}
+		fmt.Printf("%-15s %s\n", name, messageLines[0])
+		for _, line := range messageLines[1:] {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+}
+
+// matchesAnyPattern reports whether name matches one of the glob patterns, or there are none.
+func matchesAnyPattern(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tagMessageLines returns up to n lines of the message of a tag : the tag object's for annotated tags, else the tagged commit's.
+func tagMessageLines(repo *plumbing.Repository, name string, n int) []string {
+	sha, _ := repo.ReadTagRef(name)
+	var message string
+	if tag, err := repo.ReadTag(sha); err == nil {
+		message = tag.Message
+	} else if commit, err := repo.ReadCommit(sha); err == nil {
+		message = commit.Message
+	}
+
+	message = strings.TrimRight(message, "\n")
+	if message == "" {
+		return nil
+	}
+	messageLines := strings.Split(message, "\n")
+	if len(messageLines) > n {
+		messageLines = messageLines[:n]
+	}
+	return messageLines
+}
+
+// createTag creates the tag name for the object target : a tag object first when annotated.
+func createTag(repo *plumbing.Repository, name, target string, annotated bool, message string) {
+	if _, exists := repo.ReadTagRef(name); exists {
+		fmt.Printf("fatal: tag '%s' already exists\n", name)
+		os.Exit(128)
+	}
+	if annotated && message == "" {
+		fmt.Println("fatal: no tag message?")
+		os.Exit(128)
+	}
+
+	sha, err := resolveTagTarget(repo, target)
+	if err != nil {
+		fmt.Printf("fatal: Failed to resolve '%s' as a valid ref.\n", target)
+		os.Exit(128)
+	}
+
+	if annotated {
+		tagger, err := getAuthorInfo(repo)
+		if err != nil {
+			fmt.Println("Error fetching author info from .git/config:", err)
+			os.Exit(1)
+		}
+		if sha, err = repo.WriteTag(name, sha, tagger, message); err != nil {
+			fmt.Println("Error writing tag object:", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := repo.CreateTagRef(name, sha); err != nil {
+		fmt.Println("Error creating tag:", err)
+		os.Exit(1)
+	}
+}
+
+// resolveTagTarget resolves the object to tag : tags and full SHAs as they are (a tag can be tagged), anything else as a commit-ish.
+func resolveTagTarget(repo *plumbing.Repository, target string) ([20]byte, error) {
+	if sha, isTag := repo.ReadTagRef(target); isTag {
+		return sha, nil
+	}
+	if _, _, err := repo.ReadObject(target); err == nil {
+		shaBytes, _ := hex.DecodeString(target)
+		return [20]byte(shaBytes), nil
+	}
+	return repo.ResolveCommitish(target)
+}
+
+// deleteTags deletes the given tags, loose or packed. Exits with 1 when one of them doesn't exist, after deleting the others.
+func deleteTags(repo *plumbing.Repository, names []string) {
+	failed := false
+	for _, name := range names {
+		sha, exists := repo.ReadTagRef(name)
+		if !exists {
+			fmt.Printf("error: tag '%s' not found.\n", name)
+			failed = true
+			continue
+		}
+		if err := repo.DeleteRef("refs/tags/" + name); err != nil {
+			fmt.Printf("Error deleting tag '%s': %s\n", name, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted tag '%s' (was %s)\n", name, hex.EncodeToString(sha[:])[:7])
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
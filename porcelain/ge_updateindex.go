@@ -4,7 +4,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/brickster241/GitEngine/plumbing"
 	"github.com/brickster241/GitEngine/utils"
@@ -12,7 +11,7 @@ import (
 )
 
 // Invoked from main.go. RegisterFileAndUpdateIndex handles the 'gegit update-index' command to register file contents in the working tree to the index.
-func RegisterFileAndUpdateIndex(args []string) {
+func RegisterFileAndUpdateIndex(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("update-index",
@@ -37,12 +36,24 @@ func RegisterFileAndUpdateIndex(args []string) {
 
 	if len(shaHex) == 40 {
 
-		// Clean Path
-		cleanPath := filepath.ToSlash(filepath.Clean(fp))
+		// Path relative to the root of the working tree
+		cleanPath, err := repo.RepoPath(fp)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
+
+		// Hold index.lock from reading the index until it is written back
+		lock, err := repo.LockIndex()
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(128)
+		}
 
 		// Load Index
-		entries, err := plumbing.LoadIndex()
+		entries, err := repo.LoadIndex()
 		if err != nil {
+			lock.Rollback()
 			fmt.Println("Error loading index:", err)
 			os.Exit(1)
 		}
@@ -59,6 +70,7 @@ func RegisterFileAndUpdateIndex(args []string) {
 		// Check whether shaHex is valid.
 		sha, err := hex.DecodeString(shaHex)
 		if err != nil {
+			lock.Rollback()
 			fmt.Println("Error decoding <object> hex")
 			os.Exit(1)
 		}
@@ -66,6 +78,7 @@ func RegisterFileAndUpdateIndex(args []string) {
 		// Check whether Mode is valid.
 		uint32Mode, err := utils.ParseModeStr(mode)
 		if err != nil {
+			lock.Rollback()
 			fmt.Println("Error parsing Mode string:", err)
 			os.Exit(1)
 		}
@@ -85,7 +98,7 @@ func RegisterFileAndUpdateIndex(args []string) {
 		}
 
 		// Write to Index (Will sort entries based on Filename)
-		if err := plumbing.WriteIndex(entries); err != nil {
+		if err := repo.WriteIndex(lock, entries); err != nil {
 			fmt.Println("Error updating Index:", err)
 			os.Exit(1)
 		}
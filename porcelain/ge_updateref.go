@@ -0,0 +1,134 @@
+package porcelain
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/brickster241/GitEngine/plumbing"
+	"github.com/brickster241/GitEngine/utils"
+	"github.com/brickster241/GitEngine/utils/types"
+)
+
+// Invoked from main.go. UpdateRef handles the 'gegit update-ref' command to update, create or delete refs safely, through a ref transaction.
+func UpdateRef(repo *plumbing.Repository, args []string) {
+
+	// Define flagset
+	fls := utils.CreateCommandFlagSet("update-ref",
+		"Updates the ref to point to <new>, provided it still points to <old> when given (an empty or zero <old> : the ref must not exist). With -d, deletes the ref. With --stdin, reads one command per line, \"update <ref> <new> [<old>]\", \"create <ref> <new>\", \"delete <ref> [<old>]\" or \"verify <ref> [<old>]\", and applies all of them or none.",
+		"gegit update-ref [-m <reason>] [--no-deref] (-d <ref> [<old>] | <ref> <new> [<old>] | --stdin)")
+	message := fls.String("m", "", "Reason of the update, recorded in the reflogs.")
+	del := fls.Bool("d", false, "Delete the ref, after checking it still points to <old> when given.")
+	noDeref := fls.Bool("no-deref", false, "Update HEAD itself rather than the branch it is on.")
+	stdin := fls.Bool("stdin", false, "Read the updates from the standard input, and apply them in a single transaction.")
+
+	// Parse flags from args
+	fls.Parse(args[1:])
+
+	// Positional arguments (non-flag)
+	pos := fls.Args()
+
+	tx := repo.NewRefTransaction()
+	switch {
+	case *stdin:
+		if len(pos) != 0 || *del {
+			fmt.Println("usage: gegit update-ref [-m <reason>] [--no-deref] --stdin")
+			os.Exit(1)
+		}
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				tx.Add(parseRefUpdateLine(repo, line, *message, *noDeref))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Println("Error reading standard input:", err)
+			os.Exit(1)
+		}
+
+	case *del:
+		if len(pos) < 1 || len(pos) > 2 {
+			fmt.Println("usage: gegit update-ref [--no-deref] -d <ref> [<old>]")
+			os.Exit(1)
+		}
+		update := types.RefUpdate{Name: pos[0], Delete: true, NoDeref: *noDeref}
+		if len(pos) == 2 {
+			update.Old, update.HaveOld = resolveRefValue(repo, pos[1]), true
+		}
+		tx.Add(update)
+
+	default:
+		if len(pos) < 2 || len(pos) > 3 {
+			fmt.Println("usage: gegit update-ref [-m <reason>] [--no-deref] <ref> <new> [<old>]")
+			os.Exit(1)
+		}
+		update := types.RefUpdate{Name: pos[0], New: resolveRefValue(repo, pos[1]), NoDeref: *noDeref, Message: *message}
+		if len(pos) == 3 {
+			update.Old, update.HaveOld = resolveRefValue(repo, pos[2]), true
+		}
+		tx.Add(update)
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+}
+
+// parseRefUpdateLine parses one command read by 'gegit update-ref --stdin'. A missing <old> is not checked, except for verify where the ref must then not exist.
+func parseRefUpdateLine(repo *plumbing.Repository, line string, message string, noDeref bool) types.RefUpdate {
+	fields := strings.Fields(line)
+
+	// Number of arguments (the ref included) each command takes, at least and at most
+	argCounts := map[string][2]int{"update": {2, 3}, "create": {2, 2}, "delete": {1, 2}, "verify": {1, 2}}
+	counts, known := argCounts[fields[0]]
+	if !known {
+		fmt.Println("fatal: unknown command:", line)
+		os.Exit(128)
+	}
+	values := fields[1:]
+	if len(values) < counts[0] || len(values) > counts[1] {
+		fmt.Printf("fatal: %s: wrong number of arguments: %s\n", fields[0], line)
+		os.Exit(128)
+	}
+
+	update := types.RefUpdate{Name: values[0], NoDeref: noDeref, Message: message}
+	switch fields[0] {
+	case "update", "create":
+		update.New = resolveRefValue(repo, values[1])
+		if update.New == [20]byte{} {
+			fmt.Printf("fatal: %s %s: zero <new>\n", fields[0], values[0])
+			os.Exit(128)
+		}
+		values = values[2:]
+		update.HaveOld = fields[0] == "create"
+	case "delete":
+		update.Delete = true
+		values = values[1:]
+	case "verify":
+		update.Verify, update.HaveOld = true, true
+		values = values[1:]
+	}
+	if len(values) == 1 {
+		update.Old, update.HaveOld = resolveRefValue(repo, values[0]), true
+	}
+	return update
+}
+
+// resolveRefValue resolves a value given to update-ref : empty or all zeros means no ref at all, a full SHA is used as it is (even when the object is missing, the transaction reports it), a tag as it is, anything else as a commit-ish.
+func resolveRefValue(repo *plumbing.Repository, value string) [20]byte {
+	if strings.Trim(value, "0") == "" {
+		return [20]byte{}
+	}
+	if sha, err := hex.DecodeString(value); err == nil && len(sha) == 20 {
+		return [20]byte(sha)
+	}
+	sha, err := resolveTagTarget(repo, value)
+	if err != nil {
+		fmt.Printf("fatal: %s: not a valid SHA1\n", value)
+		os.Exit(128)
+	}
+	return sha
+}
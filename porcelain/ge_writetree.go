@@ -10,7 +10,7 @@ import (
 )
 
 // Invoked from main.go. WriteTreeFromIndex handles the 'gegit write-tree' command to create a tree object from the current index and write it to object database.
-func WriteTreeFromIndex(args []string) {
+func WriteTreeFromIndex(repo *plumbing.Repository, args []string) {
 
 	// Define flagset
 	fls := utils.CreateCommandFlagSet("write-tree",
@@ -29,28 +29,58 @@ func WriteTreeFromIndex(args []string) {
 		os.Exit(1)
 	}
 
+	// Hold index.lock from reading the index until the cache-tree is written back
+	lock, err := repo.LockIndex()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(128)
+	}
+
 	// Load Index
-	entries, err := plumbing.LoadIndex()
+	index, err := repo.ReadIndexFile()
 	if err != nil {
+		lock.Rollback()
 		fmt.Println("Error loading .git/index:", err)
 		os.Exit(1)
 	}
+	entries := index.Entries
 
 	// Index should not be empty
 	if len(entries) == 0 {
+		lock.Rollback()
 		fmt.Println("Error: index should not be empty")
 		os.Exit(1)
 	}
-	// Build Tree from index entries
-	treeNode := plumbing.BuildTreeFromIndex(entries)
+	// Unmerged paths can't be written to a tree
+	unmerged := false
+	for _, ie := range entries {
+		if ie.Stage() != 0 {
+			fmt.Printf("%s: unmerged (%s)\n", ie.Filename, hex.EncodeToString(ie.SHA1[:]))
+			unmerged = true
+		}
+	}
+	if unmerged {
+		lock.Rollback()
+		fmt.Println("fatal: git-write-tree: error building trees")
+		os.Exit(128)
+	}
 
-	// Write Tree into .git/objects
-	treeSHA, err := plumbing.WriteTree(treeNode)
+	// Write Tree into .git/objects, reusing the unchanged directories of the cache-tree
+	treeSHA, updated, err := repo.WriteIndexTree(index)
 	if err != nil {
+		lock.Rollback()
 		fmt.Println("Error writing tree:", err)
 		os.Exit(1)
 	}
 
+	// Record the new trees in the cache-tree
+	if !updated {
+		lock.Rollback()
+	} else if err := repo.WriteIndexFile(lock, index); err != nil {
+		fmt.Printf("couldn't update .git/index: %s\n", err)
+		os.Exit(1)
+	}
+
 	// Output the written TreeSHA
 	fmt.Println(hex.EncodeToString(treeSHA[:]))
 }
@@ -5,8 +5,10 @@ const (
 	ModeExec    uint32 = 0100755
 	ModeSymlink uint32 = 0120000
 	ModeTree    uint32 = 0040000
+	ModeGitlink uint32 = 0160000
 
 	DefaultFilePerm = 0o644 // rw-r--r--
+	DefaultExecPerm = 0o755 // rwxr-xr-x
 	DefaultDirPerm  = 0o755 // rwxr-xr-x
 	ResetColor      = "\033[0m"
 	BoldColor       = "\033[1m"
@@ -14,6 +16,8 @@ const (
 	RedColor        = "\033[31m"
 	YellowColor     = "\033[33m"
 
+	GitDateLayout = "Mon Jan 2 15:04:05 2006 -0700" // Default date format of git log
+
 	Head   = "ref: refs/heads/master\n" // Default .git/HEAD content
 	Config = `[core]
 	repositoryformatversion = 0
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brickster241/GitEngine/utils/constants"
+)
+
+// Layouts accepted by ParseDate for absolute dates, tried in order. Layouts without a zone are read in the local timezone.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006.01.02",
+	"01/02/2006",
+	constants.GitDateLayout,
+	"Mon, 2 Jan 2006 15:04:05 -0700", // RFC 2822
+	"Jan 2 2006",
+	"2 Jan 2006",
+}
+
+// "<n> <unit>[s] [ago]", git also accepts dots as separators ("2.weeks.ago")
+var relativeDateRegex = regexp.MustCompile(`^(\d+)[ .]*(second|minute|hour|day|week|month|year)s?(?:[ .]+ago)?$`)
+
+// ParseDate parses the date formats understood by options like --since and --until : absolute dates ("2024-01-31", "2024-01-31 12:00:00", RFC 3339, RFC 2822, git's default format), unix timestamps ("@1700000000"), and relative dates ("now", "yesterday", "3 days ago", "2.weeks.ago") computed from now.
+func ParseDate(value string, now time.Time) (time.Time, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+
+	switch s {
+	case "now":
+		return now, nil
+	case "today":
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+
+	// Unix timestamp, with or without "@"
+	if digits, ok := strings.CutPrefix(s, "@"); ok || len(s) >= 9 {
+		if secs, err := strconv.ParseInt(digits, 10, 64); err == nil {
+			return time.Unix(secs, 0), nil
+		}
+	}
+
+	// Relative date
+	if m := relativeDateRegex.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "second":
+			return now.Add(-time.Duration(n) * time.Second), nil
+		case "minute":
+			return now.Add(-time.Duration(n) * time.Minute), nil
+		case "hour":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "day":
+			return now.AddDate(0, 0, -n), nil
+		case "week":
+			return now.AddDate(0, 0, -7*n), nil
+		case "month":
+			return now.AddDate(0, -n, 0), nil
+		case "year":
+			return now.AddDate(-n, 0, 0), nil
+		}
+	}
+
+	// Absolute date
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(value), now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %s", value)
+}
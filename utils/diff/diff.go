@@ -0,0 +1,349 @@
+// Package diff computes line-based differences between two texts, with the Myers, patience and histogram algorithms, and formats them as unified diffs.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+)
+
+// Algorithm selects how the longest common subsequence of lines is found.
+type Algorithm string
+
+const (
+	Myers     Algorithm = "myers"     // minimal diff, git's default
+	Patience  Algorithm = "patience"  // anchors on lines unique to both sides, then Myers in between
+	Histogram Algorithm = "histogram" // anchors on the least frequent common lines, like git's histogram
+)
+
+// ParseAlgorithm converts a --diff-algorithm value. "default" and "minimal" are Myers.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch name {
+	case "myers", "default", "minimal":
+		return Myers, nil
+	case "patience":
+		return Patience, nil
+	case "histogram":
+		return Histogram, nil
+	default:
+		return "", fmt.Errorf("unknown diff algorithm: %s", name)
+	}
+}
+
+// Operation is the kind of an Edit.
+type Operation int
+
+const (
+	Equal  Operation = iota // line present on both sides
+	Delete                  // line only in the old text
+	Insert                  // line only in the new text
+)
+
+// Edit is one line of an edit script. OldIndex and NewIndex are the 0-based line numbers on each side, -1 when the line doesn't exist there.
+type Edit struct {
+	Op       Operation
+	OldIndex int
+	NewIndex int
+	Text     string // line content, including its "\n" (missing on a last line without newline)
+}
+
+// SplitLines splits content into lines, each keeping its trailing "\n". A last line without newline is kept as is, so it differs from the same line with a newline.
+func SplitLines(content []byte) []string {
+	lines := []string{}
+	for len(content) > 0 {
+		idx := bytes.IndexByte(content, '\n')
+		if idx == -1 {
+			lines = append(lines, string(content))
+			break
+		}
+		lines = append(lines, string(content[:idx+1]))
+		content = content[idx+1:]
+	}
+	return lines
+}
+
+// IsBinary reports whether content looks binary, like git : it contains a NUL byte in its first 8000 bytes.
+func IsBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) != -1
+}
+
+// Lines computes the edit script turning oldLines into newLines. Within each changed region, deletions come before insertions.
+func Lines(oldLines, newLines []string, algo Algorithm) []Edit {
+
+	// Intern lines so that comparisons are integer comparisons
+	ids := map[string]int{}
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	a, b := intern(oldLines), intern(newLines)
+
+	// Matching line pairs, in increasing order on both sides
+	matches := [][2]int{}
+	switch algo {
+	case Patience:
+		patienceMatches(a, b, 0, 0, &matches)
+	case Histogram:
+		histogramMatches(a, b, 0, 0, &matches)
+	default:
+		myersMatches(a, b, 0, 0, &matches)
+	}
+
+	// Turn matches into an edit script
+	edits := make([]Edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	for _, m := range append(matches, [2]int{len(a), len(b)}) {
+		for ; i < m[0]; i++ {
+			edits = append(edits, Edit{Op: Delete, OldIndex: i, NewIndex: -1, Text: oldLines[i]})
+		}
+		for ; j < m[1]; j++ {
+			edits = append(edits, Edit{Op: Insert, OldIndex: -1, NewIndex: j, Text: newLines[j]})
+		}
+		if m[0] < len(a) {
+			edits = append(edits, Edit{Op: Equal, OldIndex: i, NewIndex: j, Text: oldLines[i]})
+			i, j = i+1, j+1
+		}
+	}
+	return edits
+}
+
+// commonAffixes appends the matches of the common prefix of a and b, and returns the remaining middle parts along with the length of the common suffix.
+func commonAffixes(a, b []int, aOff, bOff int, out *[][2]int) ([]int, []int, int, int, int) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		*out = append(*out, [2]int{aOff + prefix, bOff + prefix})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	aOff, bOff = aOff+prefix, bOff+prefix
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	return a[:len(a)-suffix], b[:len(b)-suffix], aOff, bOff, suffix
+}
+
+// appendSuffix appends the matches of a common suffix of the given length, which starts right after the middle parts.
+func appendSuffix(aEnd, bEnd, suffix int, out *[][2]int) {
+	for k := 0; k < suffix; k++ {
+		*out = append(*out, [2]int{aEnd + k, bEnd + k})
+	}
+}
+
+// myersMatches appends the matches of a shortest edit script between a and b (offset by aOff / bOff), using Myers' O(ND) greedy algorithm.
+func myersMatches(a, b []int, aOff, bOff int, out *[][2]int) {
+	a, b, aOff, bOff, suffix := commonAffixes(a, b, aOff, bOff, out)
+	defer appendSuffix(aOff+len(a), bOff+len(b), suffix, out)
+
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return
+	}
+
+	// v[offset+k] is the furthest x reached on diagonal k = x - y. trace keeps v[-d-1..d+1] at the start of each step d, for backtracking.
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	trace := [][]int{}
+
+	found := false
+	for d := 0; d <= maxD && !found; d++ {
+		trace = append(trace, slices.Clone(v[offset-d-1:offset+d+2]))
+
+		for k := -d; k <= d; k += 2 {
+			// Move down (insertion) or right (deletion), whichever reaches further
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+
+			// Follow the snake of equal lines
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	// Backtrack from the end, collecting the diagonals (matches) in reverse
+	reversed := [][2]int{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snap := trace[d] // snap[k+d+1] = v[k] at the start of step d
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && snap[k-1+d+1] < snap[k+1+d+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		// Step 0 starts at the origin
+		prevX, prevY := 0, 0
+		if d > 0 {
+			prevX = snap[prevK+d+1]
+			prevY = prevX - prevK
+		}
+
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			reversed = append(reversed, [2]int{aOff + x, bOff + y})
+		}
+		x, y = prevX, prevY
+	}
+	for i := len(reversed) - 1; i >= 0; i-- {
+		*out = append(*out, reversed[i])
+	}
+}
+
+// patienceMatches appends the matches found by patience diff : lines occurring exactly once on each side are matched along their longest increasing subsequence, and the gaps between them are diffed recursively, falling back to Myers.
+func patienceMatches(a, b []int, aOff, bOff int, out *[][2]int) {
+	a, b, aOff, bOff, suffix := commonAffixes(a, b, aOff, bOff, out)
+	defer appendSuffix(aOff+len(a), bOff+len(b), suffix, out)
+
+	if len(a) == 0 || len(b) == 0 {
+		return
+	}
+
+	// Lines unique to both sides
+	countA, countB, posB := map[int]int{}, map[int]int{}, map[int]int{}
+	for _, line := range a {
+		countA[line]++
+	}
+	for j, line := range b {
+		countB[line]++
+		posB[line] = j
+	}
+	pairs := [][2]int{}
+	for i, line := range a {
+		if countA[line] == 1 && countB[line] == 1 {
+			pairs = append(pairs, [2]int{i, posB[line]})
+		}
+	}
+	if len(pairs) == 0 {
+		myersMatches(a, b, aOff, bOff, out)
+		return
+	}
+
+	// Recurse between the anchors
+	prevA, prevB := 0, 0
+	for _, anchor := range longestIncreasing(pairs) {
+		patienceMatches(a[prevA:anchor[0]], b[prevB:anchor[1]], aOff+prevA, bOff+prevB, out)
+		*out = append(*out, [2]int{aOff + anchor[0], bOff + anchor[1]})
+		prevA, prevB = anchor[0]+1, anchor[1]+1
+	}
+	patienceMatches(a[prevA:], b[prevB:], aOff+prevA, bOff+prevB, out)
+}
+
+// longestIncreasing returns the longest subsequence of pairs (sorted on their first value) whose second values are increasing, using patience sorting.
+func longestIncreasing(pairs [][2]int) [][2]int {
+	tops := []int{}                 // index into pairs of the top card of each pile
+	prev := make([]int, len(pairs)) // back pointer to the top of the previous pile when the card was placed
+
+	for i, p := range pairs {
+		// Leftmost pile whose top is greater than p
+		pile, _ := slices.BinarySearchFunc(tops, p[1], func(top, target int) int {
+			return pairs[top][1] - target
+		})
+		prev[i] = -1
+		if pile > 0 {
+			prev[i] = tops[pile-1]
+		}
+		if pile == len(tops) {
+			tops = append(tops, i)
+		} else {
+			tops[pile] = i
+		}
+	}
+
+	// Follow back pointers from the top of the last pile
+	result := make([][2]int, len(tops))
+	for i, k := len(tops)-1, tops[len(tops)-1]; i >= 0; i, k = i-1, prev[k] {
+		result[i] = pairs[k]
+	}
+	return result
+}
+
+// Lines occurring more often than this in a region are not used as histogram anchors.
+const maxHistogramChain = 64
+
+// histogramMatches appends the matches found by histogram diff : the common region built around the least frequent line of a is used as an anchor, and both sides of it are diffed recursively, falling back to Myers when every line is too frequent.
+func histogramMatches(a, b []int, aOff, bOff int, out *[][2]int) {
+	a, b, aOff, bOff, suffix := commonAffixes(a, b, aOff, bOff, out)
+	defer appendSuffix(aOff+len(a), bOff+len(b), suffix, out)
+
+	if len(a) == 0 || len(b) == 0 {
+		return
+	}
+
+	// Occurrences of each line in a
+	occurrences := map[int][]int{}
+	for i, line := range a {
+		occurrences[line] = append(occurrences[line], i)
+	}
+
+	// Find the longest common region, preferring the ones built on rarer lines
+	bestLen, bestCount := 0, maxHistogramChain+1
+	bestA, bestB := 0, 0
+	for j := 0; j < len(b); {
+		positions := occurrences[b[j]]
+		if len(positions) == 0 || len(positions) > maxHistogramChain {
+			j++
+			continue
+		}
+
+		nextJ := j + 1
+		for _, i := range positions {
+			// Extend the match in both directions
+			startA, startB := i, j
+			for startA > 0 && startB > 0 && a[startA-1] == b[startB-1] {
+				startA, startB = startA-1, startB-1
+			}
+			endA, endB := i+1, j+1
+			for endA < len(a) && endB < len(b) && a[endA] == b[endB] {
+				endA, endB = endA+1, endB+1
+			}
+
+			// Lowest occurrence count of the lines in the region
+			count := len(positions)
+			for k := startA; k < endA; k++ {
+				count = min(count, len(occurrences[a[k]]))
+			}
+
+			if count < bestCount || (count == bestCount && endA-startA > bestLen) {
+				bestLen, bestCount = endA-startA, count
+				bestA, bestB = startA, startB
+			}
+			nextJ = max(nextJ, endB)
+		}
+		j = nextJ
+	}
+
+	if bestLen == 0 {
+		myersMatches(a, b, aOff, bOff, out)
+		return
+	}
+
+	histogramMatches(a[:bestA], b[:bestB], aOff, bOff, out)
+	for k := 0; k < bestLen; k++ {
+		*out = append(*out, [2]int{aOff + bestA + k, bOff + bestB + k})
+	}
+	histogramMatches(a[bestA+bestLen:], b[bestB+bestLen:], aOff+bestA+bestLen, bOff+bestB+bestLen, out)
+}
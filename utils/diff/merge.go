@@ -0,0 +1,165 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+)
+
+// Conflicts separated by at most this many unchanged lines are joined into one, like git.
+const conflictJoinDistance = 3
+
+// mergeSegment is a region of a three-way merge : lines taken as is, or a conflict between ours and theirs.
+type mergeSegment struct {
+	conflict bool
+	changed  bool     // lines changed on one side (or the same way on both), never joined with conflicts
+	lines    []string // merged lines, when not a conflict
+	ours     []string // conflicting lines of each side
+	theirs   []string
+}
+
+// Merge3 merges the changes made from base to ours and from base to theirs, line by line. Regions changed on only one side (or identically on both) are taken as is, regions changed differently on both sides are written between conflict markers labelled oursLabel and theirsLabel. Like git, lines both sides of a conflict have in common are moved out of it, and conflicts close to each other are joined. It returns the merged content and the number of conflicts.
+func Merge3(base, ours, theirs []byte, oursLabel, theirsLabel string, algo Algorithm) ([]byte, int) {
+	baseLines, oursLines, theirsLines := SplitLines(base), SplitLines(ours), SplitLines(theirs)
+	toOurs := lineMatches(baseLines, oursLines, algo)
+	toTheirs := lineMatches(baseLines, theirsLines, algo)
+
+	segments := []mergeSegment{}
+	i, j, k := 0, 0, 0
+	for {
+		// Stable line, unchanged on both sides
+		if i < len(baseLines) && toOurs[i] == j && toTheirs[i] == k {
+			segments = appendUnchanged(segments, baseLines[i:i+1])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+
+		// The changed region ends at the next base line kept on both sides
+		x := i
+		for x < len(baseLines) && (toOurs[x] == -1 || toTheirs[x] == -1) {
+			x++
+		}
+		nextJ, nextK := len(oursLines), len(theirsLines)
+		if x < len(baseLines) {
+			nextJ, nextK = toOurs[x], toTheirs[x]
+		}
+		if x == i && nextJ == j && nextK == k {
+			break
+		}
+
+		baseChunk, oursChunk, theirsChunk := baseLines[i:x], oursLines[j:nextJ], theirsLines[k:nextK]
+		switch {
+		case slices.Equal(oursChunk, baseChunk):
+			// Only changed in theirs
+			segments = append(segments, mergeSegment{changed: true, lines: theirsChunk})
+		case slices.Equal(theirsChunk, baseChunk) || slices.Equal(oursChunk, theirsChunk):
+			// Only changed in ours, or the same change on both sides
+			segments = append(segments, mergeSegment{changed: true, lines: oursChunk})
+		default:
+			segments = appendConflict(segments, oursChunk, theirsChunk, algo)
+		}
+		i, j, k = x, nextJ, nextK
+	}
+	segments = joinConflicts(segments)
+
+	// Write the merged content
+	var sb strings.Builder
+	conflicts := 0
+	for _, seg := range segments {
+		if !seg.conflict {
+			writeLines(&sb, seg.lines)
+			continue
+		}
+		sb.WriteString("<<<<<<< " + oursLabel + "\n")
+		writeConflictSide(&sb, seg.ours)
+		sb.WriteString("=======\n")
+		writeConflictSide(&sb, seg.theirs)
+		sb.WriteString(">>>>>>> " + theirsLabel + "\n")
+		conflicts++
+	}
+	return []byte(sb.String()), conflicts
+}
+
+// lineMatches returns, for each line of a, the index of the line of b it is matched with, or -1.
+func lineMatches(a, b []string, algo Algorithm) []int {
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+	for _, e := range Lines(a, b, algo) {
+		if e.Op == Equal {
+			matches[e.OldIndex] = e.NewIndex
+		}
+	}
+	return matches
+}
+
+// appendUnchanged appends lines unchanged on both sides, extending the last segment if it holds unchanged lines too.
+func appendUnchanged(segments []mergeSegment, lines []string) []mergeSegment {
+	if n := len(segments); n > 0 && !segments[n-1].conflict && !segments[n-1].changed {
+		segments[n-1].lines = append(segments[n-1].lines, lines...)
+		return segments
+	}
+	return append(segments, mergeSegment{lines: slices.Clone(lines)})
+}
+
+// appendConflict appends a region changed differently on both sides. When both sides have lines, they are diffed so that the lines they share are left out of the conflict.
+func appendConflict(segments []mergeSegment, ours, theirs []string, algo Algorithm) []mergeSegment {
+	if len(ours) == 0 || len(theirs) == 0 {
+		return append(segments, mergeSegment{conflict: true, ours: ours, theirs: theirs})
+	}
+
+	var curr *mergeSegment
+	for _, e := range Lines(ours, theirs, algo) {
+		if e.Op == Equal {
+			if curr != nil {
+				segments, curr = append(segments, *curr), nil
+			}
+			segments = appendUnchanged(segments, []string{e.Text})
+			continue
+		}
+		if curr == nil {
+			curr = &mergeSegment{conflict: true}
+		}
+		if e.Op == Delete {
+			curr.ours = append(curr.ours, e.Text)
+		} else {
+			curr.theirs = append(curr.theirs, e.Text)
+		}
+	}
+	if curr != nil {
+		segments = append(segments, *curr)
+	}
+	return segments
+}
+
+// joinConflicts joins conflicts separated by a few unchanged lines, which then belong to both sides of the joined conflict.
+func joinConflicts(segments []mergeSegment) []mergeSegment {
+	joined := []mergeSegment{}
+	for _, seg := range segments {
+		n := len(joined)
+		if seg.conflict && n >= 2 && joined[n-2].conflict && !joined[n-1].conflict && !joined[n-1].changed && len(joined[n-1].lines) <= conflictJoinDistance {
+			prev, between := joined[n-2], joined[n-1].lines
+			prev.ours = slices.Concat(prev.ours, between, seg.ours)
+			prev.theirs = slices.Concat(prev.theirs, between, seg.theirs)
+			joined = append(joined[:n-2], prev)
+			continue
+		}
+		joined = append(joined, seg)
+	}
+	return joined
+}
+
+// writeLines writes lines as they are.
+func writeLines(sb *strings.Builder, lines []string) {
+	for _, line := range lines {
+		sb.WriteString(line)
+	}
+}
+
+// writeConflictSide writes one side of a conflict, terminating its last line so that the next marker stays on its own line.
+func writeConflictSide(sb *strings.Builder, lines []string) {
+	writeLines(sb, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		sb.WriteByte('\n')
+	}
+}
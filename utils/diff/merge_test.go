@@ -0,0 +1,87 @@
+package diff
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name          string
+		base          string
+		ours          string
+		theirs        string
+		want          string
+		wantConflicts int
+	}{
+		{
+			name: "changes on different lines",
+			base: "a\nb\nc\nd\ne\n", ours: "A\nb\nc\nd\ne\n", theirs: "a\nb\nc\nd\nE\n",
+			want: "A\nb\nc\nd\nE\n",
+		},
+		{
+			name: "same change on both sides",
+			base: "a\nb\nc\n", ours: "a\nB\nc\n", theirs: "a\nB\nc\n",
+			want: "a\nB\nc\n",
+		},
+		{
+			name: "deletion and addition",
+			base: "a\nb\nc\n", ours: "a\nc\n", theirs: "a\nb\nc\nd\n",
+			want: "a\nc\nd\n",
+		},
+		{
+			name: "deletion on one side only",
+			base: "a\nb\nc\n", ours: "a\nb\nc\n", theirs: "a\nc\n",
+			want: "a\nc\n",
+		},
+		{
+			name: "conflicting change",
+			base: "a\nb\nc\n", ours: "a\nX\nc\n", theirs: "a\nY\nc\n",
+			want:          "a\n<<<<<<< ours\nX\n=======\nY\n>>>>>>> theirs\nc\n",
+			wantConflicts: 1,
+		},
+		{
+			name: "conflicting additions without base",
+			base: "", ours: "one\n", theirs: "two\n",
+			want:          "<<<<<<< ours\none\n=======\ntwo\n>>>>>>> theirs\n",
+			wantConflicts: 1,
+		},
+		{
+			name: "lines in common moved out of the conflict",
+			base: "a\nb\nc\n", ours: "a\nx\ny\nz\nc\n", theirs: "a\nx\nQ\nz\nc\n",
+			want:          "a\nx\n<<<<<<< ours\ny\n=======\nQ\n>>>>>>> theirs\nz\nc\n",
+			wantConflicts: 1,
+		},
+		{
+			name: "close conflicts joined",
+			base: "a\nb\nc\nd\ne\nf\ng\n", ours: "a\nB1\nc\nD1\ne\nf\ng\n", theirs: "a\nB2\nc\nD2\ne\nf\ng\n",
+			want:          "a\n<<<<<<< ours\nB1\nc\nD1\n=======\nB2\nc\nD2\n>>>>>>> theirs\ne\nf\ng\n",
+			wantConflicts: 1,
+		},
+	}
+	for _, tt := range tests {
+		for _, algo := range []Algorithm{Myers, Patience, Histogram} {
+			t.Run(tt.name+"/"+string(algo), func(t *testing.T) {
+				got, conflicts := Merge3([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), "ours", "theirs", algo)
+				if string(got) != tt.want || conflicts != tt.wantConflicts {
+					t.Errorf("Merge3 = %q, %d conflicts, want %q, %d conflicts", got, conflicts, tt.want, tt.wantConflicts)
+				}
+			})
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"", false},
+		{"plain text\n", false},
+		{"caf\xc3\xa9\n", false},
+		{"\x00\x01\x02", true},
+		{"text then a NUL\x00", true},
+	}
+	for _, tt := range tests {
+		if got := IsBinary([]byte(tt.content)); got != tt.want {
+			t.Errorf("IsBinary(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DefaultContext is the number of unchanged lines shown around each change, like git's -U3.
+const DefaultContext = 3
+
+// Hunk is a group of nearby changes along with their surrounding context.
+type Hunk struct {
+	OldStart, OldLines int // 1-based first line and line count on the old side
+	NewStart, NewLines int // 1-based first line and line count on the new side
+	Edits              []Edit
+}
+
+// Header returns the "@@ -l,s +l,s @@" line of the hunk. Like git, a count of 1 is omitted, and an empty side starts at the line before.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+// hunkRange formats one side of a hunk header.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	default:
+		return fmt.Sprintf("%d,%d", start, count)
+	}
+}
+
+// Hunks groups an edit script into hunks, keeping context unchanged lines around each change. Changes separated by at most 2*context unchanged lines share a hunk.
+func Hunks(edits []Edit, context int) []Hunk {
+	hunks := []Hunk{}
+	context = max(context, 0)
+
+	// Number of lines on each side before edits[counted]
+	counted, oldBefore, newBefore := 0, 0, 0
+
+	i := 0
+	for i < len(edits) {
+		// Find the next change
+		for i < len(edits) && edits[i].Op == Equal {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		// Start with the context before it
+		start := max(i-context, 0)
+
+		// Extend while the next change is close enough
+		end := i
+		for {
+			for end < len(edits) && edits[end].Op != Equal {
+				end++
+			}
+			gap := 0
+			for end+gap < len(edits) && edits[end+gap].Op == Equal {
+				gap++
+			}
+			if end+gap == len(edits) || gap > 2*context {
+				end = min(end+context, end+gap)
+				break
+			}
+			end += gap
+		}
+
+		// Lines on each side before the hunk
+		for ; counted < start; counted++ {
+			if edits[counted].Op != Insert {
+				oldBefore++
+			}
+			if edits[counted].Op != Delete {
+				newBefore++
+			}
+		}
+
+		hunks = append(hunks, newHunk(edits[start:end], oldBefore, newBefore))
+		i = end
+	}
+	return hunks
+}
+
+// newHunk computes the line ranges covered by a slice of edits, given the number of lines on each side before it.
+func newHunk(edits []Edit, oldBefore, newBefore int) Hunk {
+	h := Hunk{Edits: edits, OldStart: oldBefore + 1, NewStart: newBefore + 1}
+	for _, e := range edits {
+		if e.Op != Insert {
+			h.OldLines++
+		}
+		if e.Op != Delete {
+			h.NewLines++
+		}
+	}
+	return h
+}
+
+// Unified returns the hunks of a unified diff between two contents ("" if they're identical), each hunk being a header followed by its lines prefixed with ' ', '-' or '+'. Lines missing their final newline are followed by "\ No newline at end of file".
+func Unified(oldContent, newContent []byte, context int, algo Algorithm) string {
+	oldLines := SplitLines(oldContent)
+	edits := Lines(oldLines, SplitLines(newContent), algo)
+
+	var sb strings.Builder
+	for _, h := range Hunks(edits, context) {
+		sb.WriteString(h.Header())
+		if funcName := hunkFuncName(oldLines, h.OldStart-1); funcName != "" {
+			sb.WriteString(" " + funcName)
+		}
+		sb.WriteByte('\n')
+
+		for _, e := range h.Edits {
+			switch e.Op {
+			case Equal:
+				sb.WriteByte(' ')
+			case Delete:
+				sb.WriteByte('-')
+			case Insert:
+				sb.WriteByte('+')
+			}
+			sb.WriteString(e.Text)
+			if !strings.HasSuffix(e.Text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// hunkFuncName returns the text shown after a hunk header, like git's default funcname : the closest line before oldIndex starting with a letter, '_' or '$', cut at 80 bytes.
+func hunkFuncName(oldLines []string, oldIndex int) string {
+	for i := min(oldIndex, len(oldLines)) - 1; i >= 0; i-- {
+		line := oldLines[i]
+		if line == "" {
+			continue
+		}
+		if c := line[0]; c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			line = strings.TrimRight(line, "\n")
+			return strings.TrimRightFunc(line[:min(len(line), 80)], unicode.IsSpace)
+		}
+	}
+	return ""
+}
@@ -1,16 +1,27 @@
 package types
 
+import "time"
+
 // CommitNode represents a commit object
 type CommitNode struct {
-	TreeSHA    [20]byte   // root tree SHA
-	ParentsSHA [][20]byte // parents commit SHA, can be multiple for merges
-	Author     Author     // author info
-	Committer  string     // committer info
-	Message    string     // commit message
+	TreeSHA      [20]byte       // root tree SHA
+	ParentsSHA   [][20]byte     // parents commit SHA, can be multiple for merges
+	Author       Author         // author info
+	Committer    Author         // committer info
+	ExtraHeaders []CommitHeader // any other header (encoding, gpgsig, mergetag...), in order
+	Message      string         // commit message
 }
 
-// Author Info is stored in this struct
+// Author Info is stored in this struct. Used for both author and committer signatures.
 type Author struct {
 	Name  string
 	Email string
+	When  time.Time // signature time, in the timezone it was recorded with, zero when the signature has none
+	Raw   string    // signature as it was read, written back as is while Name, Email and When are left unchanged
+}
+
+// CommitHeader is a header line of a commit object that has no dedicated field.
+type CommitHeader struct {
+	Key   string
+	Value string // multi-line values (e.g. gpgsig) are joined with "\n", without the leading space of continuation lines
 }
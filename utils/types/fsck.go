@@ -0,0 +1,14 @@
+package types
+
+// FsckProblem is something wrong found by fsck, as the line reporting it.
+type FsckProblem struct {
+	Error bool   // errors make fsck fail, warnings and notices don't
+	Text  string // e.g. "error in tree <sha>: treeNotSorted: not properly sorted"
+}
+
+// FsckResult is the outcome of checking a repository.
+type FsckResult struct {
+	Problems    []FsckProblem
+	Unreachable []ObjectInfo // objects not reachable from HEAD, refs, reflogs or the index, by SHA
+	Dangling    []ObjectInfo // unreachable objects which no other object points to either
+}
@@ -1,18 +1,64 @@
 package types
 
+// Bits of IndexEntry.Flags
+const (
+	IndexFlagAssumeValid = 0x8000 // the file is assumed unchanged, its stat data is not checked
+	IndexFlagExtended    = 0x4000 // the entry has extended flags (index version 3 and later)
+	IndexFlagStage       = 0x3000 // merge stage (see Stage)
+	IndexFlagNameLength  = 0x0FFF // length of the file name, capped at 0xFFF
+)
+
+// Bits of IndexEntry.ExtendedFlags
+const (
+	IndexFlagSkipWorktree = 0x4000 // the file is not checked out (sparse checkout)
+	IndexFlagIntentToAdd  = 0x2000 // the file is only recorded as to be added (git add -N)
+)
+
 // IndexEntry represents a single entry in the Git index (staging area).
 type IndexEntry struct {
-	Ctime    uint32   // seconds since epoch
-	CtimeNs  uint32   // nanoseconds
-	Mtime    uint32   // seconds since epoch
-	MtimeNs  uint32   // nanoseconds
-	Dev      uint32   // device
-	Ino      uint32   // inode
-	Mode     uint32   // file mode - 0100644 for regular file
-	Uid      uint32   // user id
-	Gid      uint32   // group id
-	FileSize uint32   // size in bytes
-	SHA1     [20]byte // SHA-1 hash of the file content
-	Flags    uint16   // flags
-	Filename string   // file name
+	Ctime         uint32   // seconds since epoch
+	CtimeNs       uint32   // nanoseconds
+	Mtime         uint32   // seconds since epoch
+	MtimeNs       uint32   // nanoseconds
+	Dev           uint32   // device
+	Ino           uint32   // inode
+	Mode          uint32   // file mode - 0100644 for regular file
+	Uid           uint32   // user id
+	Gid           uint32   // group id
+	FileSize      uint32   // size in bytes
+	SHA1          [20]byte // SHA-1 hash of the file content
+	Flags         uint16   // assume-valid, extended, stage and name length bits (see IndexFlag*)
+	ExtendedFlags uint16   // skip-worktree and intent-to-add bits, only stored by index version 3 and later
+	Filename      string   // file name
+}
+
+// Stage returns the merge stage of the entry : 0 for a normal entry, 1 (common ancestor), 2 (ours) or 3 (theirs) for an unmerged path.
+func (ie IndexEntry) Stage() int {
+	return int(ie.Flags&IndexFlagStage) >> 12
+}
+
+// SetStage sets the merge stage of the entry.
+func (ie *IndexEntry) SetStage(stage int) {
+	ie.Flags = ie.Flags&^IndexFlagStage | uint16(stage<<12)&IndexFlagStage
+}
+
+// IndexExtension is an extension of the index file which is kept as is.
+type IndexExtension struct {
+	Signature string // 4 bytes, e.g. "REUC"
+	Data      []byte
+}
+
+// CacheTree is a node of the cache-tree (TREE extension of the index) : the tree object of a directory of the index, as long as none of the entries below it changed.
+type CacheTree struct {
+	Name       string       // directory name, "" for the root
+	EntryCount int          // number of index entries below the directory, -1 when invalidated
+	SHA        [20]byte     // tree object, when valid
+	Subtrees   []*CacheTree // subdirectories
+}
+
+// Index is the content of the index file : the entries, followed by extensions.
+type Index struct {
+	Entries    []IndexEntry
+	CacheTree  *CacheTree       // TREE extension, nil when absent
+	Extensions []IndexExtension // other extensions, in file order
 }
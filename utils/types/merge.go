@@ -0,0 +1,18 @@
+package types
+
+// MergeConflict is a path which could not be merged automatically.
+type MergeConflict struct {
+	Path      string
+	Kind      string // "content", "add/add", "modify/delete", "binary", "submodule" or "file/directory"
+	DeletedBy string // label of the side which deleted the file (modify/delete only)
+	KeptBy    string // label of the side whose version is left in the working tree (modify/delete, binary, submodule and file/directory)
+	MovedFrom string // path of the file, a directory of the other side being there now (file/directory only)
+}
+
+// MergeResult is the outcome of a three-way tree merge.
+type MergeResult struct {
+	Entries    []IndexEntry         // merged index : stage 0 for merged paths, stages 1 (base), 2 (ours) and 3 (theirs) for conflicts
+	Files      map[string]TreeEntry // every file of the merged working tree, conflicted files hold conflict markers
+	Conflicts  []MergeConflict      // sorted by path
+	AutoMerged []string             // paths whose contents were merged line by line, sorted
+}
@@ -6,4 +6,12 @@ const (
 	BlobObject   ObjectType = "blob"
 	TreeObject   ObjectType = "tree"
 	CommitObject ObjectType = "commit"
+	TagObject    ObjectType = "tag"
 )
+
+// ObjectInfo identifies an object in the database, along with the path it was reached through (empty for commits and root trees).
+type ObjectInfo struct {
+	SHA  [20]byte
+	Type ObjectType
+	Path string
+}
@@ -0,0 +1,13 @@
+package types
+
+// PackedRef is a ref stored in .git/packed-refs instead of its own file under .git/refs.
+type PackedRef struct {
+	Name   string   // full name, e.g. refs/heads/master
+	SHA    [20]byte // object the ref points to
+	Peeled [20]byte // for annotated tags, the object the tag ultimately points to (the "^<sha>" line)
+}
+
+// HasPeeled reports whether the ref has a peeled value, i.e. points to an annotated tag.
+func (p PackedRef) HasPeeled() bool {
+	return p.Peeled != [20]byte{}
+}
@@ -0,0 +1,13 @@
+package types
+
+// RefUpdate is one operation of a ref transaction : the ref is set to New, deleted, or only checked, provided it still holds Old.
+type RefUpdate struct {
+	Name    string   // full name, e.g. refs/heads/master, or HEAD
+	New     [20]byte // value to set, unused for deletions and checks
+	Old     [20]byte // value the ref must hold, zero meaning it must not exist
+	HaveOld bool     // whether Old is checked at all
+	Delete  bool     // delete the ref (and its reflog)
+	Verify  bool     // only check Old, the ref is left as it is
+	NoDeref bool     // update HEAD itself, even when it is on a branch
+	Message string   // reflog message
+}
@@ -0,0 +1,9 @@
+package types
+
+// ReflogEntry is one line of a reflog : a ref moving from Old to New.
+type ReflogEntry struct {
+	Old       [20]byte
+	New       [20]byte
+	Committer Author // who moved the ref, and when
+	Message   string
+}
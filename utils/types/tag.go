@@ -0,0 +1,12 @@
+package types
+
+// TagNode represents an annotated tag object
+type TagNode struct {
+	ObjectSHA    [20]byte       // tagged object
+	ObjectType   ObjectType     // type of the tagged object
+	Name         string         // tag name, without refs/tags/
+	Tagger       Author         // tagger info, empty for some very old tags
+	ExtraHeaders []CommitHeader // any other header, in order
+	Message      string         // tag message
+	Raw          []byte         // tag object as it was read, written back as is while the other fields are left unchanged
+}
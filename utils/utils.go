@@ -37,8 +37,14 @@ func ParseModeStr(modeStr string) (uint32, error) {
 	switch modeStr {
 	case "100644":
 		return constants.ModeFile, nil
-	case "040000":
+	case "100755":
+		return constants.ModeExec, nil
+	case "120000":
+		return constants.ModeSymlink, nil
+	case "040000", "40000": // git itself writes tree modes without the leading zero
 		return constants.ModeTree, nil
+	case "160000": // gitlink : the commit of a submodule
+		return constants.ModeGitlink, nil
 	default:
 		return 0, fmt.Errorf("invalid mode: %s", modeStr)
 	}